@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 	"github.com/goccy/go-json"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cast"
@@ -67,27 +68,43 @@ var (
 	cfg                                          *Config
 	log                                          zerolog.Logger
 	writeToFileCounter                           int
-	dnsProtocol, format, outputFile              string
+	dnsCABundle, dnsHTTPMethod, dnsProtocol      string
+	dnssecTrustAnchor, publicSuffixList          string
+	format, outputFile                           string
 	dkimSelector, nameservers                    []string
-	advise, debug, checkTLS, prettyLog, zoneFile bool
-	dnsBuffer                                    uint16
-	cache, timeout                               time.Duration
+	advise, authoritative, debug, checkTLS       bool
+	iterative, prettyLog, zoneFile               bool
+	dmarcTreeWalk, dnssecValidate, evidence      bool
+	dnsBuffer, dnsRetries                        uint16
+	cache, dnsRetryBackoff, scanTimeout, timeout time.Duration
 	concurrent                                   uint16
 )
 
 func main() {
 	cmd.PersistentFlags().BoolVarP(&advise, "advise", "a", false, "Provide suggestions for incorrect/missing mail security features")
+	cmd.PersistentFlags().BoolVar(&authoritative, "authoritative", false, "Query each of a domain's authoritative nameservers directly and report any inconsistencies")
 	cmd.PersistentFlags().DurationVar(&cache, "cache", 3*time.Minute, "Specify how long to cache results for")
 	cmd.PersistentFlags().BoolVar(&checkTLS, "checkTLS", false, "Check the TLS connectivity and cert validity of domains")
 	cmd.PersistentFlags().Uint16VarP(&concurrent, "concurrent", "c", uint16(runtime.NumCPU()), "The number of domains to scan concurrently")
 	cmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Print debug logs")
 	cmd.PersistentFlags().StringSliceVar(&dkimSelector, "dkimSelector", []string{}, "Specify a DKIM selector")
+	cmd.PersistentFlags().BoolVar(&dmarcTreeWalk, "dmarcTreeWalk", false, "Discover DMARC policies using the DMARCbis DNS tree walk instead of the organizational domain")
 	cmd.PersistentFlags().Uint16Var(&dnsBuffer, "dnsBuffer", 4096, "Specify the allocated buffer for DNS responses")
-	cmd.PersistentFlags().StringVar(&dnsProtocol, "dnsProtocol", "udp", "Protocol to use for DNS queries (udp, tcp, tcp-tls)")
+	cmd.PersistentFlags().StringVar(&dnsCABundle, "dnsCABundle", "", "PEM-encoded CA bundle used to verify tcp-tls, https and quic nameservers")
+	cmd.PersistentFlags().StringVar(&dnsHTTPMethod, "dnsHTTPMethod", "POST", "HTTP method to use for DNS-over-HTTPS queries (GET, POST)")
+	cmd.PersistentFlags().StringVar(&dnsProtocol, "dnsProtocol", "udp", "Protocol to use for DNS queries (udp, tcp, tcp-tls, https, quic)")
+	cmd.PersistentFlags().Uint16Var(&dnsRetries, "dnsRetries", 2, "Number of times to retry a failed DNS query against the next nameserver")
+	cmd.PersistentFlags().DurationVar(&dnsRetryBackoff, "dnsRetryBackoff", 100*time.Millisecond, "Delay before the first DNS retry, which doubles for each subsequent retry")
+	cmd.PersistentFlags().StringVar(&dnssecTrustAnchor, "dnssecTrustAnchor", "", "File of DS or DNSKEY records to use as DNSSEC trust anchors instead of the root zone's (implies --dnssecValidate)")
+	cmd.PersistentFlags().BoolVar(&dnssecValidate, "dnssecValidate", false, "Validate DNSSEC signatures locally instead of trusting the nameservers' AD bit")
+	cmd.PersistentFlags().BoolVar(&evidence, "evidence", false, "Include every DNS query made and its raw response (records, TTLs, nameserver, flags and latency) in the results")
 	cmd.PersistentFlags().StringVarP(&format, "format", "f", "yaml", "Format to print results in (yaml, json)")
-	cmd.PersistentFlags().StringSliceVarP(&nameservers, "nameservers", "n", nil, "Use specific nameservers, in `host[:port]` format; may be specified multiple times")
+	cmd.PersistentFlags().BoolVar(&iterative, "iterative", false, "Resolve queries iteratively from the root nameservers instead of using a recursive resolver")
+	cmd.PersistentFlags().StringSliceVarP(&nameservers, "nameservers", "n", nil, "Use specific nameservers, in `host[:port]` format (or as URLs for https); may be specified multiple times")
 	cmd.PersistentFlags().StringVarP(&outputFile, "outputFile", "o", "", "Output the results to a specified file (creates a file with the current unix timestamp if no file is specified)")
 	cmd.PersistentFlags().BoolVar(&prettyLog, "prettyLog", true, "Pretty print logs to console")
+	cmd.PersistentFlags().StringVar(&publicSuffixList, "publicSuffixList", "", "File containing a newer Public Suffix List, used to find organizational domains (defaults to the embedded list)")
+	cmd.PersistentFlags().DurationVar(&scanTimeout, "scanTimeout", 0, "Overall timeout for scanning a single domain (0 disables the limit)")
 	cmd.PersistentFlags().DurationVarP(&timeout, "timeout", "t", 15*time.Second, "Timeout duration for queries")
 	cmd.PersistentFlags().BoolVarP(&zoneFile, "zoneFile", "z", false, "Input file/pipe containing an RFC 1035 zone file")
 
@@ -154,6 +171,44 @@ func printToFile(data interface{}, file string) {
 	}
 }
 
+// scannerOptions returns the scanner options set by the global flags.
+func scannerOptions() []scanner.Option {
+	opts := []scanner.Option{
+		scanner.WithAuthoritativeCheck(authoritative),
+		scanner.WithCacheDuration(cache),
+		scanner.WithConcurrentScans(concurrent),
+		scanner.WithDMARCTreeWalk(dmarcTreeWalk),
+		scanner.WithDNSBuffer(dnsBuffer),
+		scanner.WithDNSHTTPMethod(dnsHTTPMethod),
+		scanner.WithDNSProtocol(dnsProtocol),
+		scanner.WithDNSRetries(dnsRetries),
+		scanner.WithDNSRetryBackoff(dnsRetryBackoff),
+		scanner.WithDNSSECValidation(dnssecValidate),
+		scanner.WithEvidence(evidence),
+		scanner.WithIterativeResolution(iterative),
+		scanner.WithNameservers(nameservers),
+		scanner.WithScanTimeout(scanTimeout),
+	}
+
+	if len(dkimSelector) > 0 {
+		opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
+	}
+
+	if dnsCABundle != "" {
+		opts = append(opts, scanner.WithDNSCABundle(dnsCABundle))
+	}
+
+	if dnssecTrustAnchor != "" {
+		opts = append(opts, scanner.WithDNSSECTrustAnchor(dnssecTrustAnchor))
+	}
+
+	if publicSuffixList != "" {
+		opts = append(opts, scanner.WithPublicSuffixList(publicSuffixList))
+	}
+
+	return opts
+}
+
 func setRequiredFlags(command *cobra.Command, flags ...string) error {
 	for _, flag := range flags {
 		if err := command.MarkFlagRequired(flag); err != nil {
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"io"
 	"os"
+	"os/signal"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/advisor"
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
@@ -12,27 +15,19 @@ import (
 
 func init() {
 	cmd.AddCommand(cmdScan)
+
+	cmdScan.Flags().BoolVar(&parked, "parked", false, "Check every domain against the parked domain profile, for domains known not to send or receive mail")
 }
 
+var parked bool
+
 var cmdScan = &cobra.Command{
 	Use:     "scan [flags] <STDIN>",
 	Example: "  dss scan <STDIN>\n  dss scan globalcyberalliance.org gcaaide.org google.com\n  dss scan -z < zonefile",
 	Short:   "Scan DNS records for one or multiple domains.",
 	Long:    "Scan DNS records for one or multiple domains.\nBy default, the command will listen on STDIN, allowing you to type or pipe multiple domains.",
 	Run: func(command *cobra.Command, args []string) {
-		opts := []scanner.Option{
-			scanner.WithCacheDuration(cache),
-			scanner.WithConcurrentScans(concurrent),
-			scanner.WithDNSBuffer(dnsBuffer),
-			scanner.WithDNSProtocol(dnsProtocol),
-			scanner.WithNameservers(nameservers),
-		}
-
-		if len(dkimSelector) > 0 {
-			opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
-		}
-
-		sc, err := scanner.New(log, timeout, opts...)
+		sc, err := scanner.New(log, timeout, scannerOptions()...)
 		if err != nil {
 			log.Fatal().Err(err).Msg("An unexpected error occurred.")
 		}
@@ -40,55 +35,85 @@ var cmdScan = &cobra.Command{
 		domainAdvisor := advisor.NewAdvisor(timeout, cache, checkTLS)
 
 		if format == "csv" && outputFile == "" {
-			log.Info().Msg("CSV header: domain,BIMI,DKIM,DMARC,MX,SPF,TXT,error,advice")
+			log.Info().Msg("CSV header: domain,BIMI,DKIM,DMARC,MX,SPF,TLS-RPT,error,advice")
 		}
 
-		var results []*scanner.Result
+		ctx, cancel := signal.NotifyContext(command.Context(), os.Interrupt)
+		defer cancel()
+
+		var (
+			results  <-chan *scanner.Result
+			readErrs <-chan error
+		)
 
 		if len(args) == 0 && zoneFile {
-			results, err = sc.ScanZone(os.Stdin)
-			if err != nil {
-				log.Fatal().Err(err).Msg("An unexpected error occurred.")
-			}
+			results, err = sc.ScanZoneStream(ctx, os.Stdin)
 		} else if len(args) > 0 && zoneFile {
 			log.Fatal().Msg("-z flag provided, but not reading from STDIN")
 		} else if len(args) == 0 {
 			log.Info().Msg("Enter one or more domains to scan (press Ctrl-C to finish):")
 
-			scanner := bufio.NewScanner(os.Stdin)
-
-			for scanner.Scan() {
-				domain := scanner.Text()
-				results, err = sc.Scan(domain)
-				if err != nil {
-					log.Fatal().Err(err).Msg("An unexpected error occurred.")
-				}
-
-				for _, result := range results {
-					printResult(result, domainAdvisor)
-				}
-			}
+			var domains <-chan string
+			domains, readErrs = readDomains(ctx, os.Stdin)
 
-			if err = scanner.Err(); err != nil {
-				log.Fatal().Err(err).Msg("An error occurred while reading from stdin.")
-			}
+			results, err = sc.ScanStream(ctx, domains)
 		} else {
-			results, err = sc.Scan(args...)
-			if err != nil {
-				log.Fatal().Err(err).Msg("An unexpected error occurred.")
+			domains := make(chan string, len(args))
+			for _, domain := range args {
+				domains <- domain
 			}
+			close(domains)
+
+			results, err = sc.ScanStream(ctx, domains)
 		}
 
 		if err != nil {
 			log.Fatal().Err(err).Msg("An unexpected error occurred.")
 		}
 
-		for _, result := range results {
+		// print each result as soon as its domain has been scanned
+		for result := range results {
 			printResult(result, domainAdvisor)
 		}
+
+		// only report a failure to read stdin once the domains read before it have been printed
+		if readErrs != nil {
+			if err = <-readErrs; err != nil {
+				log.Fatal().Err(err).Msg("An error occurred while reading from stdin.")
+			}
+		}
 	},
 }
 
+// readDomains sends each line read from reader on the returned channel, until
+// reader is exhausted or ctx is cancelled. Any error reading from reader is
+// sent on the second channel, which is closed once the first is.
+func readDomains(ctx context.Context, reader io.Reader) (<-chan string, <-chan error) {
+	domains := make(chan string)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(domains)
+
+		scanner := bufio.NewScanner(reader)
+
+		for scanner.Scan() {
+			select {
+			case domains <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			errs <- err
+		}
+	}()
+
+	return domains, errs
+}
+
 func printResult(result *scanner.Result, domainAdvisor *advisor.Advisor) {
 	if result == nil {
 		log.Fatal().Msg("An unexpected error occurred.")
@@ -99,7 +124,7 @@ func printResult(result *scanner.Result, domainAdvisor *advisor.Advisor) {
 	}
 
 	if advise && result.Error != scanner.ErrInvalidDomain {
-		resultWithAdvice.Advice = domainAdvisor.CheckAll(result.Domain, result.BIMI, result.DKIM, result.DMARC, result.MX, result.SPF)
+		resultWithAdvice.Advice = domainAdvisor.CheckResult(result, advisor.WithParked(parked))
 	}
 
 	printToConsole(resultWithAdvice)
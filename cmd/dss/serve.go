@@ -47,19 +47,7 @@ var (
 		Use:   "api",
 		Short: "Serve DNS security queries via a dedicated API",
 		Run: func(command *cobra.Command, args []string) {
-			opts := []scanner.Option{
-				scanner.WithCacheDuration(cache),
-				scanner.WithConcurrentScans(concurrent),
-				scanner.WithDNSBuffer(dnsBuffer),
-				scanner.WithDNSProtocol(dnsProtocol),
-				scanner.WithNameservers(nameservers),
-			}
-
-			if len(dkimSelector) > 0 {
-				opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
-			}
-
-			sc, err := scanner.New(log, timeout, opts...)
+			sc, err := scanner.New(log, timeout, scannerOptions()...)
 			if err != nil {
 				log.Fatal().Err(err).Msg("could not create domain scanner")
 			}
@@ -79,19 +67,7 @@ var (
 		Use:   "mail",
 		Short: "Serve DNS security queries via a dedicated email account",
 		Run: func(command *cobra.Command, args []string) {
-			opts := []scanner.Option{
-				scanner.WithCacheDuration(cache),
-				scanner.WithConcurrentScans(concurrent),
-				scanner.WithDNSBuffer(dnsBuffer),
-				scanner.WithDNSProtocol(dnsProtocol),
-				scanner.WithNameservers(nameservers),
-			}
-
-			if len(dkimSelector) > 0 {
-				opts = append(opts, scanner.WithDKIMSelectors(dkimSelector...))
-			}
-
-			sc, err := scanner.New(log, timeout, opts...)
+			sc, err := scanner.New(log, timeout, scannerOptions()...)
 			if err != nil {
 				log.Fatal().Err(err).Msg("could not create domain scanner")
 			}
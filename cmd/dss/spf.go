@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"os/signal"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.AddCommand(cmdSPF)
+	cmdSPF.AddCommand(cmdSPFEval)
+
+	cmdSPFEval.Flags().StringVar(&spfHelo, "helo", "", "Domain given by the client in its HELO/EHLO command (used when the sender is empty)")
+	cmdSPFEval.Flags().StringVar(&spfIP, "ip", "", "IP address of the sending mail server")
+	cmdSPFEval.Flags().StringVar(&spfSender, "sender", "", "Envelope sender (MAIL FROM) address")
+
+	if err := setRequiredFlags(cmdSPFEval, "ip"); err != nil {
+		log.Fatal().Err(err).Msg("unable to set required flags for 'spf eval' command")
+	}
+}
+
+var (
+	spfHelo, spfIP, spfSender string
+
+	cmdSPF = &cobra.Command{
+		Use:   "spf",
+		Short: "Evaluate SPF records",
+		Run: func(command *cobra.Command, args []string) {
+			_ = command.Help()
+		},
+	}
+
+	cmdSPFEval = &cobra.Command{
+		Use:     "eval",
+		Example: "  dss spf eval --ip 203.0.113.5 --sender bounce@example.com --helo mx.example.com",
+		Short:   "Check whether a mail server may send mail for a sender, according to SPF.",
+		Long:    "Check whether a mail server may send mail for a sender, according to SPF.\nThis evaluates the sender domain's SPF record as a receiving mail server would (RFC 7208's check_host function).",
+		Run: func(command *cobra.Command, args []string) {
+			ip, err := netip.ParseAddr(spfIP)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid IP address")
+			}
+
+			sc, err := scanner.New(log, timeout, scannerOptions()...)
+			if err != nil {
+				log.Fatal().Err(err).Msg("An unexpected error occurred.")
+			}
+			defer sc.Close()
+
+			ctx, cancel := signal.NotifyContext(command.Context(), os.Interrupt)
+			defer cancel()
+
+			evaluation, err := sc.EvaluateSPF(ctx, ip, spfSender, spfHelo)
+			if err != nil {
+				log.Fatal().Err(err).Msg("could not evaluate SPF")
+			}
+
+			printToConsole(evaluation)
+		},
+	}
+)
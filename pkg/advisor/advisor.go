@@ -5,16 +5,31 @@ import (
 	"net"
 	"net/http"
 	"net/smtp"
+	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 	"github.com/spf13/cast"
 )
 
+// domainLooksGood is the domain advice given when nothing is wrong.
+const domainLooksGood = "Your domain looks good! No further action needed."
+
+// dkimOtherSelectors is added to the DKIM advice, as only the known selectors can be checked.
+const dkimOtherSelectors = "If you have other 3rd party systems, please send a test email to confirm DKIM is setup properly for them, as we can only check known selectors."
+
+// mtastsMinMaxAge is the shortest MTA-STS max_age (in seconds) that we consider useful.
+const mtastsMinMaxAge = 86400
+
+// spfLookupWarning is the number of SPF DNS lookups at which we warn that the limit of 10 is close.
+const spfLookupWarning = 8
+
 var emailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
 type (
@@ -27,13 +42,23 @@ type (
 		checkTLS             bool
 	}
 
+	// CheckOption configures a single call to CheckResult.
+	CheckOption func(*checkConfig)
+
+	checkConfig struct {
+		parked bool
+	}
+
 	Advice struct {
 		Domain []string `json:"domain,omitempty" yaml:"domain,omitempty" doc:"Domain advice." example:"Your domain looks good! No further action needed."`
 		BIMI   []string `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"BIMI advice." example:"Your BIMI record looks good! No further action needed."`
 		DKIM   []string `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"DKIM advice." example:"DKIM is setup for this email server. However, if you have other 3rd party systems, please send a test email to confirm DKIM is setup properly."`
 		DMARC  []string `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"DMARC advice." example:"You are currently at the lowest level and receiving reports, which is a great starting point. Please make sure to review the reports, make the appropriate adjustments, and move to either quarantine or reject soon."`
+		DNSSEC []string `json:"dnssec,omitempty" yaml:"dnssec,omitempty" doc:"DNSSEC advice." example:"DNSSEC is setup correctly! No further action needed."`
+		MTASTS []string `json:"mtaSts,omitempty" yaml:"mtaSts,omitempty" doc:"MTA-STS advice." example:"MTA-STS is setup correctly! No further action needed."`
 		MX     []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"MX advice." example:"You have a multiple mail servers setup! No further action needed."`
 		SPF    []string `json:"spf,omitempty" yaml:"spf,omitempty" doc:"SPF advice." example:"SPF seems to be setup correctly! No further action needed."`
+		TLSRPT []string `json:"tlsrpt,omitempty" yaml:"tlsrpt,omitempty" doc:"TLS-RPT advice." example:"Your TLS-RPT record looks good! No further action needed."`
 	}
 
 	// dmarc represents the structure of a DMARC record.
@@ -41,6 +66,9 @@ type (
 		Version                    string
 		Policy                     string
 		SubdomainPolicy            string
+		NonExistentPolicy          string
+		PublicSuffix               string
+		Testing                    string
 		Percentage                 int
 		AggregateReportDestination []string
 		ForensicReportDestination  []string
@@ -69,6 +97,18 @@ func NewAdvisor(timeout time.Duration, cacheLifetime time.Duration, checkTLS boo
 	return &advisor
 }
 
+// WithParked checks the domain against the parked domain profile, as if it
+// publishes a null MX record, for domains known not to send or receive mail.
+func WithParked(parked bool) CheckOption {
+	return func(config *checkConfig) {
+		config.parked = parked
+	}
+}
+
+// CheckAll checks a domain's BIMI, DKIM, DMARC, MX and SPF records.
+//
+// Deprecated: use CheckResult, which checks every record in a scan result and
+// explains any lookups which failed.
 func (a *Advisor) CheckAll(domain, bimi, dkim, dmarc string, mx []string, spf string) *Advice {
 	advice := &Advice{}
 	var wg sync.WaitGroup
@@ -109,6 +149,99 @@ func (a *Advisor) CheckAll(domain, bimi, dkim, dmarc string, mx []string, spf st
 	return advice
 }
 
+// CheckResult checks every record in a scan result, explaining any lookups
+// which failed first.
+func (a *Advisor) CheckResult(result *scanner.Result, opts ...CheckOption) *Advice {
+	var config checkConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	// failed lookups are explained first, as they may invalidate the rest of the advice for a check
+	failed := checkLookupErrors(result.Errors)
+
+	// domains which don't send or receive mail are checked against a dedicated profile
+	if config.parked || result.Parked || result.NullMX {
+		return a.checkParked(result, failed)
+	}
+
+	advice := &Advice{}
+	var wg sync.WaitGroup
+
+	// oversized records are flagged alongside the other advice for each record
+	largeDKIM, largeDMARC, largeSPF := checkLargeResponses(result.LargeResponses)
+
+	// inconsistent authoritative nameservers are flagged alongside the advice for the records they disagree on
+	authoritative := checkAuthoritative(result.Authoritative)
+
+	wg.Add(9)
+	go func() {
+		advice.Domain = a.CheckDomain(result.Domain)
+
+		// problems with the domain's nameservers take the place of the all-clear
+		if problems := append(failed[scanner.CheckAuthoritative], authoritative["domain"]...); len(problems) > 0 {
+			advice.Domain = append(problems, slices.DeleteFunc(advice.Domain, func(advice string) bool {
+				return advice == domainLooksGood
+			})...)
+		}
+		wg.Done()
+	}()
+
+	go func() {
+		advice.BIMI = append(failed[scanner.CheckBIMI], a.CheckBIMI(result.BIMI)...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.DKIM = append(failed[scanner.CheckDKIM], a.CheckDKIMRecords(result.DKIMRecords)...)
+		advice.DKIM = append(advice.DKIM, largeDKIM...)
+		advice.DKIM = append(advice.DKIM, authoritative["dkim"]...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.DMARC = append(failed[scanner.CheckDMARC], checkInheritedDMARC(result)...)
+		advice.DMARC = append(advice.DMARC, a.CheckDMARC(result.DMARC)...)
+		advice.DMARC = append(advice.DMARC, checkDMARCReportAuthorization(result.DMARCReportAuth)...)
+		advice.DMARC = append(advice.DMARC, largeDMARC...)
+		advice.DMARC = append(advice.DMARC, authoritative["dmarc"]...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.DNSSEC = append(failed[scanner.CheckDNSSEC], a.CheckDNSSEC(result.DNSSEC)...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.MTASTS = append(failed[scanner.CheckMTASTS], a.CheckMTASTS(result.MTASTS)...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.MX = append(append(failed[scanner.CheckMX], failed[scanner.CheckTLSA]...), a.CheckMXWithTLSA(result.MX, result.TLSA)...)
+		advice.MX = append(advice.MX, checkMXHosts(result.MXHosts)...)
+		advice.MX = append(advice.MX, authoritative["mx"]...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.SPF = append(failed[scanner.CheckSPF], a.CheckSPFTree(result.SPF, result.SPFTree)...)
+		advice.SPF = append(advice.SPF, largeSPF...)
+		advice.SPF = append(advice.SPF, authoritative["spf"]...)
+		wg.Done()
+	}()
+
+	go func() {
+		advice.TLSRPT = append(failed[scanner.CheckTLSRPT], a.CheckTLSRPT(result.TLSRPT, result.MTASTS)...)
+		wg.Done()
+	}()
+
+	wg.Wait()
+
+	return advice
+}
+
 func (a *Advisor) CheckBIMI(bimi string) (advice []string) {
 	if len(bimi) == 0 {
 		return []string{"We couldn't detect any active BIMI record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
@@ -187,41 +320,32 @@ func (a *Advisor) CheckBIMI(bimi string) (advice []string) {
 	return advice
 }
 
-func (a *Advisor) CheckDKIM(dkim string) (advice []string) {
+// CheckDKIM checks a single DKIM record.
+//
+// Deprecated: use CheckDKIMRecords, which checks the record for every selector
+// found.
+func (a *Advisor) CheckDKIM(dkim string) []string {
 	if dkim == "" {
-		return []string{"We couldn't detect any active DKIM record for your domain. Due to how DKIM works, we only lookup common/known DKIM selectors (such as x, selector1, google). Visit https://dmarcguide.globalcyberalliance.org for more info on how to configure DKIM for your domain."}
+		return a.CheckDKIMRecords(nil)
 	}
 
-	if strings.Contains(dkim, ";") {
-		dkimResult := strings.Split(dkim, ";")
-
-		for index, tag := range dkimResult {
-			tag = strings.TrimSpace(tag)
+	return append(checkDKIMRecord(dkim), dkimOtherSelectors)
+}
 
-			switch index {
-			case 0:
-				if !strings.Contains(tag, "v=DKIM1") {
-					advice = append(advice, "The beginning of your DKIM record should be v=DKIM1 with specific capitalization.")
-				}
-			case 1:
-				if !strings.Contains(tag, "k=rsa") && !strings.Contains(tag, "a=rsa-sha256") {
-					advice = append(advice, "The second tag in your DKIM record must be k=rsa or a=rsa=sha256.")
-				}
-			case 2:
-				if !strings.Contains(tag, "p=") {
-					advice = append(advice, "The third tag in your DKIM record must be p=YOUR_KEY.")
-				}
-			}
-		}
-	} else {
-		advice = append(advice, "Your DKIM record appears to be malformed as no semicolons seem to be present.")
+// CheckDKIMRecords checks the DKIM record found for each selector.
+func (a *Advisor) CheckDKIMRecords(dkim []*scanner.DKIMRecord) (advice []string) {
+	if len(dkim) == 0 {
+		return []string{"We couldn't detect any active DKIM record for your domain. Due to how DKIM works, we only lookup common/known DKIM selectors (such as x, selector1, google). Visit https://dmarcguide.globalcyberalliance.org for more info on how to configure DKIM for your domain."}
 	}
 
-	if len(advice) == 0 {
-		return []string{"DKIM is setup for this email server. However, if you have other 3rd party systems, please send a test email to confirm DKIM is setup properly."}
+	for _, record := range dkim {
+		// prepend the selector to the advice line
+		for _, selectorAdvice := range checkDKIMRecord(record.Record) {
+			advice = append(advice, record.Selector+": "+selectorAdvice)
+		}
 	}
 
-	return advice
+	return append(advice, dkimOtherSelectors)
 }
 
 func (a *Advisor) CheckDMARC(record string) (advice []string) {
@@ -288,6 +412,32 @@ func (a *Advisor) CheckDMARC(record string) (advice []string) {
 			if dmarcRecord.SubdomainPolicy != "none" && dmarcRecord.SubdomainPolicy != "quarantine" && dmarcRecord.SubdomainPolicy != "reject" {
 				dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid subdomain policy specified, the record must be sp=none/sp=quarantine/sp=reject.")
 			}
+		case "np":
+			dmarcRecord.NonExistentPolicy = value
+
+			if dmarcRecord.NonExistentPolicy != "none" && dmarcRecord.NonExistentPolicy != "quarantine" && dmarcRecord.NonExistentPolicy != "reject" {
+				dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid non-existent subdomain policy specified, the record must be np=none/np=quarantine/np=reject.")
+			}
+		case "psd":
+			dmarcRecord.PublicSuffix = value
+
+			switch dmarcRecord.PublicSuffix {
+			case "y":
+				dmarcRecord.Advice = append(dmarcRecord.Advice, "Your DMARC record is published for a public suffix domain (psd=y), so it only applies to domains beneath it which don't publish their own DMARC record. If this isn't a public suffix, please remove the psd tag.")
+			case "n", "u":
+			default:
+				dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid public suffix domain flag specified, the record must be psd=y/psd=n/psd=u.")
+			}
+		case "t":
+			dmarcRecord.Testing = value
+
+			switch dmarcRecord.Testing {
+			case "y":
+				dmarcRecord.Advice = append(dmarcRecord.Advice, "Your DMARC policy is in testing mode (t=y), so receivers will apply the next less strict policy (reject becomes quarantine, and quarantine becomes none). Please remove the t tag once you're confident in your policy.")
+			case "n":
+			default:
+				dmarcRecord.Advice = append(dmarcRecord.Advice, "Invalid testing flag specified, the record must be t=y/t=n.")
+			}
 		case "pct":
 			pct, err := strconv.Atoi(value)
 			if err != nil || pct < 0 || pct > 100 {
@@ -357,9 +507,96 @@ func (a *Advisor) CheckDMARC(record string) (advice []string) {
 		dmarcRecord.Advice = append(dmarcRecord.Advice, "Subdomain policy isn't specified, they'll default to the main policy instead.")
 	}
 
+	// non-existent subdomains fall back to the subdomain policy, then the main policy
+	if dmarcRecord.NonExistentPolicy == "none" && (dmarcRecord.Policy != "none" || dmarcRecord.SubdomainPolicy != "none" && dmarcRecord.SubdomainPolicy != "") {
+		dmarcRecord.Advice = append(dmarcRecord.Advice, "Your non-existent subdomain policy (np=none) is weaker than your other policies, so mail spoofing subdomains that don't exist won't be blocked. Please set np=reject, or remove the np tag.")
+	}
+
 	return dmarcRecord.Advice
 }
 
+// checkInheritedDMARC explains where a domain's DMARC policy comes from, when
+// it doesn't publish its own record, and which of the record's policy tags
+// applies to it.
+func checkInheritedDMARC(result *scanner.Result) (advice []string) {
+	if result.DMARCInheritedFrom == "" {
+		return nil
+	}
+
+	policy := "the policy of " + result.DMARCInheritedFrom
+	switch result.DMARCPolicyTag {
+	case "np":
+		return []string{"Your domain doesn't exist, so receivers use the np= (non-existent subdomain) policy of " + result.DMARCInheritedFrom + " for any mail claiming to be from it."}
+	case "sp":
+		policy = "the sp= (subdomain) policy of " + result.DMARCInheritedFrom
+	}
+
+	// records published by public suffix operators (psd=y) are a last resort for domains without a policy of their own
+	for _, tag := range strings.Split(result.DMARC, ";") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(tag), "="); ok && strings.TrimSpace(name) == "psd" && strings.TrimSpace(value) == "y" {
+			return []string{"Neither your domain nor its organizational domain (" + result.DMARCOrgDomain + ") publishes a DMARC record, so receivers use " + policy + ", which is published by a public suffix operator. Please publish a DMARC record for " + result.DMARCOrgDomain + ", so that you control your own policy."}
+		}
+	}
+
+	return []string{"Your domain doesn't publish its own DMARC record, so receivers use " + policy + " instead. If you'd like a different policy for this domain, please publish a DMARC record for it."}
+}
+
+// checkDMARCReportAuthorization reports whether each external DMARC report
+// destination has authorized the domain to send it reports.
+func checkDMARCReportAuthorization(authorizations []*scanner.DMARCReportAuthorization) (advice []string) {
+	for _, authorization := range authorizations {
+		if authorization.Authorized {
+			advice = append(advice, "Your external report destination "+authorization.Destination+" has authorized your domain to send it reports.")
+			continue
+		}
+
+		advice = append(advice, "Your external report destination "+authorization.Destination+" hasn't authorized your domain to send it reports, so receivers won't send them. Please ask "+authorization.Domain+" to publish a \"v=DMARC1\" TXT record at "+authorization.Name+".")
+	}
+
+	return advice
+}
+
+func (a *Advisor) CheckDNSSEC(dnssec *scanner.DNSSECResult) (advice []string) {
+	// the DNSSEC check was skipped
+	if dnssec == nil {
+		return nil
+	}
+
+	if !dnssec.Signed {
+		advice = append(advice, "Your domain is not signed with DNSSEC, so an attacker who can tamper with DNS responses could forge your mail records. Please ask your DNS provider about enabling DNSSEC.")
+	}
+
+	for _, record := range []struct {
+		name   string
+		status scanner.DNSSECStatus
+	}{
+		{"BIMI", dnssec.BIMI},
+		{"DKIM", dnssec.DKIM},
+		{"DMARC", dnssec.DMARC},
+		{"MX", dnssec.MX},
+		{"SPF", dnssec.SPF},
+		{"TLS-RPT", dnssec.TLSRPT},
+	} {
+		switch record.status {
+		case scanner.DNSSECBogus:
+			advice = append(advice, "Your "+record.name+" record failed DNSSEC validation, so validating resolvers will refuse to use it. Please check that your zone's signatures haven't expired, and that the DS records at your registrar match your DNSKEY records.")
+		case scanner.DNSSECIndeterminate:
+			advice = append(advice, "We couldn't retrieve the DNSSEC records needed to validate your "+record.name+" record.")
+		case scanner.DNSSECInsecure:
+			// an unsigned zone has already been reported
+			if dnssec.Signed {
+				advice = append(advice, "Your "+record.name+" record is not protected by DNSSEC, even though your domain is signed. This usually means the record is hosted in (or points to) an unsigned zone.")
+			}
+		}
+	}
+
+	if len(advice) == 0 {
+		return []string{"DNSSEC is setup correctly! No further action needed."}
+	}
+
+	return advice
+}
+
 func (a *Advisor) CheckDomain(domain string) (advice []string) {
 	a.consumerDomainsMutex.Lock()
 	if _, ok := a.consumerDomains[domain]; ok {
@@ -373,13 +610,58 @@ func (a *Advisor) CheckDomain(domain string) (advice []string) {
 	}
 
 	if len(advice) == 0 {
-		return []string{"Your domain looks good! No further action needed."}
+		return []string{domainLooksGood}
 	}
 
 	return advice
 }
 
-func (a *Advisor) CheckMX(mx []string) (advice []string) {
+func (a *Advisor) CheckMTASTS(mtasts *scanner.MTASTSResult) (advice []string) {
+	if mtasts == nil {
+		return []string{"We couldn't detect an MTA-STS record for your domain. MTA-STS lets you require that mail sent to your domain is encrypted with a valid TLS certificate, protecting it from interception."}
+	}
+
+	for _, problem := range mtasts.Errors {
+		advice = append(advice, "There is a problem with your MTA-STS setup: "+problem+".")
+	}
+
+	if mtasts.Policy == nil {
+		return advice
+	}
+
+	switch mtasts.Policy.Mode {
+	case "testing":
+		advice = append(advice, "Your MTA-STS policy is in testing mode, so senders will still deliver mail over unencrypted or untrusted connections. Once your TLS reports show no failures, switch your policy to enforce mode.")
+	case "none":
+		advice = append(advice, "Your MTA-STS policy's mode is none, which tells senders to stop applying any policy they previously cached.")
+	}
+
+	for _, mx := range mtasts.UnmatchedMX {
+		advice = append(advice, "Your mail server "+strings.TrimSuffix(mx, ".")+" doesn't match any mx pattern in your MTA-STS policy, so senders enforcing the policy will refuse to deliver mail to it.")
+	}
+
+	if mtasts.Policy.Mode != "none" && mtasts.Policy.MaxAge < mtastsMinMaxAge {
+		advice = append(advice, "Your MTA-STS policy's max_age is less than a day. Senders can only protect mail while the policy is cached, so a max_age of several weeks is recommended.")
+	}
+
+	if len(advice) == 0 {
+		return []string{"MTA-STS is setup correctly! No further action needed."}
+	}
+
+	return advice
+}
+
+// CheckMX checks a domain's mail servers.
+//
+// Deprecated: use CheckMXWithTLSA, which also checks the mail servers' TLSA
+// records.
+func (a *Advisor) CheckMX(mx []string) []string {
+	return a.CheckMXWithTLSA(mx, nil)
+}
+
+// CheckMXWithTLSA checks a domain's mail servers, along with the TLSA records
+// published for them.
+func (a *Advisor) CheckMXWithTLSA(mx []string, tlsa []*scanner.TLSAResult) (advice []string) {
 	switch len(mx) {
 	case 0:
 		return []string{"You do not have any mail servers setup, so you cannot receive email at this domain."}
@@ -389,10 +671,26 @@ func (a *Advisor) CheckMX(mx []string) (advice []string) {
 		advice = []string{"You have multiple mail servers setup, which is recommended."}
 	}
 
+	tlsaByHost := make(map[string]*scanner.TLSAResult)
+	for _, records := range tlsa {
+		tlsaByHost[records.Host] = records
+
+		// senders only trust TLSA records which are validated with DNSSEC
+		switch records.DNSSEC {
+		case scanner.DNSSECSecure:
+		case scanner.DNSSECBogus:
+			advice = append(advice, strings.TrimSuffix(records.Host, ".")+": Your TLSA records failed DNSSEC validation, so senders using DANE will defer delivery to this server.")
+		case scanner.DNSSECIndeterminate:
+			advice = append(advice, strings.TrimSuffix(records.Host, ".")+": We couldn't determine whether your TLSA records are protected by DNSSEC.")
+		default:
+			advice = append(advice, strings.TrimSuffix(records.Host, ".")+": Your TLSA records are published without DNSSEC, so senders will ignore them. DANE requires the zone hosting your TLSA records to be signed.")
+		}
+	}
+
 	if a.checkTLS {
 		for _, serverAddress := range mx {
 			// prepend the hostname to the advice line
-			mxAdvice := a.checkMailTls(serverAddress)
+			mxAdvice := a.checkMailTls(serverAddress, tlsaByHost[serverAddress])
 			for _, serverAdvice := range mxAdvice {
 				// strip the trailing dot from DNS records
 				advice = append(advice, serverAddress[:len(serverAddress)-1]+": "+serverAdvice)
@@ -422,20 +720,130 @@ func (a *Advisor) CheckMX(mx []string) (advice []string) {
 	return advice
 }
 
+// checkMXHosts flags mail servers which senders can't, or shouldn't, deliver
+// mail to.
+func checkMXHosts(hosts []*scanner.MXHost) (advice []string) {
+	for _, host := range hosts {
+		hostname := strings.TrimSuffix(host.Host, ".")
+
+		switch {
+		case host.IPLiteral:
+			advice = append(advice, hostname+": Your MX record points at an IP address rather than a hostname, so senders won't deliver mail to it. Please point it at a hostname with A/AAAA records instead.")
+		case host.Unresolvable:
+			advice = append(advice, hostname+": Your mail server's hostname doesn't resolve to any addresses, so senders can't deliver mail to it. If it's no longer in use, please remove the MX record, as a dangling hostname could be taken over by someone else.")
+		case host.CNAME != "":
+			advice = append(advice, hostname+": Your MX record points at a CNAME (for "+strings.TrimSuffix(host.CNAME, ".")+"), which isn't allowed (RFC 2181). Some senders won't deliver mail to it, so please point it directly at the mail server's hostname.")
+		}
+
+		if len(host.ReservedAddresses) > 0 {
+			advice = append(advice, hostname+": Your mail server resolves to private or reserved addresses ("+strings.Join(host.ReservedAddresses, ", ")+"), which can't be reached from the internet.")
+		}
+	}
+
+	return advice
+}
+
+// CheckSPF checks a domain's SPF record.
+//
+// Deprecated: use CheckSPFTree, which also checks the record's includes and
+// redirects, as found by the scanner.
 func (a *Advisor) CheckSPF(spf string) []string {
+	return a.CheckSPFTree(spf, nil)
+}
+
+// CheckSPFTree checks a domain's SPF record, along with the errors and lookups
+// found while expanding its includes and redirects.
+func (a *Advisor) CheckSPFTree(spf string, tree *scanner.SPFTree) (advice []string) {
+	if tree != nil {
+		for _, permError := range tree.PermErrors {
+			advice = append(advice, "Your SPF record will fail to evaluate (permerror), so receivers will treat your mail as if it has no SPF record: "+permError+".")
+		}
+
+		for _, tempError := range tree.TempErrors {
+			advice = append(advice, "Your SPF record couldn't be fully evaluated (temperror), as a DNS lookup failed: "+tempError+". If this keeps happening, receivers may defer or reject your mail.")
+		}
+	}
+
 	if spf == "" {
+		if len(advice) > 0 {
+			return advice
+		}
+
 		return []string{"We couldn't detect any active SPF record for your domain. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
 	}
 
+	if tree != nil && len(tree.PermErrors) == 0 && tree.Lookups >= spfLookupWarning {
+		advice = append(advice, "Your SPF record uses "+strconv.Itoa(tree.Lookups)+" of the 10 DNS lookups allowed. Adding another include could cause it to fail, so consider flattening it or removing unused includes.")
+	}
+
 	if strings.Contains(spf, "all") {
 		if strings.Contains(spf, "+all") {
-			return []string{"Your SPF record contains the +all tag. It is strongly recommended that this be changed to either -all or ~all. The +all tag allows for any system regardless of SPF to send mail on the organization’s behalf."}
+			return append(advice, "Your SPF record contains the +all tag. It is strongly recommended that this be changed to either -all or ~all. The +all tag allows for any system regardless of SPF to send mail on the organization’s behalf.")
 		}
-	} else {
-		return []string{"Your SPF record is missing the all tag. Please visit https://dmarcguide.globalcyberalliance.org to fix this."}
+	} else if !strings.Contains(spf, "redirect=") {
+		return append(advice, "Your SPF record is missing the all tag. Please visit https://dmarcguide.globalcyberalliance.org to fix this.")
+	}
+
+	if len(advice) == 0 {
+		return []string{"SPF seems to be setup correctly! No further action needed."}
+	}
+
+	return advice
+}
+
+func (a *Advisor) CheckTLSRPT(tlsrpt string, mtasts *scanner.MTASTSResult) (advice []string) {
+	if tlsrpt == "" {
+		if mtasts != nil {
+			return []string{"You have published an MTA-STS policy, but no TLS-RPT record. Without TLS-RPT, you won't be told when senders fail to deliver mail to you because of your MTA-STS policy or DANE records. Please publish a TLS-RPT record at _smtp._tls.<your domain>."}
+		}
+
+		return []string{"We couldn't detect a TLS-RPT record for your domain. TLS-RPT lets senders report problems establishing encrypted connections to your mail servers, which is essential when using MTA-STS or DANE."}
+	}
+
+	tags := strings.Split(tlsrpt, ";")
+	if strings.TrimSpace(tags[0]) != "v=TLSRPTv1" {
+		advice = append(advice, "The beginning of your TLS-RPT record should be v=TLSRPTv1 with specific capitalization.")
+	}
+
+	var destinations []string
+
+	for _, tag := range tags[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(tag), "=")
+		if key == "rua" {
+			destinations = append(destinations, strings.Split(value, ",")...)
+		}
+	}
+
+	if len(destinations) == 0 {
+		advice = append(advice, "Your TLS-RPT record is missing the rua tag, so senders have nowhere to send their reports.")
 	}
 
-	return []string{"SPF seems to be setup correctly! No further action needed."}
+	for _, destination := range destinations {
+		destination = strings.TrimSpace(destination)
+
+		switch {
+		case strings.HasPrefix(destination, "mailto:"):
+			if !validateEmail(strings.TrimPrefix(destination, "mailto:")) {
+				advice = append(advice, "Your TLS-RPT report destination "+destination+" is not a valid email address.")
+			}
+		case strings.HasPrefix(destination, "https://"):
+			if parsed, err := url.Parse(destination); err != nil || parsed.Host == "" {
+				advice = append(advice, "Your TLS-RPT report destination "+destination+" is not a valid URL.")
+			}
+		default:
+			advice = append(advice, "Your TLS-RPT report destination "+destination+" must be either a mailto: or https: URI.")
+		}
+	}
+
+	if len(advice) == 0 {
+		if mtasts == nil {
+			return []string{"Your TLS-RPT record looks good! Reports are most useful alongside an MTA-STS policy or DANE records, which tell senders to require encryption when delivering to you."}
+		}
+
+		return []string{"Your TLS-RPT record looks good! No further action needed."}
+	}
+
+	return advice
 }
 
 func (a *Advisor) checkHostTLS(hostname string, port int) (advice []string) {
@@ -485,21 +893,24 @@ func (a *Advisor) checkHostTLS(hostname string, port int) (advice []string) {
 	return advice
 }
 
-func (a *Advisor) checkMailTls(hostname string) (advice []string) {
+func (a *Advisor) checkMailTls(hostname string, tlsa *scanner.TLSAResult) (advice []string) {
 	// strip the trailing dot from DNS records
 	if string(hostname[len(hostname)-1]) == "." {
 		hostname = hostname[:len(hostname)-1]
 	}
 
+	// the DANE advice depends on the TLSA records, so the advice is cached for each set of them
+	cacheKey := hostname + "|" + tlsaCacheKey(tlsa)
+
 	// check if the advice is already in the cache
-	tlsAdvice := a.tlsCacheMail.Get(hostname)
+	tlsAdvice := a.tlsCacheMail.Get(cacheKey)
 	if tlsAdvice != nil {
 		return *tlsAdvice
 	}
 
 	// set the advice in the cache after the function returns
 	defer func() {
-		a.tlsCacheMail.Set(hostname, &advice)
+		a.tlsCacheMail.Set(cacheKey, &advice)
 	}()
 
 	conn, err := a.dialer.Dial("tcp", hostname+":25")
@@ -527,18 +938,20 @@ func (a *Advisor) checkMailTls(hostname string) (advice []string) {
 		ServerName:         hostname,
 	}
 
+	untrusted := false
+
 	if err = client.StartTLS(tlsConfig); err != nil {
 		if strings.Contains(err.Error(), "certificate is not trusted") || strings.Contains(err.Error(), "failed to verify certificate") {
-			advice = append(advice, "No valid certificate could be found.")
+			untrusted = true
 
 			// close the existing connection and create a new one as we can't reuse it in the same way as the checkHostTLS function
 			if err = conn.Close(); err != nil {
 				// fill variable to satisfy deferred cache fill
-				advice = append(advice, "Failed to re-attempt connection without certificate verification")
+				advice = append(advice, "No valid certificate could be found.", "Failed to re-attempt connection without certificate verification")
 				return advice
 			}
 
-			conn, err = a.dialer.Dial("tcp", hostname+"25")
+			conn, err = a.dialer.Dial("tcp", hostname+":25")
 			if err != nil {
 				// fill variable to satisfy deferred cache fill
 				advice = []string{"Failed to reach domain"}
@@ -557,7 +970,7 @@ func (a *Advisor) checkMailTls(hostname string) (advice []string) {
 			tlsConfig.InsecureSkipVerify = true
 			if err = client.StartTLS(tlsConfig); err != nil {
 				// fill variable to satisfy deferred cache fill
-				advice = append(advice, "Failed to start TLS connection")
+				advice = append(advice, "No valid certificate could be found.", "Failed to start TLS connection")
 				return advice
 			}
 		} else {
@@ -567,10 +980,27 @@ func (a *Advisor) checkMailTls(hostname string) (advice []string) {
 		}
 	}
 
-	if state, ok := client.TLSConnectionState(); ok {
-		advice = append(advice, checkTLSVersion(state.Version))
+	state, ok := client.TLSConnectionState()
+	if !ok {
+		return advice
+	}
+
+	var daneAdvice []string
+	daneMatched := false
+
+	// TLSA records are only used by senders when they're validated with DNSSEC
+	if tlsa != nil && tlsa.DNSSEC == scanner.DNSSECSecure {
+		daneAdvice, daneMatched = checkDANE(hostname, state.PeerCertificates, tlsa.Records)
+	}
+
+	// a matching TLSA record authenticates the server, even if its certificate isn't publicly trusted
+	if untrusted && !daneMatched {
+		advice = append(advice, "No valid certificate could be found.")
 	}
 
+	advice = append(advice, checkTLSVersion(state.Version))
+	advice = append(advice, daneAdvice...)
+
 	return advice
 }
 
@@ -2,10 +2,43 @@ package advisor
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+	"github.com/stretchr/testify/assert"
 )
 
+func TestAdvisor_CheckDKIMRecords(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("PerSelector", func(t *testing.T) {
+		expectedAdvice := []string{
+			"google: Your DKIM public key couldn't be decoded: it isn't a valid RSA key. Please make sure the p= tag contains the full, base64-encoded key.",
+			"selector1: Your DKIM key has been revoked (empty p= tag), so any signatures using this selector will fail. If you no longer use this selector, you can remove the record.",
+			"If you have other 3rd party systems, please send a test email to confirm DKIM is setup properly for them, as we can only check known selectors.",
+		}
+
+		advice := advisor.CheckDKIMRecords([]*scanner.DKIMRecord{
+			{Selector: "google", Record: "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"},
+			{Selector: "selector1", Record: "v=DKIM1; p=", CNAMETarget: "selector1._domainkey.example.net."},
+		})
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		advice := advisor.CheckDKIMRecords(nil)
+
+		if len(advice) != 1 || !strings.HasPrefix(advice[0], "We couldn't detect any active DKIM record") {
+			t.Errorf("found %v, want the missing DKIM advice", advice)
+		}
+	})
+}
+
 func TestAdvisor_CheckDMARC(t *testing.T) {
 	advisor := NewAdvisor(time.Second, time.Second, false)
 
@@ -67,6 +100,34 @@ func TestAdvisor_CheckDMARC(t *testing.T) {
 		}
 	})
 
+	t.Run("DMARCbisTags", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your DMARC record is published for a public suffix domain (psd=y), so it only applies to domains beneath it which don't publish their own DMARC record. If this isn't a public suffix, please remove the psd tag.",
+			"Your DMARC policy is in testing mode (t=y), so receivers will apply the next less strict policy (reject becomes quarantine, and quarantine becomes none). Please remove the t tag once you're confident in your policy.",
+			"Your non-existent subdomain policy (np=none) is weaker than your other policies, so mail spoofing subdomains that don't exist won't be blocked. Please set np=reject, or remove the np tag.",
+		}
+
+		advice := advisor.CheckDMARC("v=DMARC1; p=reject; sp=reject; np=none; psd=y; t=y; fo=1; rua=mailto:dmarc@example.com; ruf=mailto:dmarc@example.com;")
+
+		for _, expected := range expectedAdvice {
+			assert.Contains(t, advice, expected)
+		}
+	})
+
+	t.Run("InvalidDMARCbisTags", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Invalid non-existent subdomain policy specified, the record must be np=none/np=quarantine/np=reject.",
+			"Invalid public suffix domain flag specified, the record must be psd=y/psd=n/psd=u.",
+			"Invalid testing flag specified, the record must be t=y/t=n.",
+		}
+
+		advice := advisor.CheckDMARC("v=DMARC1; p=reject; np=random; psd=random; t=random;")
+
+		for _, expected := range expectedAdvice {
+			assert.Contains(t, advice, expected)
+		}
+	})
+
 	t.Run("InvalidPercentage", func(t *testing.T) {
 		expectedAdvice := "Invalid report percentage specified, it must be between 0 and 100."
 		advice := advisor.CheckDMARC("v=DMARC1; p=none; fo=1; pct=101;")
@@ -227,3 +288,415 @@ func TestAdvisor_CheckDMARC(t *testing.T) {
 		}
 	})
 }
+
+func TestAdvisor_CheckInheritedDMARC(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		result         *scanner.Result
+		expectedAdvice []string
+	}{
+		{
+			name:   "Own",
+			result: &scanner.Result{DMARC: "v=DMARC1; p=reject;", DMARCOrgDomain: "example.com", DMARCPolicyTag: "p"},
+		},
+		{
+			name:   "Subdomain",
+			result: &scanner.Result{DMARC: "v=DMARC1; p=reject; sp=quarantine;", DMARCInheritedFrom: "example.com", DMARCOrgDomain: "example.com", DMARCPolicyTag: "sp"},
+			expectedAdvice: []string{
+				"Your domain doesn't publish its own DMARC record, so receivers use the sp= (subdomain) policy of example.com instead. If you'd like a different policy for this domain, please publish a DMARC record for it.",
+			},
+		},
+		{
+			name:   "NonExistent",
+			result: &scanner.Result{DMARC: "v=DMARC1; p=reject; np=reject;", DMARCInheritedFrom: "example.com", DMARCOrgDomain: "example.com", DMARCPolicyTag: "np"},
+			expectedAdvice: []string{
+				"Your domain doesn't exist, so receivers use the np= (non-existent subdomain) policy of example.com for any mail claiming to be from it.",
+			},
+		},
+		{
+			name:   "PublicSuffix",
+			result: &scanner.Result{DMARC: "v=DMARC1; p=reject; psd=y;", DMARCInheritedFrom: "co.uk", DMARCOrgDomain: "example.co.uk", DMARCPolicyTag: "p"},
+			expectedAdvice: []string{
+				"Neither your domain nor its organizational domain (example.co.uk) publishes a DMARC record, so receivers use the policy of co.uk, which is published by a public suffix operator. Please publish a DMARC record for example.co.uk, so that you control your own policy.",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			advice := checkInheritedDMARC(test.result)
+
+			if !reflect.DeepEqual(advice, test.expectedAdvice) {
+				t.Errorf("found %v, want %v", advice, test.expectedAdvice)
+			}
+		})
+	}
+}
+
+func TestAdvisor_CheckDMARCReportAuthorization(t *testing.T) {
+	expectedAdvice := []string{
+		"Your external report destination mailto:dmarc@reports.example.net has authorized your domain to send it reports.",
+		"Your external report destination mailto:dmarc@example.org hasn't authorized your domain to send it reports, so receivers won't send them. Please ask example.org to publish a \"v=DMARC1\" TXT record at example.com._report._dmarc.example.org.",
+	}
+
+	advice := checkDMARCReportAuthorization([]*scanner.DMARCReportAuthorization{
+		{Destination: "mailto:dmarc@reports.example.net", Domain: "reports.example.net", Name: "example.com._report._dmarc.reports.example.net", Authorized: true, Record: "v=DMARC1"},
+		{Destination: "mailto:dmarc@example.org", Domain: "example.org", Name: "example.com._report._dmarc.example.org"},
+	})
+
+	if !reflect.DeepEqual(advice, expectedAdvice) {
+		t.Errorf("found %v, want %v", advice, expectedAdvice)
+	}
+}
+
+func TestAdvisor_CheckAll(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	advice := advisor.CheckAll("example.com", "", "", "v=DMARC1; p=reject;", []string{"mail.example.com."}, "v=spf1 -all")
+
+	expectedAdvice := &Advice{
+		Domain: advisor.CheckDomain("example.com"),
+		BIMI:   advisor.CheckBIMI(""),
+		DKIM:   advisor.CheckDKIM(""),
+		DMARC:  advisor.CheckDMARC("v=DMARC1; p=reject;"),
+		MX:     advisor.CheckMX([]string{"mail.example.com."}),
+		SPF:    advisor.CheckSPF("v=spf1 -all"),
+	}
+
+	if !reflect.DeepEqual(advice, expectedAdvice) {
+		t.Errorf("found %v, want %v", advice, expectedAdvice)
+	}
+}
+
+func TestAdvisor_CheckResultDMARCReportAuthorization(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	advice := advisor.CheckResult(&scanner.Result{
+		Domain: "example.com",
+		DMARC:  "v=DMARC1; p=reject; rua=mailto:dmarc@example.org;",
+		DMARCReportAuth: []*scanner.DMARCReportAuthorization{
+			{Destination: "mailto:dmarc@example.org", Domain: "example.org", Name: "example.com._report._dmarc.example.org"},
+		},
+	})
+
+	assert.Contains(t, advice.DMARC, "Your external report destination mailto:dmarc@example.org hasn't authorized your domain to send it reports, so receivers won't send them. Please ask example.org to publish a \"v=DMARC1\" TXT record at example.com._report._dmarc.example.org.")
+}
+
+func TestAdvisor_CheckDNSSEC(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("Skipped", func(t *testing.T) {
+		if advice := advisor.CheckDNSSEC(nil); advice != nil {
+			t.Errorf("found %v, want no advice", advice)
+		}
+	})
+
+	t.Run("Secure", func(t *testing.T) {
+		expectedAdvice := []string{
+			"DNSSEC is setup correctly! No further action needed.",
+		}
+
+		advice := advisor.CheckDNSSEC(&scanner.DNSSECResult{Signed: true, DMARC: scanner.DNSSECSecure, SPF: scanner.DNSSECSecure})
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your domain is not signed with DNSSEC, so an attacker who can tamper with DNS responses could forge your mail records. Please ask your DNS provider about enabling DNSSEC.",
+		}
+
+		advice := advisor.CheckDNSSEC(&scanner.DNSSECResult{DMARC: scanner.DNSSECInsecure, SPF: scanner.DNSSECInsecure})
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your DKIM record is not protected by DNSSEC, even though your domain is signed. This usually means the record is hosted in (or points to) an unsigned zone.",
+			"We couldn't retrieve the DNSSEC records needed to validate your MX record.",
+			"Your SPF record failed DNSSEC validation, so validating resolvers will refuse to use it. Please check that your zone's signatures haven't expired, and that the DS records at your registrar match your DNSKEY records.",
+		}
+
+		advice := advisor.CheckDNSSEC(&scanner.DNSSECResult{
+			Signed: true,
+			DKIM:   scanner.DNSSECInsecure,
+			DMARC:  scanner.DNSSECSecure,
+			MX:     scanner.DNSSECIndeterminate,
+			SPF:    scanner.DNSSECBogus,
+		})
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+}
+
+func TestAdvisor_CheckMTASTS(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	enforce := &scanner.MTASTSPolicy{Version: "STSv1", Mode: "enforce", MX: []string{"*.example.com"}, MaxAge: 604800}
+
+	for _, test := range []struct {
+		name           string
+		mtasts         *scanner.MTASTSResult
+		expectedAdvice []string
+	}{
+		{
+			name:   "Valid",
+			mtasts: &scanner.MTASTSResult{Record: "v=STSv1; id=1;", ID: "1", Policy: enforce},
+			expectedAdvice: []string{
+				"MTA-STS is setup correctly! No further action needed.",
+			},
+		},
+		{
+			name: "Missing",
+			expectedAdvice: []string{
+				"We couldn't detect an MTA-STS record for your domain. MTA-STS lets you require that mail sent to your domain is encrypted with a valid TLS certificate, protecting it from interception.",
+			},
+		},
+		{
+			name:   "Errors",
+			mtasts: &scanner.MTASTSResult{Record: "v=STSv1; id=1;", ID: "1", Errors: []string{"policy request returned HTTP 404"}},
+			expectedAdvice: []string{
+				"There is a problem with your MTA-STS setup: policy request returned HTTP 404.",
+			},
+		},
+		{
+			name:   "Testing",
+			mtasts: &scanner.MTASTSResult{Policy: &scanner.MTASTSPolicy{Version: "STSv1", Mode: "testing", MX: []string{"*.example.com"}, MaxAge: 604800}},
+			expectedAdvice: []string{
+				"Your MTA-STS policy is in testing mode, so senders will still deliver mail over unencrypted or untrusted connections. Once your TLS reports show no failures, switch your policy to enforce mode.",
+			},
+		},
+		{
+			// a policy with mode none is being withdrawn, so its max_age doesn't matter
+			name:   "None",
+			mtasts: &scanner.MTASTSResult{Policy: &scanner.MTASTSPolicy{Version: "STSv1", Mode: "none", MaxAge: 60}},
+			expectedAdvice: []string{
+				"Your MTA-STS policy's mode is none, which tells senders to stop applying any policy they previously cached.",
+			},
+		},
+		{
+			name:   "ShortMaxAge",
+			mtasts: &scanner.MTASTSResult{Policy: &scanner.MTASTSPolicy{Version: "STSv1", Mode: "enforce", MX: []string{"*.example.com"}, MaxAge: 3600}},
+			expectedAdvice: []string{
+				"Your MTA-STS policy's max_age is less than a day. Senders can only protect mail while the policy is cached, so a max_age of several weeks is recommended.",
+			},
+		},
+		{
+			name:   "UnmatchedMX",
+			mtasts: &scanner.MTASTSResult{Policy: enforce, UnmatchedMX: []string{"mail.example.net."}},
+			expectedAdvice: []string{
+				"Your mail server mail.example.net doesn't match any mx pattern in your MTA-STS policy, so senders enforcing the policy will refuse to deliver mail to it.",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			advice := advisor.CheckMTASTS(test.mtasts)
+
+			if !reflect.DeepEqual(advice, test.expectedAdvice) {
+				t.Errorf("found %v, want %v", advice, test.expectedAdvice)
+			}
+		})
+	}
+}
+
+func TestAdvisor_CheckTLSRPT(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("Valid", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your TLS-RPT record looks good! No further action needed.",
+		}
+
+		advice := advisor.CheckTLSRPT("v=TLSRPTv1; rua=mailto:tlsrpt@example.com,https://reports.example.com/v1/tlsrpt", &scanner.MTASTSResult{})
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("InvalidDestinations", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your TLS-RPT report destination mailto:tlsrpt is not a valid email address.",
+			"Your TLS-RPT report destination http://reports.example.com must be either a mailto: or https: URI.",
+		}
+
+		advice := advisor.CheckTLSRPT("v=TLSRPTv1; rua=mailto:tlsrpt,http://reports.example.com", nil)
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+
+	t.Run("MissingRUA", func(t *testing.T) {
+		expectedAdvice := []string{
+			"The beginning of your TLS-RPT record should be v=TLSRPTv1 with specific capitalization.",
+			"Your TLS-RPT record is missing the rua tag, so senders have nowhere to send their reports.",
+		}
+
+		advice := advisor.CheckTLSRPT("v=tlsrptv1;", nil)
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+}
+
+func TestAdvisor_CheckMXHosts(t *testing.T) {
+	expectedAdvice := []string{
+		"alias.example.com: Your MX record points at a CNAME (for mail.example.net), which isn't allowed (RFC 2181). Some senders won't deliver mail to it, so please point it directly at the mail server's hostname.",
+		"192.0.2.25: Your MX record points at an IP address rather than a hostname, so senders won't deliver mail to it. Please point it at a hostname with A/AAAA records instead.",
+		"192.0.2.25: Your mail server resolves to private or reserved addresses (192.0.2.25), which can't be reached from the internet.",
+		"gone.example.com: Your mail server's hostname doesn't resolve to any addresses, so senders can't deliver mail to it. If it's no longer in use, please remove the MX record, as a dangling hostname could be taken over by someone else.",
+		"internal.example.com: Your mail server resolves to private or reserved addresses (10.0.0.25), which can't be reached from the internet.",
+	}
+
+	advice := checkMXHosts([]*scanner.MXHost{
+		{Host: "mail.example.com.", Preference: 10, Addresses: []string{"8.8.8.8"}},
+		{Host: "alias.example.com.", Preference: 20, Addresses: []string{"1.1.1.1"}, CNAME: "mail.example.net."},
+		{Host: "192.0.2.25.", Preference: 30, Addresses: []string{"192.0.2.25"}, IPLiteral: true, ReservedAddresses: []string{"192.0.2.25"}},
+		{Host: "gone.example.com.", Preference: 40, Unresolvable: true},
+		{Host: "internal.example.com.", Preference: 50, Addresses: []string{"10.0.0.25"}, ReservedAddresses: []string{"10.0.0.25"}},
+	})
+
+	if !reflect.DeepEqual(advice, expectedAdvice) {
+		t.Errorf("found %v, want %v", advice, expectedAdvice)
+	}
+}
+
+func TestAdvisor_CheckSPFTree(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Second, false)
+
+	t.Run("FailedLookup", func(t *testing.T) {
+		expectedAdvice := []string{
+			"Your SPF record couldn't be fully evaluated (temperror), as a DNS lookup failed: include:_spf.example.com: TXT query for _spf.example.com. failed with rcode SERVFAIL. If this keeps happening, receivers may defer or reject your mail.",
+		}
+
+		advice := advisor.CheckSPFTree("v=spf1 include:_spf.example.com -all", &scanner.SPFTree{
+			Lookups:    1,
+			TempErrors: []string{"include:_spf.example.com: TXT query for _spf.example.com. failed with rcode SERVFAIL"},
+		})
+
+		if !reflect.DeepEqual(advice, expectedAdvice) {
+			t.Errorf("found %v, want %v", advice, expectedAdvice)
+		}
+	})
+}
+
+func TestAdvisor_CheckLargeResponses(t *testing.T) {
+	expectedDKIM := []string{
+		"The DKIM record at selector1._domainkey.example.com is 1400 bytes (our query had to fall back to TCP), which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to verify your signatures, so please make sure the selector only publishes one record, and use a 2048-bit key rather than a larger one.",
+	}
+	expectedDMARC := []string{
+		"The TXT records at _dmarc.example.com are 1300 bytes, which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to find your DMARC policy, so please remove any TXT records there other than your DMARC record.",
+	}
+	expectedSPF := []string{
+		"The TXT records at example.com are 2000 bytes (our query had to fall back to TCP), which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to find your SPF record, so please remove any TXT records you no longer need, such as old domain verification tokens.",
+		"The TXT records at _spf.example.net are 1500 bytes, which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to find your SPF record, so please remove any TXT records you no longer need, such as old domain verification tokens.",
+		"The TXT records at verify.example.com are 1600 bytes, which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to look them up, so please remove any TXT records you no longer need, such as old domain verification tokens.",
+	}
+
+	dkim, dmarc, spf := checkLargeResponses([]*scanner.LargeResponse{
+		{Name: "example.com.", Type: "TXT", Size: 2000, TCP: true, SPF: true},
+		{Name: "example.com.", Type: "NS", Size: 1500},
+		{Name: "_spf.example.net.", Type: "TXT", Size: 1500, SPF: true},
+		{Name: "verify.example.com.", Type: "TXT", Size: 1600},
+		{Name: "selector1._domainkey.example.com.", Type: "TXT", Size: 1400, TCP: true},
+		{Name: "_dmarc.example.com.", Type: "TXT", Size: 1300},
+		{Name: "default._bimi.example.com.", Type: "TXT", Size: 1300},
+	})
+
+	if !reflect.DeepEqual(dkim, expectedDKIM) {
+		t.Errorf("found %v, want %v", dkim, expectedDKIM)
+	}
+
+	if !reflect.DeepEqual(dmarc, expectedDMARC) {
+		t.Errorf("found %v, want %v", dmarc, expectedDMARC)
+	}
+
+	if !reflect.DeepEqual(spf, expectedSPF) {
+		t.Errorf("found %v, want %v", spf, expectedSPF)
+	}
+}
+
+func TestAdvisor_CheckLookupErrors(t *testing.T) {
+	expectedAdvice := map[string][]string{
+		"dmarc": {
+			"The TXT lookup for _dmarc.example.com (using 8.8.8.8:53) failed, as the nameserver responded with SERVFAIL, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.",
+		},
+		"mta-sts": {
+			"We ran into an error while checking your domain (policy request returned HTTP 500), so the advice below may be incomplete.",
+		},
+		"spf": {
+			"The TXT lookup for example.com failed, as the query timed out, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.",
+			"The TXT lookup for _spf.example.net (using 1.1.1.1:53) failed, as the nameserver couldn't be reached, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.",
+		},
+	}
+
+	advice := checkLookupErrors([]*scanner.CheckError{
+		{Check: "dmarc", Name: "_dmarc.example.com.", RecordType: "TXT", Class: scanner.QueryErrorRcode, Rcode: "SERVFAIL", Nameserver: "8.8.8.8:53"},
+		{Check: "mta-sts", Message: "policy request returned HTTP 500"},
+		{Check: "spf", Name: "example.com.", RecordType: "TXT", Class: scanner.QueryErrorTimeout},
+		{Check: "spf", Name: "_spf.example.net.", RecordType: "TXT", Class: scanner.QueryErrorNetwork, Nameserver: "1.1.1.1:53"},
+	})
+
+	if !reflect.DeepEqual(advice, expectedAdvice) {
+		t.Errorf("found %v, want %v", advice, expectedAdvice)
+	}
+}
+
+func TestAdvisor_CheckAuthoritative(t *testing.T) {
+	expectedAdvice := map[string][]string{
+		"domain": {
+			"ns2.example.com: This nameserver is serving serial 1 of example.com, while your other nameservers are serving serial 2, so it's likely a secondary which has stopped receiving updates. Resolvers which query it will see outdated records, so please check that zone transfers to it are working.",
+			"ns3.example.com: This nameserver refused our queries for example.com, even though your NS records delegate the zone to it. Please configure it to serve the zone, or remove it from your NS records.",
+			"ns4.example.com: This nameserver doesn't answer authoritatively for example.com (it's lame), even though your NS records delegate the zone to it. Please configure it to serve the zone, or remove it from your NS records.",
+			"ns5.example.com: This nameserver didn't respond to our queries. Resolvers which try it first will time out before trying another nameserver, which can cause receivers to treat your SPF, DKIM and DMARC records as missing. Please fix the nameserver, or remove it from your NS records.",
+		},
+		"dmarc": {
+			`Your nameservers give different answers for the TXT records at _dmarc.example.com (ns1.example.com returned TXT "v=DMARC1; p=reject"; ns2.example.com returned no records). Resolvers pick a nameserver at random, so receivers will see different records from one lookup to the next, which causes intermittent DMARC failures that are hard to track down. Please make sure every nameserver serves the same records.`,
+		},
+		"mx": {
+			"Your nameservers give different answers for the MX records at example.com (ns1.example.com returned MX 10 mx1.example.com.; ns2.example.com returned MX 10 mx2.example.com.). Resolvers pick a nameserver at random, so senders will deliver your mail to different servers from one lookup to the next. Please make sure every nameserver serves the same records.",
+		},
+	}
+
+	advice := checkAuthoritative(&scanner.AuthoritativeResult{
+		Zone: "example.com.",
+		Nameservers: []*scanner.AuthoritativeNameserver{
+			{Host: "ns1.example.com.", Status: scanner.AuthoritativeOK, Serial: 2},
+			{Host: "ns2.example.com.", Status: scanner.AuthoritativeOK, Serial: 1, Stale: true},
+			{Host: "ns3.example.com.", Status: scanner.AuthoritativeRefused},
+			{Host: "ns4.example.com.", Status: scanner.AuthoritativeLame},
+			{Host: "ns5.example.com.", Status: scanner.AuthoritativeUnreachable},
+		},
+		Mismatches: []*scanner.AuthoritativeMismatch{
+			{
+				Check: scanner.CheckDMARC,
+				Name:  "_dmarc.example.com.",
+				Type:  "TXT",
+				Answers: []*scanner.AuthoritativeAnswer{
+					{Nameservers: []string{"ns1.example.com."}, Records: []string{`TXT "v=DMARC1; p=reject"`}},
+					{Nameservers: []string{"ns2.example.com."}},
+				},
+			},
+			{
+				Check: scanner.CheckMX,
+				Name:  "example.com.",
+				Type:  "MX",
+				Answers: []*scanner.AuthoritativeAnswer{
+					{Nameservers: []string{"ns1.example.com."}, Records: []string{"MX 10 mx1.example.com."}},
+					{Nameservers: []string{"ns2.example.com."}, Records: []string{"MX 10 mx2.example.com."}},
+				},
+			},
+		},
+	})
+
+	if !reflect.DeepEqual(advice, expectedAdvice) {
+		t.Errorf("found %v, want %v", advice, expectedAdvice)
+	}
+}
@@ -0,0 +1,71 @@
+package advisor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// checkAuthoritative explains any problems found by querying the domain's
+// authoritative nameservers directly, keyed by the name of the check they
+// affect (with nameserver problems under "domain"). Resolvers pick one of the
+// nameservers at random for each lookup, so a nameserver which is broken or
+// out of date causes failures for only some of the receivers, some of the
+// time, which are easy to miss.
+func checkAuthoritative(result *scanner.AuthoritativeResult) map[string][]string {
+	advice := make(map[string][]string)
+	if result == nil {
+		return advice
+	}
+
+	zone := strings.TrimSuffix(result.Zone, ".")
+
+	var newestSerial uint32
+	for _, nameserver := range result.Nameservers {
+		if nameserver.Status == scanner.AuthoritativeOK && !nameserver.Stale {
+			newestSerial = nameserver.Serial
+		}
+	}
+
+	for _, nameserver := range result.Nameservers {
+		host := strings.TrimSuffix(nameserver.Host, ".")
+
+		switch {
+		case nameserver.Status == scanner.AuthoritativeUnreachable:
+			advice["domain"] = append(advice["domain"], host+": This nameserver didn't respond to our queries. Resolvers which try it first will time out before trying another nameserver, which can cause receivers to treat your SPF, DKIM and DMARC records as missing. Please fix the nameserver, or remove it from your NS records.")
+		case nameserver.Status == scanner.AuthoritativeRefused:
+			advice["domain"] = append(advice["domain"], host+": This nameserver refused our queries for "+zone+", even though your NS records delegate the zone to it. Please configure it to serve the zone, or remove it from your NS records.")
+		case nameserver.Status == scanner.AuthoritativeLame:
+			advice["domain"] = append(advice["domain"], host+": This nameserver doesn't answer authoritatively for "+zone+" (it's lame), even though your NS records delegate the zone to it. Please configure it to serve the zone, or remove it from your NS records.")
+		case nameserver.Stale:
+			advice["domain"] = append(advice["domain"], host+": This nameserver is serving serial "+strconv.FormatUint(uint64(nameserver.Serial), 10)+" of "+zone+", while your other nameservers are serving serial "+strconv.FormatUint(uint64(newestSerial), 10)+", so it's likely a secondary which has stopped receiving updates. Resolvers which query it will see outdated records, so please check that zone transfers to it are working.")
+		}
+	}
+
+	for _, mismatch := range result.Mismatches {
+		var answers []string
+		for _, answer := range mismatch.Answers {
+			var hosts []string
+			for _, host := range answer.Nameservers {
+				hosts = append(hosts, strings.TrimSuffix(host, "."))
+			}
+
+			records := "no records"
+			if len(answer.Records) > 0 {
+				records = strings.Join(answer.Records, ", ")
+			}
+
+			answers = append(answers, strings.Join(hosts, ", ")+" returned "+records)
+		}
+
+		impact := "receivers will see different records from one lookup to the next, which causes intermittent DMARC failures that are hard to track down"
+		if mismatch.Check == scanner.CheckMX {
+			impact = "senders will deliver your mail to different servers from one lookup to the next"
+		}
+
+		advice[mismatch.Check] = append(advice[mismatch.Check], "Your nameservers give different answers for the "+mismatch.Type+" records at "+strings.TrimSuffix(mismatch.Name, ".")+" ("+strings.Join(answers, "; ")+"). Resolvers pick a nameserver at random, so "+impact+". Please make sure every nameserver serves the same records.")
+	}
+
+	return advice
+}
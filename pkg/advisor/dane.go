@@ -0,0 +1,133 @@
+package advisor
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// TLSA certificate usages, selectors and matching types (RFC 6698, section 7).
+const (
+	tlsaUsageDANETA = 2
+	tlsaUsageDANEEE = 3
+
+	tlsaSelectorCertificate = 0
+	tlsaSelectorPublicKey   = 1
+
+	tlsaMatchingFull   = 0
+	tlsaMatchingSHA256 = 1
+	tlsaMatchingSHA512 = 2
+)
+
+// checkDANE validates a mail server's certificate chain against its TLSA
+// records, as described in RFC 7672. It returns the advice, and whether any of
+// the records matched.
+func checkDANE(hostname string, chain []*x509.Certificate, records []scanner.TLSARecord) (advice []string, matched bool) {
+	if len(chain) == 0 {
+		return []string{"No certificate was presented, so your DANE TLSA records couldn't be checked."}, false
+	}
+
+	usable := 0
+
+	for _, record := range records {
+		switch record.Usage {
+		case tlsaUsageDANEEE:
+			usable++
+
+			// DANE-EE records authenticate the server's own certificate, regardless of its issuer or names
+			if tlsaMatches(record, chain[0]) {
+				return []string{"Your certificate matches your DANE-EE TLSA record, no further action needed!"}, true
+			}
+		case tlsaUsageDANETA:
+			usable++
+
+			// DANE-TA records authenticate an issuer, which the server's certificate must chain to
+			for _, issuer := range chain[1:] {
+				if tlsaMatches(record, issuer) && verifyDANETA(hostname, chain, issuer) {
+					return []string{"Your certificate chain matches your DANE-TA TLSA record, no further action needed!"}, true
+				}
+			}
+		}
+	}
+
+	if usable == 0 {
+		return []string{"Your TLSA records only use the PKIX-TA (0) or PKIX-EE (1) usages, which senders ignore for SMTP. Please publish DANE-EE (3) or DANE-TA (2) records instead."}, false
+	}
+
+	return []string{"Your certificate doesn't match any of your TLSA records, so senders using DANE will refuse to deliver mail to this server. If you've recently replaced your certificate, please update your TLSA records."}, false
+}
+
+// tlsaMatches reports whether a certificate matches a TLSA record's selector,
+// matching type and certificate association data.
+func tlsaMatches(record scanner.TLSARecord, certificate *x509.Certificate) bool {
+	var data []byte
+
+	switch record.Selector {
+	case tlsaSelectorCertificate:
+		data = certificate.Raw
+	case tlsaSelectorPublicKey:
+		data = certificate.RawSubjectPublicKeyInfo
+	default:
+		return false
+	}
+
+	switch record.MatchingType {
+	case tlsaMatchingFull:
+	case tlsaMatchingSHA256:
+		digest := sha256.Sum256(data)
+		data = digest[:]
+	case tlsaMatchingSHA512:
+		digest := sha512.Sum512(data)
+		data = digest[:]
+	default:
+		return false
+	}
+
+	return hex.EncodeToString(data) == strings.ToLower(record.Certificate)
+}
+
+// verifyDANETA reports whether the server's certificate chains to a trust
+// anchor from a DANE-TA record, and is valid for the server's hostname.
+func verifyDANETA(hostname string, chain []*x509.Certificate, trustAnchor *x509.Certificate) bool {
+	roots := x509.NewCertPool()
+	roots.AddCert(trustAnchor)
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range chain[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Intermediates: intermediates,
+		Roots:         roots,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	return err == nil
+}
+
+// tlsaCacheKey returns a digest of the TLSA records a mail server's
+// certificate will be matched against, so that cached TLS advice is only
+// reused for the same records. It's empty if the records won't be used.
+func tlsaCacheKey(tlsa *scanner.TLSAResult) string {
+	if tlsa == nil || tlsa.DNSSEC != scanner.DNSSECSecure {
+		return ""
+	}
+
+	records := make([]string, 0, len(tlsa.Records))
+	for _, record := range tlsa.Records {
+		records = append(records, fmt.Sprintf("%d %d %d %s", record.Usage, record.Selector, record.MatchingType, strings.ToLower(record.Certificate)))
+	}
+
+	slices.Sort(records)
+	digest := sha256.Sum256([]byte(strings.Join(records, "\n")))
+
+	return hex.EncodeToString(digest[:])
+}
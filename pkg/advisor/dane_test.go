@@ -0,0 +1,170 @@
+package advisor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// newTestChain returns a leaf certificate for mail.example.com, issued by a
+// newly generated CA.
+func newTestChain(t *testing.T) []*x509.Certificate {
+	t.Helper()
+
+	newCertificate := func(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+
+		raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return certificate, key
+	}
+
+	ca, caKey := newCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Example CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	leaf, _ := newCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "mail.example.com"},
+		DNSNames:     []string{"mail.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	return []*x509.Certificate{leaf, ca}
+}
+
+func TestAdvisor_CheckDANE(t *testing.T) {
+	chain := newTestChain(t)
+
+	leafKeyDigest := sha256.Sum256(chain[0].RawSubjectPublicKeyInfo)
+	leafKeyRecord := scanner.TLSARecord{Usage: 3, Selector: 1, MatchingType: 1, Certificate: hex.EncodeToString(leafKeyDigest[:])}
+	caRecord := scanner.TLSARecord{Usage: 2, Selector: 0, MatchingType: 0, Certificate: hex.EncodeToString(chain[1].Raw)}
+
+	testCases := []struct {
+		name           string
+		hostname       string
+		records        []scanner.TLSARecord
+		expectedAdvice []string
+		expectedMatch  bool
+	}{
+		{
+			name:           "DANE-EE",
+			hostname:       "mail.example.com",
+			records:        []scanner.TLSARecord{leafKeyRecord},
+			expectedAdvice: []string{"Your certificate matches your DANE-EE TLSA record, no further action needed!"},
+			expectedMatch:  true,
+		},
+		{
+			name:           "DANE-TA",
+			hostname:       "mail.example.com",
+			records:        []scanner.TLSARecord{caRecord},
+			expectedAdvice: []string{"Your certificate chain matches your DANE-TA TLSA record, no further action needed!"},
+			expectedMatch:  true,
+		},
+		{
+			name:           "DANE-TAWrongName",
+			hostname:       "mx.example.net",
+			records:        []scanner.TLSARecord{caRecord},
+			expectedAdvice: []string{"Your certificate doesn't match any of your TLSA records, so senders using DANE will refuse to deliver mail to this server. If you've recently replaced your certificate, please update your TLSA records."},
+		},
+		{
+			name:           "Mismatch",
+			hostname:       "mail.example.com",
+			records:        []scanner.TLSARecord{{Usage: 3, Selector: 1, MatchingType: 1, Certificate: "00"}},
+			expectedAdvice: []string{"Your certificate doesn't match any of your TLSA records, so senders using DANE will refuse to deliver mail to this server. If you've recently replaced your certificate, please update your TLSA records."},
+		},
+		{
+			name:           "PKIXOnly",
+			hostname:       "mail.example.com",
+			records:        []scanner.TLSARecord{{Usage: 1, Selector: 1, MatchingType: 1, Certificate: leafKeyRecord.Certificate}},
+			expectedAdvice: []string{"Your TLSA records only use the PKIX-TA (0) or PKIX-EE (1) usages, which senders ignore for SMTP. Please publish DANE-EE (3) or DANE-TA (2) records instead."},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			advice, matched := checkDANE(testCase.hostname, chain, testCase.records)
+
+			if !reflect.DeepEqual(advice, testCase.expectedAdvice) {
+				t.Errorf("found %v, want %v", advice, testCase.expectedAdvice)
+			}
+
+			if matched != testCase.expectedMatch {
+				t.Errorf("found match %v, want %v", matched, testCase.expectedMatch)
+			}
+		})
+	}
+}
+
+func TestTLSACacheKey(t *testing.T) {
+	first := scanner.TLSARecord{Usage: 3, Selector: 1, MatchingType: 1, Certificate: "0b8d"}
+	second := scanner.TLSARecord{Usage: 2, Selector: 0, MatchingType: 1, Certificate: "a7f3"}
+
+	key := tlsaCacheKey(&scanner.TLSAResult{Records: []scanner.TLSARecord{first, second}, DNSSEC: scanner.DNSSECSecure})
+
+	if reordered := tlsaCacheKey(&scanner.TLSAResult{Records: []scanner.TLSARecord{second, first}, DNSSEC: scanner.DNSSECSecure}); reordered != key {
+		t.Errorf("found %v for the same records in a different order, want %v", reordered, key)
+	}
+
+	if changed := tlsaCacheKey(&scanner.TLSAResult{Records: []scanner.TLSARecord{first}, DNSSEC: scanner.DNSSECSecure}); changed == key {
+		t.Errorf("found the same key %v for different records", changed)
+	}
+
+	// records which aren't validated with DNSSEC aren't used, so they don't affect the advice
+	for _, tlsa := range []*scanner.TLSAResult{nil, {Records: []scanner.TLSARecord{first}, DNSSEC: scanner.DNSSECInsecure}} {
+		if unused := tlsaCacheKey(tlsa); unused != "" {
+			t.Errorf("found %v, want an empty key", unused)
+		}
+	}
+}
+
+func TestAdvisor_CheckMailTLSCache(t *testing.T) {
+	advisor := NewAdvisor(time.Second, time.Minute, true)
+
+	tlsa := &scanner.TLSAResult{Records: []scanner.TLSARecord{{Usage: 3, Selector: 1, MatchingType: 1, Certificate: "0b8d"}}, DNSSEC: scanner.DNSSECSecure}
+
+	cached := []string{"cached advice"}
+	advisor.tlsCacheMail.Set("mail.invalid|"+tlsaCacheKey(tlsa), &cached)
+
+	if advice := advisor.checkMailTls("mail.invalid.", tlsa); !reflect.DeepEqual(advice, cached) {
+		t.Errorf("found %v, want %v", advice, cached)
+	}
+
+	// the cached advice was for different TLSA records, so the server has to be checked again
+	if advice := advisor.checkMailTls("mail.invalid.", nil); reflect.DeepEqual(advice, cached) {
+		t.Errorf("found the cached advice %v for different TLSA records", advice)
+	}
+}
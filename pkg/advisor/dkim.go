@@ -0,0 +1,191 @@
+package advisor
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RSA key sizes below which DKIM keys are considered broken or weak (RFC 8301,
+// section 3.2).
+const (
+	dkimRSABrokenBits = 1024
+	dkimRSAWeakBits   = 2048
+)
+
+// dkimKey is the public key published in a DKIM record.
+type dkimKey struct {
+	Type string
+	Bits int
+}
+
+// checkDKIMRecord parses a single DKIM record (RFC 6376, section 3.6.1) and
+// checks its tags and public key.
+func checkDKIMRecord(record string) (advice []string) {
+	tags, err := parseDKIMTags(record)
+	if err != nil {
+		return []string{"Your DKIM record appears to be malformed: " + err.Error() + "."}
+	}
+
+	if version, ok := tags["v"]; ok && (version != "DKIM1" || !strings.HasPrefix(strings.TrimSpace(record), "v=")) {
+		advice = append(advice, "The beginning of your DKIM record should be v=DKIM1 with specific capitalization.")
+	}
+
+	if flags, ok := tags["t"]; ok {
+		for _, flag := range splitDKIMList(flags) {
+			switch flag {
+			case "y":
+				advice = append(advice, "Your DKIM record is in testing mode (t=y), so receivers may treat signed mail as unsigned. Please remove the flag once you've confirmed DKIM is working.")
+			case "s":
+				advice = append(advice, "Your DKIM record sets t=s, so it can't be used to sign mail from subdomains. Please make sure none of your senders use a subdomain in their signatures.")
+			}
+		}
+	}
+
+	if hashes, ok := tags["h"]; ok {
+		algorithms := splitDKIMList(hashes)
+
+		if !slices.Contains(algorithms, "sha256") {
+			advice = append(advice, "Your DKIM record's h= tag doesn't allow sha256, so receivers will reject modern signatures. Please remove the h= tag or add sha256 to it.")
+		} else if slices.Contains(algorithms, "sha1") {
+			advice = append(advice, "Your DKIM record's h= tag allows sha1, which is no longer secure. Please restrict it to sha256.")
+		}
+	}
+
+	if services, ok := tags["s"]; ok {
+		types := splitDKIMList(services)
+
+		if !slices.Contains(types, "*") && !slices.Contains(types, "email") {
+			advice = append(advice, "Your DKIM record's s= tag doesn't include email, so receivers won't use this key for email. Please remove the s= tag or set it to s=email.")
+		}
+	}
+
+	keyType := "rsa"
+	if value, ok := tags["k"]; ok {
+		keyType = value
+	}
+
+	publicKey, ok := tags["p"]
+	if !ok {
+		return append(advice, "Your DKIM record is missing the p= tag, which must contain your public key.")
+	}
+
+	if publicKey == "" {
+		return append(advice, "Your DKIM key has been revoked (empty p= tag), so any signatures using this selector will fail. If you no longer use this selector, you can remove the record.")
+	}
+
+	key, err := parseDKIMKey(keyType, publicKey)
+	if err != nil {
+		return append(advice, "Your DKIM public key couldn't be decoded: "+err.Error()+". Please make sure the p= tag contains the full, base64-encoded key.")
+	}
+
+	switch {
+	case key.Type == "rsa" && key.Bits < dkimRSABrokenBits:
+		advice = append(advice, fmt.Sprintf("Your DKIM key is only %d bits, which is broken and must be ignored by receivers. Please replace it with a 2048-bit RSA key.", key.Bits))
+	case key.Type == "rsa" && key.Bits < dkimRSAWeakBits:
+		advice = append(advice, fmt.Sprintf("Your DKIM key is only %d bits, which is considered weak. Please replace it with a 2048-bit RSA key.", key.Bits))
+	case len(advice) == 0 && key.Type == "rsa":
+		advice = append(advice, fmt.Sprintf("DKIM is setup for this selector with a %d-bit RSA key.", key.Bits))
+	case len(advice) == 0:
+		advice = append(advice, "DKIM is setup for this selector with an Ed25519 key. Please make sure you also sign with an RSA key, as not all receivers support Ed25519.")
+	}
+
+	return advice
+}
+
+// parseDKIMTags parses a DKIM tag-list (RFC 6376, section 3.2) into a map of
+// tag names to values. Whitespace is removed from values, as it's only used to
+// wrap long values such as keys.
+func parseDKIMTags(record string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	for _, spec := range strings.Split(record, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("the tag %q is missing a value", strings.TrimSpace(spec))
+		}
+
+		name = strings.TrimSpace(name)
+		if !isDKIMTagName(name) {
+			return nil, fmt.Errorf("%q is not a valid tag name", name)
+		}
+
+		if _, ok = tags[name]; ok {
+			return nil, fmt.Errorf("the %s= tag is specified more than once", name)
+		}
+
+		tags[name] = strings.Join(strings.Fields(value), "")
+	}
+
+	return tags, nil
+}
+
+// isDKIMTagName reports whether the name is a valid tag name (ALPHA *ALNUMPUNC).
+func isDKIMTagName(name string) bool {
+	for index, char := range name {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z':
+		case index > 0 && (char >= '0' && char <= '9' || char == '_'):
+		default:
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// parseDKIMKey decodes the public key from a DKIM record's p= tag.
+func parseDKIMKey(keyType, publicKey string) (*dkimKey, error) {
+	data, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, errors.New("it isn't valid base64")
+	}
+
+	switch keyType {
+	case "rsa":
+		// keys should be a SubjectPublicKeyInfo, but some providers publish a bare RSAPublicKey
+		if parsed, err := x509.ParsePKIXPublicKey(data); err == nil {
+			rsaKey, ok := parsed.(*rsa.PublicKey)
+			if !ok {
+				return nil, errors.New("it isn't an RSA key, despite k=rsa")
+			}
+
+			return &dkimKey{Type: keyType, Bits: rsaKey.N.BitLen()}, nil
+		}
+
+		rsaKey, err := x509.ParsePKCS1PublicKey(data)
+		if err != nil {
+			return nil, errors.New("it isn't a valid RSA key")
+		}
+
+		return &dkimKey{Type: keyType, Bits: rsaKey.N.BitLen()}, nil
+	case "ed25519":
+		// Ed25519 keys are published as the raw key (RFC 8463, section 4.2)
+		if len(data) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("it's %d bytes, but Ed25519 keys must be %d bytes", len(data), ed25519.PublicKeySize)
+		}
+
+		return &dkimKey{Type: keyType, Bits: ed25519.PublicKeySize * 8}, nil
+	default:
+		return nil, fmt.Errorf("the key type k=%s isn't supported", keyType)
+	}
+}
+
+// splitDKIMList splits a colon-separated DKIM tag value.
+func splitDKIMList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ":") {
+		items = append(items, strings.TrimSpace(item))
+	}
+
+	return items
+}
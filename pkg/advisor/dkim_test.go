@@ -0,0 +1,122 @@
+package advisor
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// newTestRSAKey returns a base64-encoded RSA public key of the given size. The
+// modulus isn't a real one, as only its size matters.
+func newTestRSAKey(t *testing.T, bits int) string {
+	t.Helper()
+
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+	modulus.SetBit(modulus, 0, 1)
+
+	raw, err := x509.MarshalPKIXPublicKey(&rsa.PublicKey{N: modulus, E: 65537})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestAdvisor_CheckDKIMRecord(t *testing.T) {
+	rsa2048 := newTestRSAKey(t, 2048)
+	ed25519Key := base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize))
+
+	testCases := []struct {
+		name           string
+		record         string
+		expectedAdvice []string
+	}{
+		{
+			name:           "RSA2048",
+			record:         "v=DKIM1; k=rsa; p=" + rsa2048,
+			expectedAdvice: []string{"DKIM is setup for this selector with a 2048-bit RSA key."},
+		},
+		{
+			name:           "TagOrder",
+			record:         "v=DKIM1; p=" + rsa2048[:40] + " " + rsa2048[40:] + "; s=email; k=rsa; h=sha256",
+			expectedAdvice: []string{"DKIM is setup for this selector with a 2048-bit RSA key."},
+		},
+		{
+			name:           "PKCS1",
+			record:         "v=DKIM1; p=" + base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047), E: 65537})),
+			expectedAdvice: []string{"DKIM is setup for this selector with a 2048-bit RSA key."},
+		},
+		{
+			name:           "Ed25519",
+			record:         "v=DKIM1; k=ed25519; p=" + ed25519Key,
+			expectedAdvice: []string{"DKIM is setup for this selector with an Ed25519 key. Please make sure you also sign with an RSA key, as not all receivers support Ed25519."},
+		},
+		{
+			name:           "Broken",
+			record:         "v=DKIM1; k=rsa; p=" + newTestRSAKey(t, 512),
+			expectedAdvice: []string{"Your DKIM key is only 512 bits, which is broken and must be ignored by receivers. Please replace it with a 2048-bit RSA key."},
+		},
+		{
+			name:           "Weak",
+			record:         "v=DKIM1; k=rsa; p=" + newTestRSAKey(t, 1024),
+			expectedAdvice: []string{"Your DKIM key is only 1024 bits, which is considered weak. Please replace it with a 2048-bit RSA key."},
+		},
+		{
+			name:           "Revoked",
+			record:         "v=DKIM1; k=rsa; p=",
+			expectedAdvice: []string{"Your DKIM key has been revoked (empty p= tag), so any signatures using this selector will fail. If you no longer use this selector, you can remove the record."},
+		},
+		{
+			name:   "Flags",
+			record: "v=DKIM1; t=y:s; p=" + rsa2048,
+			expectedAdvice: []string{
+				"Your DKIM record is in testing mode (t=y), so receivers may treat signed mail as unsigned. Please remove the flag once you've confirmed DKIM is working.",
+				"Your DKIM record sets t=s, so it can't be used to sign mail from subdomains. Please make sure none of your senders use a subdomain in their signatures.",
+			},
+		},
+		{
+			name:   "Restrictive",
+			record: "v=DKIM1; h=sha1; s=tlsrpt; p=" + rsa2048,
+			expectedAdvice: []string{
+				"Your DKIM record's h= tag doesn't allow sha256, so receivers will reject modern signatures. Please remove the h= tag or add sha256 to it.",
+				"Your DKIM record's s= tag doesn't include email, so receivers won't use this key for email. Please remove the s= tag or set it to s=email.",
+			},
+		},
+		{
+			name:           "Undecodable",
+			record:         "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC",
+			expectedAdvice: []string{"Your DKIM public key couldn't be decoded: it isn't valid base64. Please make sure the p= tag contains the full, base64-encoded key."},
+		},
+		{
+			name:           "WrongKeyType",
+			record:         "v=DKIM1; k=ed25519; p=" + rsa2048,
+			expectedAdvice: []string{"Your DKIM public key couldn't be decoded: it's 294 bytes, but Ed25519 keys must be 32 bytes. Please make sure the p= tag contains the full, base64-encoded key."},
+		},
+		{
+			name:           "DuplicateTag",
+			record:         "v=DKIM1; p=; p=" + rsa2048,
+			expectedAdvice: []string{"Your DKIM record appears to be malformed: the p= tag is specified more than once."},
+		},
+		{
+			name:   "VersionNotFirst",
+			record: "k=rsa; v=DKIM1; p=" + rsa2048,
+			expectedAdvice: []string{
+				"The beginning of your DKIM record should be v=DKIM1 with specific capitalization.",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			advice := checkDKIMRecord(testCase.record)
+
+			if !reflect.DeepEqual(advice, testCase.expectedAdvice) {
+				t.Errorf("found %v, want %v", advice, testCase.expectedAdvice)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package advisor
+
+import (
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// checkLookupErrors explains each check's failed lookups, keyed by the name of
+// the check. A failed lookup means the record may still exist, so the rest of
+// the advice for that check may be wrong.
+func checkLookupErrors(errs []*scanner.CheckError) map[string][]string {
+	advice := make(map[string][]string)
+
+	for _, checkErr := range errs {
+		var reason string
+
+		switch checkErr.Class {
+		case scanner.QueryErrorCancelled:
+			reason = "the scan was cancelled"
+		case scanner.QueryErrorNetwork:
+			reason = "the nameserver couldn't be reached"
+		case scanner.QueryErrorRcode:
+			reason = "the nameserver responded with " + checkErr.Rcode
+		case scanner.QueryErrorTimeout:
+			reason = "the query timed out"
+		default:
+			advice[checkErr.Check] = append(advice[checkErr.Check], "We ran into an error while checking your domain ("+checkErr.Message+"), so the advice below may be incomplete.")
+			continue
+		}
+
+		lookup := checkErr.RecordType + " lookup for " + strings.TrimSuffix(checkErr.Name, ".")
+		if checkErr.Nameserver != "" {
+			lookup += " (using " + checkErr.Nameserver + ")"
+		}
+
+		advice[checkErr.Check] = append(advice[checkErr.Check], "The "+lookup+" failed, as "+reason+", so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.")
+	}
+
+	return advice
+}
@@ -0,0 +1,120 @@
+package advisor
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// checkParked checks a domain which doesn't send or receive mail against the
+// parked domain profile, which replaces the usual DKIM, DMARC, MX and SPF
+// advice. BIMI, MTA-STS, TLSA and TLS-RPT aren't relevant to parked domains,
+// so only their failed lookups are reported. As with CheckResult, failed
+// lookups are explained first.
+func (a *Advisor) checkParked(result *scanner.Result, failed map[string][]string) *Advice {
+	advice := &Advice{
+		Domain: a.CheckDomain(result.Domain),
+		BIMI:   failed[scanner.CheckBIMI],
+		DKIM:   append(failed[scanner.CheckDKIM], checkParkedDKIM(result.DKIMWildcard, result.DKIMRecords)...),
+		DMARC:  append(failed[scanner.CheckDMARC], checkParkedDMARC(result.DMARC)...),
+		DNSSEC: append(failed[scanner.CheckDNSSEC], a.CheckDNSSEC(result.DNSSEC)...),
+		MTASTS: failed[scanner.CheckMTASTS],
+		MX:     append(append(failed[scanner.CheckMX], failed[scanner.CheckTLSA]...), checkParkedMX(result.MX, result.NullMX)...),
+		SPF:    append(failed[scanner.CheckSPF], checkParkedSPF(result.SPF)...),
+		TLSRPT: failed[scanner.CheckTLSRPT],
+	}
+
+	if problems := failed[scanner.CheckAuthoritative]; len(problems) > 0 {
+		advice.Domain = append(problems, slices.DeleteFunc(advice.Domain, func(advice string) bool {
+			return advice == domainLooksGood
+		})...)
+	}
+
+	return advice
+}
+
+// checkParkedDKIM checks that every DKIM selector is revoked, with a wildcard
+// record of "v=DKIM1; p=" at *._domainkey.
+func checkParkedDKIM(wildcard string, dkim []*scanner.DKIMRecord) (advice []string) {
+	if wildcard == "" {
+		advice = append(advice, "As your domain doesn't send mail, please publish \"v=DKIM1; p=\" at *._domainkey to revoke every DKIM selector, so receivers reject any mail claiming to be signed by your domain.")
+	} else if tags, err := parseDKIMTags(wildcard); err != nil || tags["p"] != "" {
+		advice = append(advice, "Your wildcard DKIM record at *._domainkey doesn't revoke your selectors. As your domain doesn't send mail, please change it to \"v=DKIM1; p=\".")
+	}
+
+	// selectors published explicitly take precedence over the wildcard
+	for _, record := range dkim {
+		if tags, err := parseDKIMTags(record.Record); err == nil && tags["p"] == "" {
+			continue
+		}
+
+		advice = append(advice, record.Selector+": This selector still publishes a DKIM key, which could be used to sign mail on your domain's behalf. As your domain doesn't send mail, please remove it.")
+	}
+
+	if len(advice) == 0 {
+		return []string{"Every DKIM selector is revoked for your domain, so receivers will reject any mail claiming to be signed by it. No further action needed!"}
+	}
+
+	return advice
+}
+
+// checkParkedDMARC checks that the DMARC policy rejects all mail from the
+// domain, and its subdomains.
+func checkParkedDMARC(dmarc string) []string {
+	if dmarc == "" {
+		return []string{"As your domain doesn't send mail, please publish \"v=DMARC1; p=reject;\" at _dmarc, so receivers reject any mail claiming to be from it."}
+	}
+
+	var policy, subdomainPolicy string
+
+	for _, tag := range strings.Split(dmarc, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(tag), "=")
+
+		switch strings.TrimSpace(key) {
+		case "p":
+			policy = strings.TrimSpace(value)
+		case "sp":
+			subdomainPolicy = strings.TrimSpace(value)
+		}
+	}
+
+	if policy != "reject" {
+		return []string{"As your domain doesn't send mail, your DMARC policy should be p=reject, so receivers reject any mail claiming to be from it."}
+	}
+
+	if subdomainPolicy != "" && subdomainPolicy != "reject" {
+		return []string{"Your DMARC subdomain policy isn't sp=reject, so mail claiming to be from your subdomains won't be rejected. Please set sp=reject, or remove the sp tag."}
+	}
+
+	return []string{"Your DMARC policy rejects all mail claiming to be from your domain. No further action needed!"}
+}
+
+// checkParkedMX checks that the domain publishes a null MX record, so senders
+// know not to deliver mail to it.
+func checkParkedMX(mx []string, nullMX bool) []string {
+	switch {
+	case nullMX:
+		return []string{"Your domain publishes a null MX record, so senders know it doesn't accept mail. No further action needed!"}
+	case slices.Contains(mx, "."):
+		return []string{"Your null MX record must be the only MX record for your domain, otherwise senders will ignore it. Please remove your other MX records."}
+	case len(mx) == 0:
+		return []string{"Your domain doesn't publish any MX records, so senders may try to deliver mail to its A/AAAA records instead. Please publish a null MX record (\"0 .\") so senders know it doesn't accept mail."}
+	default:
+		return []string{"Your domain still publishes mail servers. As it doesn't receive mail, please replace them with a null MX record (\"0 .\")."}
+	}
+}
+
+// checkParkedSPF checks that the SPF record doesn't authorize any servers to
+// send mail.
+func checkParkedSPF(spf string) []string {
+	if spf == "" {
+		return []string{"As your domain doesn't send mail, please publish \"v=spf1 -all\" as its SPF record, so receivers reject any mail claiming to be from it."}
+	}
+
+	if !slices.Equal(strings.Fields(strings.ToLower(spf)), []string{"v=spf1", "-all"}) {
+		return []string{"As your domain doesn't send mail, your SPF record should be \"v=spf1 -all\", which doesn't authorize any servers to send mail for it."}
+	}
+
+	return []string{"Your SPF record doesn't authorize any servers to send mail for your domain. No further action needed!"}
+}
@@ -0,0 +1,137 @@
+package advisor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+func TestAdvisor_CheckParked(t *testing.T) {
+	testCases := []struct {
+		name           string
+		parked         bool
+		result         *scanner.Result
+		expectedAdvice *Advice
+	}{
+		{
+			name: "NullMX",
+			result: &scanner.Result{
+				Domain:       "example.com",
+				DKIMRecords:  []*scanner.DKIMRecord{{Selector: "google", Record: "v=DKIM1; p="}},
+				DKIMWildcard: "v=DKIM1; p=",
+				DMARC:        "v=DMARC1; p=reject;",
+				MX:           []string{"."},
+				NullMX:       true,
+				SPF:          "v=spf1 -all",
+			},
+			expectedAdvice: &Advice{
+				Domain: []string{"Your domain looks good! No further action needed."},
+				DKIM:   []string{"Every DKIM selector is revoked for your domain, so receivers will reject any mail claiming to be signed by it. No further action needed!"},
+				DMARC:  []string{"Your DMARC policy rejects all mail claiming to be from your domain. No further action needed!"},
+				MX:     []string{"Your domain publishes a null MX record, so senders know it doesn't accept mail. No further action needed!"},
+				SPF:    []string{"Your SPF record doesn't authorize any servers to send mail for your domain. No further action needed!"},
+			},
+		},
+		{
+			name:   "Override",
+			parked: true,
+			result: &scanner.Result{
+				Domain:      "example.com",
+				DKIMRecords: []*scanner.DKIMRecord{{Selector: "google", Record: "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"}},
+				DMARC:       "v=DMARC1; p=reject; sp=none;",
+				MX:          []string{"mail.example.com."},
+				SPF:         "v=spf1 include:_spf.example.com -all",
+			},
+			expectedAdvice: &Advice{
+				Domain: []string{"Your domain looks good! No further action needed."},
+				DKIM: []string{
+					"As your domain doesn't send mail, please publish \"v=DKIM1; p=\" at *._domainkey to revoke every DKIM selector, so receivers reject any mail claiming to be signed by your domain.",
+					"google: This selector still publishes a DKIM key, which could be used to sign mail on your domain's behalf. As your domain doesn't send mail, please remove it.",
+				},
+				DMARC: []string{"Your DMARC subdomain policy isn't sp=reject, so mail claiming to be from your subdomains won't be rejected. Please set sp=reject, or remove the sp tag."},
+				MX:    []string{"Your domain still publishes mail servers. As it doesn't receive mail, please replace them with a null MX record (\"0 .\")."},
+				SPF:   []string{"As your domain doesn't send mail, your SPF record should be \"v=spf1 -all\", which doesn't authorize any servers to send mail for it."},
+			},
+		},
+		{
+			name:   "Missing",
+			parked: true,
+			result: &scanner.Result{
+				Domain:       "example.com",
+				DKIMWildcard: "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA",
+			},
+			expectedAdvice: &Advice{
+				Domain: []string{"Your domain looks good! No further action needed."},
+				DKIM:   []string{"Your wildcard DKIM record at *._domainkey doesn't revoke your selectors. As your domain doesn't send mail, please change it to \"v=DKIM1; p=\"."},
+				DMARC:  []string{"As your domain doesn't send mail, please publish \"v=DMARC1; p=reject;\" at _dmarc, so receivers reject any mail claiming to be from it."},
+				MX:     []string{"Your domain doesn't publish any MX records, so senders may try to deliver mail to its A/AAAA records instead. Please publish a null MX record (\"0 .\") so senders know it doesn't accept mail."},
+				SPF:    []string{"As your domain doesn't send mail, please publish \"v=spf1 -all\" as its SPF record, so receivers reject any mail claiming to be from it."},
+			},
+		},
+		{
+			name:   "LookupErrors",
+			parked: true,
+			result: &scanner.Result{
+				Domain: "example.com",
+				DMARC:  "v=DMARC1; p=reject;",
+				SPF:    "v=spf1 -all",
+				Errors: []*scanner.CheckError{
+					{Check: "dkim", Class: scanner.QueryErrorTimeout, Name: "*._domainkey.example.com.", RecordType: "TXT"},
+					{Check: "mx", Class: scanner.QueryErrorRcode, Rcode: "SERVFAIL", Name: "example.com.", RecordType: "MX"},
+				},
+			},
+			expectedAdvice: &Advice{
+				Domain: []string{"Your domain looks good! No further action needed."},
+				DKIM: []string{
+					"The TXT lookup for *._domainkey.example.com failed, as the query timed out, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.",
+					"As your domain doesn't send mail, please publish \"v=DKIM1; p=\" at *._domainkey to revoke every DKIM selector, so receivers reject any mail claiming to be signed by your domain.",
+				},
+				DMARC: []string{"Your DMARC policy rejects all mail claiming to be from your domain. No further action needed!"},
+				MX: []string{
+					"The MX lookup for example.com failed, as the nameserver responded with SERVFAIL, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.",
+					"Your domain doesn't publish any MX records, so senders may try to deliver mail to its A/AAAA records instead. Please publish a null MX record (\"0 .\") so senders know it doesn't accept mail.",
+				},
+				SPF: []string{"Your SPF record doesn't authorize any servers to send mail for your domain. No further action needed!"},
+			},
+		},
+		{
+			name: "ParkedResult",
+			result: &scanner.Result{
+				Domain:       "example.com",
+				DKIMWildcard: "v=DKIM1; p=",
+				DMARC:        "v=DMARC1; p=reject;",
+				Parked:       true,
+				SPF:          "v=spf1 -all",
+				Errors: []*scanner.CheckError{
+					{Check: "bimi", Class: scanner.QueryErrorTimeout, Name: "default._bimi.example.com.", RecordType: "TXT"},
+					{Check: "mta-sts", Class: scanner.QueryErrorTimeout, Name: "_mta-sts.example.com.", RecordType: "TXT"},
+					{Check: "tlsa", Class: scanner.QueryErrorRcode, Rcode: "SERVFAIL", Name: "_25._tcp.mail.example.com.", RecordType: "TLSA"},
+				},
+			},
+			expectedAdvice: &Advice{
+				Domain: []string{"Your domain looks good! No further action needed."},
+				BIMI:   []string{"The TXT lookup for default._bimi.example.com failed, as the query timed out, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later."},
+				DKIM:   []string{"Every DKIM selector is revoked for your domain, so receivers will reject any mail claiming to be signed by it. No further action needed!"},
+				DMARC:  []string{"Your DMARC policy rejects all mail claiming to be from your domain. No further action needed!"},
+				MTASTS: []string{"The TXT lookup for _mta-sts.example.com failed, as the query timed out, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later."},
+				MX: []string{
+					"The TLSA lookup for _25._tcp.mail.example.com failed, as the nameserver responded with SERVFAIL, so we couldn't tell whether the record exists. The advice below may be incomplete, so please try again later.",
+					"Your domain doesn't publish any MX records, so senders may try to deliver mail to its A/AAAA records instead. Please publish a null MX record (\"0 .\") so senders know it doesn't accept mail.",
+				},
+				SPF: []string{"Your SPF record doesn't authorize any servers to send mail for your domain. No further action needed!"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			advice := NewAdvisor(time.Second, time.Second, false).CheckResult(testCase.result, WithParked(testCase.parked))
+
+			if !reflect.DeepEqual(advice, testCase.expectedAdvice) {
+				t.Errorf("found %+v, want %+v", advice, testCase.expectedAdvice)
+			}
+		})
+	}
+}
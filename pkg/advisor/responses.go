@@ -0,0 +1,43 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
+)
+
+// checkLargeResponses warns about DKIM, DMARC and SPF records whose DNS
+// responses are too large to be sent reliably over UDP. Resolvers have to
+// retry those queries over TCP, which some receivers can't do, so they may
+// treat the records as missing.
+func checkLargeResponses(responses []*scanner.LargeResponse) (dkim, dmarc, spf []string) {
+	for _, response := range responses {
+		if response.Type != "TXT" {
+			continue
+		}
+
+		name := strings.TrimSuffix(response.Name, ".")
+
+		size := fmt.Sprintf("%d bytes", response.Size)
+		if response.TCP {
+			size += " (our query had to fall back to TCP)"
+		}
+
+		switch {
+		case strings.Contains(name, "._domainkey."):
+			dkim = append(dkim, "The DKIM record at "+name+" is "+size+", which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to verify your signatures, so please make sure the selector only publishes one record, and use a 2048-bit key rather than a larger one.")
+		case strings.HasPrefix(name, "_dmarc.") || strings.Contains(name, "._dmarc."):
+			dmarc = append(dmarc, "The TXT records at "+name+" are "+size+", which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to find your DMARC policy, so please remove any TXT records there other than your DMARC record.")
+		case strings.Contains(name, "._bimi."), strings.HasPrefix(name, "_mta-sts."), strings.HasPrefix(name, "_smtp._tls."):
+			// BIMI, MTA-STS and TLS-RPT records aren't needed to authenticate mail
+		case response.SPF:
+			spf = append(spf, "The TXT records at "+name+" are "+size+", which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to find your SPF record, so please remove any TXT records you no longer need, such as old domain verification tokens.")
+		default:
+			// the name is looked up by the SPF check (such as the domain itself), but has no SPF record
+			spf = append(spf, "The TXT records at "+name+" are "+size+", which is too large to be sent reliably over UDP. Receivers which can't retry over TCP may fail to look them up, so please remove any TXT records you no longer need, such as old domain verification tokens.")
+		}
+	}
+
+	return dkim, dmarc, spf
+}
@@ -10,6 +10,10 @@ type (
 		cache map[string]*cacheEntry[T]
 		mutex *sync.Mutex
 		ttl   time.Duration
+
+		// done stops the cleanup goroutine once it's closed.
+		done      chan struct{}
+		closeOnce *sync.Once
 	}
 
 	cacheEntry[T any] struct {
@@ -23,6 +27,9 @@ func New[T any](ttl time.Duration) *Cache[T] {
 		cache: make(map[string]*cacheEntry[T]),
 		mutex: &sync.Mutex{},
 		ttl:   ttl,
+
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
 	}
 
 	go c.cleanup()
@@ -45,6 +52,16 @@ func (c *Cache[T]) Get(key string) *T {
 	return nil
 }
 
+// Close stops the cache's cleanup goroutine, and flushes it. It's safe to call
+// more than once.
+func (c *Cache[T]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
+	c.Flush()
+}
+
 func (c *Cache[T]) Flush() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -52,6 +69,11 @@ func (c *Cache[T]) Flush() {
 }
 
 func (c *Cache[T]) Set(key string, value *T) {
+	// a TTL of 0 disables caching
+	if c.ttl <= 0 {
+		return
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -62,8 +84,20 @@ func (c *Cache[T]) Set(key string, value *T) {
 }
 
 func (c *Cache[T]) cleanup() {
+	// nothing is cached, so there's nothing to clean up (and sleeping for 0 would spin)
+	if c.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(c.ttl)
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
 
 		c.mutex.Lock()
 		for key, entry := range c.cache {
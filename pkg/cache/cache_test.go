@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("Expiry", func(t *testing.T) {
+		cache := New[string](50 * time.Millisecond)
+
+		value := "value"
+		cache.Set("key", &value)
+		require.Equal(t, &value, cache.Get("key"))
+
+		time.Sleep(100 * time.Millisecond)
+		require.Nil(t, cache.Get("key"))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		cache := New[string](time.Hour)
+
+		value := "value"
+		cache.Set("key", &value)
+
+		// run a second cleanup, to see that it exits once the cache is closed
+		stopped := make(chan struct{})
+		go func() {
+			cache.cleanup()
+			close(stopped)
+		}()
+
+		cache.Close()
+		cache.Close()
+		require.Nil(t, cache.Get("key"))
+
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("cleanup didn't stop after the cache was closed")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		cache := New[string](0)
+
+		value := "value"
+		cache.Set("key", &value)
+		require.Nil(t, cache.Get("key"))
+
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+
+		require.Empty(t, cache.cache)
+	})
+}
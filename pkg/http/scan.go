@@ -12,8 +12,11 @@ import (
 
 func (s *Server) registerScanRoutes() {
 	type ScanSingleDomainRequest struct {
+		Authoritative bool     `query:"authoritative" doc:"Query each of the domain's authoritative nameservers directly, and report any inconsistencies"`
 		DKIMSelectors []string `query:"dkimSelectors" maxItems:"5" example:"selector1,selector2" doc:"Specify custom DKIM selectors"`
 		Domain        string   `path:"domain" maxLength:"255" example:"example.com" doc:"Domain to scan"`
+		Evidence      bool     `query:"evidence" doc:"Include every DNS query made and its raw response in the result"`
+		Parked        bool     `query:"parked" doc:"Check the domain against the parked domain profile, for domains known not to send or receive mail"`
 	}
 
 	type ScanSingleDomainResponse struct {
@@ -29,13 +32,7 @@ func (s *Server) registerScanRoutes() {
 	}, func(ctx context.Context, input *ScanSingleDomainRequest) (*ScanSingleDomainResponse, error) {
 		resp := ScanSingleDomainResponse{}
 
-		if len(input.DKIMSelectors) > 0 {
-			if err := s.Scanner.OverwriteOption(scanner.WithDKIMSelectors(input.DKIMSelectors...)); err != nil {
-				return nil, huma.Error500InternalServerError(err.Error())
-			}
-		}
-
-		results, err := s.Scanner.Scan(input.Domain)
+		results, err := s.Scanner.ScanWithOptions(ctx, scanner.ScanOptions{Authoritative: input.Authoritative, DKIMSelectors: input.DKIMSelectors, Evidence: input.Evidence, Parked: input.Parked}, input.Domain)
 		if err != nil {
 			return nil, huma.Error500InternalServerError(err.Error())
 		}
@@ -53,7 +50,7 @@ func (s *Server) registerScanRoutes() {
 		}
 
 		if s.Advisor != nil {
-			result.Advice = s.Advisor.CheckAll(result.ScanResult.Domain, result.ScanResult.BIMI, result.ScanResult.DKIM, result.ScanResult.DMARC, result.ScanResult.MX, result.ScanResult.SPF)
+			result.Advice = s.Advisor.CheckResult(result.ScanResult)
 		}
 
 		resp.Body.ScanResultWithAdvice = result
@@ -62,7 +59,10 @@ func (s *Server) registerScanRoutes() {
 	})
 
 	type ScanBulkDomainsRequest struct {
+		Authoritative bool     `query:"authoritative" doc:"Query each of the domains' authoritative nameservers directly, and report any inconsistencies"`
 		DKIMSelectors []string `query:"dkimSelectors" maxItems:"5" example:"selector1,selector2" doc:"Specify custom DKIM selectors"`
+		Evidence      bool     `query:"evidence" doc:"Include every DNS query made and its raw response in the results"`
+		Parked        bool     `query:"parked" doc:"Check the domains against the parked domain profile, for domains known not to send or receive mail"`
 		Body          struct {
 			Domains []string `json:"domains" maxItems:"20" doc:"Domains to scan. Max 20 domains at a time." example:"example.com"`
 		}
@@ -83,7 +83,7 @@ func (s *Server) registerScanRoutes() {
 	}, func(ctx context.Context, input *ScanBulkDomainsRequest) (*ScanBulkDomainResponse, error) {
 		resp := ScanBulkDomainResponse{}
 
-		results, err := s.Scanner.Scan(input.Body.Domains...)
+		results, err := s.Scanner.ScanWithOptions(ctx, scanner.ScanOptions{Authoritative: input.Authoritative, DKIMSelectors: input.DKIMSelectors, Evidence: input.Evidence, Parked: input.Parked}, input.Body.Domains...)
 		if err != nil {
 			return nil, huma.Error500InternalServerError(err.Error())
 		}
@@ -98,7 +98,7 @@ func (s *Server) registerScanRoutes() {
 			}
 
 			if s.Advisor != nil && result.Error != scanner.ErrInvalidDomain {
-				res.Advice = s.Advisor.CheckAll(result.Domain, result.BIMI, result.DKIM, result.DMARC, result.MX, result.SPF)
+				res.Advice = s.Advisor.CheckResult(result)
 			}
 
 			resp.Body.Results = append(resp.Body.Results, res)
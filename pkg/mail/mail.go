@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/model"
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/scanner"
 	"github.com/emersion/go-imap"
 	imapClient "github.com/emersion/go-imap/client"
 	"github.com/spf13/cast"
@@ -31,6 +32,10 @@ type (
 	FoundMail struct {
 		Address      string
 		DKIMSelector string
+
+		// Parked is set when the subject asks for the domain to be checked
+		// against the parked domain profile.
+		Parked bool
 	}
 )
 
@@ -111,6 +116,7 @@ func (s *Server) GetMail() (map[string]FoundMail, error) {
 		addresses[msg.Envelope.From[0].HostName] = FoundMail{
 			Address:      msg.Envelope.From[0].Address(),
 			DKIMSelector: dkim,
+			Parked:       strings.EqualFold(strings.TrimSpace(msg.Envelope.Subject), "parked"),
 		}
 		emailsToBeDeleted = append(emailsToBeDeleted, msg.SeqNum)
 	}
@@ -195,6 +201,31 @@ func (s *Server) SendMail(mailbox string, result model.ScanResultWithAdvice) err
 	return nil
 }
 
+// stringifyDKIM lists each DKIM selector alongside its record.
+func stringifyDKIM(records []*scanner.DKIMRecord) string {
+	var lines []string
+	for _, record := range records {
+		lines = append(lines, record.Selector+": "+record.Record)
+	}
+
+	return stringify(lines)
+}
+
+// stringifyMX lists each mail server alongside its preference and addresses.
+func stringifyMX(hosts []*scanner.MXHost) string {
+	var lines []string
+	for _, host := range hosts {
+		line := fmt.Sprintf("%d %s", host.Preference, host.Host)
+		if len(host.Addresses) > 0 {
+			line += " (" + strings.Join(host.Addresses, ", ") + ")"
+		}
+
+		lines = append(lines, line)
+	}
+
+	return stringify(lines)
+}
+
 func stringify(array []string) (result string) {
 	if len(array) > 0 {
 		for _, s := range array {
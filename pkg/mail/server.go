@@ -1,6 +1,7 @@
 package mail
 
 import (
+	"context"
 	"fmt"
 	htmlTmpl "html/template"
 	textTmpl "text/template"
@@ -74,7 +75,13 @@ func (s *Server) handler() error {
 				s.logger.Error().Err(err).Msg("could not obtain the latest mail from mail server")
 			}
 
-			var dkimSelectors, domainList []string
+			// group the domains by DKIM selector and profile, so that each group can be scanned with its own options
+			type scanGroup struct {
+				selector string
+				parked   bool
+			}
+
+			domainsByGroup := make(map[scanGroup][]string)
 			for domain := range addresses {
 				cooldownDomain := s.cooldown.Get(domain)
 				if cooldownDomain != nil {
@@ -83,27 +90,28 @@ func (s *Server) handler() error {
 
 				s.cooldown.Set(domain, &domain)
 
-				if addresses[domain].DKIMSelector != "" {
-					dkimSelectors = append(dkimSelectors, addresses[domain].DKIMSelector)
-				}
-
-				domainList = append(domainList, domain)
+				group := scanGroup{selector: addresses[domain].DKIMSelector, parked: addresses[domain].Parked}
+				domainsByGroup[group] = append(domainsByGroup[group], domain)
 			}
 
-			if len(domainList) == 0 {
+			if len(domainsByGroup) == 0 {
 				continue
 			}
 
-			if len(dkimSelectors) > 0 {
-				if err = s.Scanner.OverwriteOption(scanner.WithDKIMSelectors(dkimSelectors...)); err != nil {
-					s.logger.Error().Err(err).Msg("failed to override DKIM selectors for mail")
+			var results []*scanner.Result
+			for group, domainList := range domainsByGroup {
+				opts := scanner.ScanOptions{Parked: group.parked}
+				if group.selector != "" {
+					opts.DKIMSelectors = []string{group.selector}
 				}
-			}
 
-			results, err := s.Scanner.Scan(domainList...)
-			if err != nil {
-				s.logger.Error().Err(err).Msg("An error occurred while scanning domains")
-				continue
+				groupResults, err := s.Scanner.ScanWithOptions(context.Background(), opts, domainList...)
+				if err != nil {
+					s.logger.Error().Err(err).Msg("An error occurred while scanning domains")
+					continue
+				}
+
+				results = append(results, groupResults...)
 			}
 
 			for _, result := range results {
@@ -114,7 +122,7 @@ func (s *Server) handler() error {
 				}
 
 				if s.advisor != nil || result.Error != scanner.ErrInvalidDomain {
-					resultWithAdvice.Advice = s.advisor.CheckAll(result.Domain, result.BIMI, result.DKIM, result.DMARC, result.MX, result.SPF)
+					resultWithAdvice.Advice = s.advisor.CheckResult(result)
 				}
 
 				if err = s.SendMail(sender, resultWithAdvice); err != nil {
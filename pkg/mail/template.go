@@ -54,21 +54,25 @@ func (s *Server) getMailContents(result model.ScanResultWithAdvice) (string, str
 	}
 
 	mailData := struct {
-		AdviceDomain, AdviceBIMI, AdviceDKIM, AdviceDMARC, AdviceMX, AdviceSPF string
-		ResultDomain, ResultBIMI, ResultDKIM, ResultDMARC, ResultMX, ResultSPF string
+		AdviceDomain, AdviceBIMI, AdviceDKIM, AdviceDMARC, AdviceDNSSEC, AdviceMTASTS, AdviceMX, AdviceSPF, AdviceTLSRPT string
+		ResultDomain, ResultBIMI, ResultDKIM, ResultDMARC, ResultMX, ResultSPF, ResultTLSRPT                             string
 	}{
 		AdviceDomain: stringify(result.Advice.Domain),
 		AdviceBIMI:   stringify(result.Advice.BIMI),
 		AdviceDKIM:   stringify(result.Advice.DKIM),
 		AdviceDMARC:  stringify(result.Advice.DMARC),
+		AdviceDNSSEC: stringify(result.Advice.DNSSEC),
+		AdviceMTASTS: stringify(result.Advice.MTASTS),
 		AdviceMX:     stringify(result.Advice.MX),
 		AdviceSPF:    stringify(result.Advice.SPF),
+		AdviceTLSRPT: stringify(result.Advice.TLSRPT),
 		ResultDomain: result.ScanResult.Domain,
 		ResultBIMI:   result.ScanResult.BIMI,
-		ResultDKIM:   result.ScanResult.DKIM,
+		ResultDKIM:   stringifyDKIM(result.ScanResult.DKIMRecords),
 		ResultDMARC:  result.ScanResult.DMARC,
-		ResultMX:     stringify(result.ScanResult.MX),
+		ResultMX:     stringifyMX(result.ScanResult.MXHosts),
 		ResultSPF:    result.ScanResult.SPF,
+		ResultTLSRPT: result.ScanResult.TLSRPT,
 	}
 
 	// prevent template errors
@@ -31,6 +31,14 @@ func (s *ScanResultWithAdvice) CSV() []string {
 		advice += "DMARC: " + value + "; "
 	}
 
+	for _, value := range s.Advice.DNSSEC {
+		advice += "DNSSEC: " + value + "; "
+	}
+
+	for _, value := range s.Advice.MTASTS {
+		advice += "MTA-STS: " + value + "; "
+	}
+
 	for _, value := range s.Advice.MX {
 		advice += "MX: " + value + "; "
 	}
@@ -39,5 +47,14 @@ func (s *ScanResultWithAdvice) CSV() []string {
 		advice += "SPF: " + value + "; "
 	}
 
-	return []string{s.ScanResult.Domain, s.ScanResult.BIMI, s.ScanResult.DKIM, s.ScanResult.DMARC, strings.Join(s.ScanResult.MX, "; "), s.ScanResult.SPF, s.ScanResult.Error, advice}
+	for _, value := range s.Advice.TLSRPT {
+		advice += "TLS-RPT: " + value + "; "
+	}
+
+	var dkim []string
+	for _, record := range s.ScanResult.DKIMRecords {
+		dkim = append(dkim, record.Selector+": "+record.Record)
+	}
+
+	return []string{s.ScanResult.Domain, s.ScanResult.BIMI, strings.Join(dkim, " | "), s.ScanResult.DMARC, strings.Join(s.ScanResult.MX, "; "), s.ScanResult.SPF, s.ScanResult.TLSRPT, s.ScanResult.Error, advice}
 }
@@ -0,0 +1,364 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The statuses of an authoritative nameserver, as reported by
+// AuthoritativeNameserver.Status.
+const (
+	// AuthoritativeOK means the nameserver answered authoritatively for the zone.
+	AuthoritativeOK = "ok"
+
+	// AuthoritativeLame means the nameserver is delegated the zone, but doesn't answer authoritatively for it (such
+	// as by responding with a referral, SERVFAIL or an answer without the AA bit).
+	AuthoritativeLame = "lame"
+
+	// AuthoritativeRefused means the nameserver refused to answer queries for the zone.
+	AuthoritativeRefused = "refused"
+
+	// AuthoritativeUnreachable means the nameserver's address couldn't be resolved, or it didn't respond.
+	AuthoritativeUnreachable = "unreachable"
+)
+
+type (
+	// AuthoritativeResult is the outcome of sending a domain's queries directly
+	// to each of the nameservers its zone is delegated to, rather than through
+	// a recursive resolver.
+	AuthoritativeResult struct {
+		Zone        string                     `json:"zone" yaml:"zone" doc:"The zone the domain belongs to." example:"example.com."`
+		Nameservers []*AuthoritativeNameserver `json:"nameservers,omitempty" yaml:"nameservers,omitempty" doc:"The nameservers the zone is delegated to, and how each of them responded."`
+		Mismatches  []*AuthoritativeMismatch   `json:"mismatches,omitempty" yaml:"mismatches,omitempty" doc:"The records which the nameservers disagree on."`
+	}
+
+	// AuthoritativeNameserver is one of the nameservers a zone is delegated to.
+	AuthoritativeNameserver struct {
+		Host    string `json:"host" yaml:"host" doc:"The hostname of the nameserver." example:"ns1.example.com."`
+		Address string `json:"address,omitempty" yaml:"address,omitempty" doc:"The address the nameserver was queried at." example:"192.0.2.53"`
+		Status  string `json:"status" yaml:"status" doc:"Whether the nameserver answered authoritatively for the zone (ok, lame, refused or unreachable)." example:"ok"`
+		Serial  uint32 `json:"serial,omitempty" yaml:"serial,omitempty" doc:"The serial in the zone's SOA record, as served by the nameserver." example:"2024010101"`
+		Stale   bool   `json:"stale,omitempty" yaml:"stale,omitempty" doc:"Whether the nameserver is serving an older serial than the other nameservers."`
+		Error   string `json:"error,omitempty" yaml:"error,omitempty" doc:"Why the nameserver couldn't be queried, if it couldn't." example:"read udp 192.0.2.53:53: i/o timeout"`
+	}
+
+	// AuthoritativeMismatch is a record which the authoritative nameservers
+	// gave different answers for.
+	AuthoritativeMismatch struct {
+		Check   string                 `json:"check" yaml:"check" doc:"The check the record belongs to, such as dmarc or spf." example:"spf"`
+		Name    string                 `json:"name" yaml:"name" doc:"The name that was queried." example:"example.com."`
+		Type    string                 `json:"type" yaml:"type" doc:"The record type that was queried." example:"TXT"`
+		Answers []*AuthoritativeAnswer `json:"answers" yaml:"answers" doc:"Each distinct answer, and the nameservers which gave it."`
+	}
+
+	// AuthoritativeAnswer is an answer given by one or more of the
+	// authoritative nameservers.
+	AuthoritativeAnswer struct {
+		Nameservers []string `json:"nameservers" yaml:"nameservers" doc:"The nameservers which gave this answer." example:"ns1.example.com."`
+		Records     []string `json:"records,omitempty" yaml:"records,omitempty" doc:"The type and RDATA of each record in the answer, sorted. Empty if the nameservers had no records." example:"TXT \"v=spf1 -all\""`
+	}
+
+	// authoritativeQuery is a query sent to each authoritative nameserver.
+	authoritativeQuery struct {
+		check string
+		name  string
+		qtype uint16
+	}
+)
+
+// checkAuthoritative sends the queries behind the SPF, DMARC, DKIM and MX
+// checks directly to each nameserver the domain's zone is delegated to, and
+// reports any which are lame, refuse queries or serve different records to
+// the others. It must be called once the other checks have finished, as it
+// queries the DKIM selectors they found.
+func (s *Scanner) checkAuthoritative(ctx context.Context, domain string, result *Result) (*AuthoritativeResult, error) {
+	zone, err := s.findZone(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := s.getDNSRecords(ctx, zone, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no nameservers found for %s", zone)
+	}
+
+	slices.Sort(hosts)
+	hosts = slices.Compact(hosts)
+
+	domain = dns.Fqdn(domain)
+	config := s.scanConfig(ctx)
+
+	var queries []authoritativeQuery
+	if config.runs(CheckSPF) {
+		queries = append(queries, authoritativeQuery{CheckSPF, domain, dns.TypeTXT})
+	}
+
+	if config.runs(CheckDMARC) {
+		queries = append(queries, authoritativeQuery{CheckDMARC, "_dmarc." + domain, dns.TypeTXT})
+	}
+
+	for _, record := range result.DKIMRecords {
+		queries = append(queries, authoritativeQuery{CheckDKIM, record.Selector + "._domainkey." + domain, dns.TypeTXT})
+	}
+
+	if config.runs(CheckMX) {
+		queries = append(queries, authoritativeQuery{CheckMX, domain, dns.TypeMX})
+	}
+
+	authoritative := &AuthoritativeResult{
+		Zone:        zone,
+		Nameservers: make([]*AuthoritativeNameserver, len(hosts)),
+	}
+
+	// answers holds the records each nameserver returned for each query, or nil if it didn't answer
+	answers := make([][][]string, len(hosts))
+
+	// authoritative nameservers only speak plain DNS, and truncated UDP responses are retried over TCP
+	network := "udp"
+	if s.dnsProtocol == "tcp" {
+		network = "tcp"
+	}
+
+	resolver := newDNSResolver(&dns.Client{Net: network, Timeout: config.queryTimeout}, nil)
+
+	var wg sync.WaitGroup
+	for index, host := range hosts {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			authoritative.Nameservers[index], answers[index] = s.queryAuthoritative(ctx, resolver, zone, host, queries)
+		}()
+	}
+
+	wg.Wait()
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	markStaleNameservers(authoritative.Nameservers)
+
+	for queryIndex, query := range queries {
+		var distinct []*AuthoritativeAnswer
+
+		for nsIndex, nameserver := range authoritative.Nameservers {
+			if answers[nsIndex] == nil || answers[nsIndex][queryIndex] == nil {
+				continue
+			}
+
+			records := answers[nsIndex][queryIndex]
+
+			found := false
+			for _, answer := range distinct {
+				if slices.Equal(answer.Records, records) {
+					answer.Nameservers = append(answer.Nameservers, nameserver.Host)
+					found = true
+
+					break
+				}
+			}
+
+			if !found {
+				distinct = append(distinct, &AuthoritativeAnswer{Nameservers: []string{nameserver.Host}, Records: records})
+			}
+		}
+
+		if len(distinct) > 1 {
+			authoritative.Mismatches = append(authoritative.Mismatches, &AuthoritativeMismatch{
+				Check:   query.check,
+				Name:    query.name,
+				Type:    dns.TypeToString[query.qtype],
+				Answers: distinct,
+			})
+		}
+	}
+
+	return authoritative, nil
+}
+
+// findZone returns the zone a domain belongs to, from the owner of the SOA
+// record returned when querying it.
+func (s *Scanner) findZone(ctx context.Context, domain string) (string, error) {
+	resp, err := s.getDNSResponse(ctx, domain, dns.TypeSOA)
+	if err != nil {
+		return "", err
+	}
+
+	// the SOA record is in the answer for the zone apex, and in the authority section for any other name
+	for _, rr := range append(slices.Clone(resp.Answer), resp.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Hdr.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("couldn't find the zone for %s", dns.Fqdn(domain))
+}
+
+// queryAuthoritative checks that a nameserver answers authoritatively for the
+// zone, and if it does, sends it each query. The nameserver's addresses are
+// tried in turn until one of them responds, which is then sent every query.
+// It returns the records the nameserver returned for each query, which are nil
+// for any it didn't answer.
+func (s *Scanner) queryAuthoritative(ctx context.Context, resolver *dnsResolver, zone, host string, queries []authoritativeQuery) (*AuthoritativeNameserver, [][]string) {
+	nameserver := &AuthoritativeNameserver{Host: host}
+
+	addresses, err := s.resolveNameserver(ctx, host)
+	if err != nil {
+		nameserver.Status = AuthoritativeUnreachable
+		nameserver.Error = err.Error()
+
+		return nameserver, nil
+	}
+
+	var server string
+
+	exchange := func(name string, qtype uint16) (*dns.Msg, error) {
+		req := new(dns.Msg)
+		req.Id = dns.Id()
+		req.SetQuestion(name, qtype)
+		req.SetEdns0(s.dnsBuffer, false)
+
+		start := time.Now()
+		resp, err := resolver.query(ctx, req, server)
+
+		if s.scanConfig(ctx).evidence {
+			trackerFromContext(ctx).observeEvidence(newDNSEvidence(req, resp, err, time.Since(start)))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Msg, nil
+	}
+
+	var soa *dns.Msg
+	var errs []error
+
+	for _, address := range addresses {
+		server = net.JoinHostPort(address, s.authoritativePort)
+
+		if soa, err = exchange(zone, dns.TypeSOA); err == nil {
+			nameserver.Address = address
+			break
+		}
+
+		errs = append(errs, err)
+	}
+
+	if soa == nil {
+		nameserver.Status = AuthoritativeUnreachable
+		nameserver.Error = errors.Join(errs...).Error()
+
+		return nameserver, nil
+	}
+
+	if soa.Rcode == dns.RcodeRefused {
+		nameserver.Status = AuthoritativeRefused
+
+		return nameserver, nil
+	}
+
+	nameserver.Status = AuthoritativeLame
+
+	if soa.Rcode != dns.RcodeSuccess || !soa.Authoritative {
+		return nameserver, nil
+	}
+
+	for _, rr := range soa.Answer {
+		if record, ok := rr.(*dns.SOA); ok && strings.EqualFold(record.Hdr.Name, zone) {
+			nameserver.Serial = record.Serial
+			nameserver.Status = AuthoritativeOK
+		}
+	}
+
+	if nameserver.Status != AuthoritativeOK {
+		return nameserver, nil
+	}
+
+	answers := make([][]string, len(queries))
+
+	for index, query := range queries {
+		resp, err := exchange(query.name, query.qtype)
+		if err != nil || !resp.Authoritative || (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError) {
+			continue
+		}
+
+		records := []string{}
+		for _, rr := range resp.Answer {
+			if rr.Header().Rrtype == query.qtype || rr.Header().Rrtype == dns.TypeCNAME {
+				records = append(records, dns.TypeToString[rr.Header().Rrtype]+" "+rdata(rr))
+			}
+		}
+
+		slices.Sort(records)
+		answers[index] = records
+	}
+
+	return nameserver, answers
+}
+
+// resolveNameserver returns the addresses to query a nameserver at, with its
+// IPv4 addresses first.
+func (s *Scanner) resolveNameserver(ctx context.Context, host string) ([]string, error) {
+	var addresses []string
+	var errs []error
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		records, err := s.getDNSRecords(ctx, host, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		addresses = append(addresses, records...)
+	}
+
+	if len(addresses) > 0 {
+		return addresses, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return nil, fmt.Errorf("%s doesn't resolve to any addresses", host)
+}
+
+// markStaleNameservers flags the nameservers which are serving an older
+// serial of the zone than the newest one served, using serial number
+// arithmetic (RFC 1982) so that serials which have wrapped around compare
+// correctly.
+func markStaleNameservers(nameservers []*AuthoritativeNameserver) {
+	var newest *AuthoritativeNameserver
+
+	for _, nameserver := range nameservers {
+		if nameserver.Status != AuthoritativeOK {
+			continue
+		}
+
+		if newest == nil || int32(nameserver.Serial-newest.Serial) > 0 {
+			newest = nameserver
+		}
+	}
+
+	for _, nameserver := range nameservers {
+		if nameserver.Status == AuthoritativeOK && nameserver.Serial != newest.Serial {
+			nameserver.Stale = true
+		}
+	}
+}
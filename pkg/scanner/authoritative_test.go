@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanAuthoritative(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 2
+
+	port := newFakeAuthoritativeServers(t,
+		// ns1 is up to date
+		&fakeDNS{
+			mockResolver: newMockResolver(t,
+				`example.com. 300 IN TXT "v=spf1 include:_spf.example.net -all"`,
+				`example.com. 300 IN MX 10 mx.example.com.`,
+				`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`,
+			),
+			zones:  []string{"example.com."},
+			serial: 2,
+		},
+		// ns2 is a stale secondary, serving an old SPF record
+		&fakeDNS{
+			mockResolver: newMockResolver(t,
+				`example.com. 300 IN TXT "v=spf1 ~all"`,
+				`example.com. 300 IN MX 10 mx.example.com.`,
+				`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`,
+			),
+			zones:  []string{"example.com."},
+			serial: 1,
+		},
+		// ns3 refuses queries for the zone
+		&fakeDNS{rcode: dns.RcodeRefused},
+		// ns4 responds from its cache, but not authoritatively
+		newFakeDNS(t, `example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2 3600 600 86400 300`),
+	)
+
+	resolver := newMockResolver(t,
+		`example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2 3600 600 86400 300`,
+		`example.com. 300 IN NS ns1.example.com.`,
+		`example.com. 300 IN NS ns2.example.com.`,
+		`example.com. 300 IN NS ns3.example.com.`,
+		`example.com. 300 IN NS ns4.example.com.`,
+		`example.com. 300 IN NS ns5.example.com.`,
+		`example.com. 300 IN NS ns6.example.com.`,
+		`example.com. 300 IN TXT "v=spf1 include:_spf.example.net -all"`,
+		`example.com. 300 IN MX 10 mx.example.com.`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`,
+		`ns1.example.com. 300 IN A 127.0.0.2`,
+		`ns2.example.com. 300 IN A 127.0.0.3`,
+		`ns3.example.com. 300 IN A 127.0.0.4`,
+		`ns4.example.com. 300 IN A 127.0.0.5`,
+		`ns5.example.com. 300 IN AAAA ::1`,
+		`ns6.example.com. 300 IN A 127.0.0.250`,
+		`ns6.example.com. 300 IN A 127.0.0.2`,
+	)
+
+	scanner, err := New(logger, timeout, WithResolver(resolver), WithAuthoritativeCheck(true), WithAuthoritativePort(port))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	t.Run("Inconsistent", func(t *testing.T) {
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+
+		result := results[0].Authoritative
+		require.NotNil(t, result)
+		require.Equal(t, "example.com.", result.Zone)
+		require.Len(t, result.Nameservers, 6)
+
+		require.Equal(t, &AuthoritativeNameserver{Host: "ns1.example.com.", Address: "127.0.0.2", Status: AuthoritativeOK, Serial: 2}, result.Nameservers[0])
+		require.Equal(t, &AuthoritativeNameserver{Host: "ns2.example.com.", Address: "127.0.0.3", Status: AuthoritativeOK, Serial: 1, Stale: true}, result.Nameservers[1])
+		require.Equal(t, &AuthoritativeNameserver{Host: "ns3.example.com.", Address: "127.0.0.4", Status: AuthoritativeRefused}, result.Nameservers[2])
+		require.Equal(t, &AuthoritativeNameserver{Host: "ns4.example.com.", Address: "127.0.0.5", Status: AuthoritativeLame}, result.Nameservers[3])
+
+		// nothing is listening on the IPv6 loopback address
+		require.Equal(t, AuthoritativeUnreachable, result.Nameservers[4].Status)
+		require.NotEmpty(t, result.Nameservers[4].Error)
+
+		// ns6's first address isn't listening either, so its second address is queried instead
+		require.Equal(t, &AuthoritativeNameserver{Host: "ns6.example.com.", Address: "127.0.0.2", Status: AuthoritativeOK, Serial: 2}, result.Nameservers[5])
+
+		require.Equal(t, []*AuthoritativeMismatch{
+			{
+				Check: CheckSPF,
+				Name:  "example.com.",
+				Type:  "TXT",
+				Answers: []*AuthoritativeAnswer{
+					{Nameservers: []string{"ns1.example.com.", "ns6.example.com."}, Records: []string{`TXT "v=spf1 include:_spf.example.net -all"`}},
+					{Nameservers: []string{"ns2.example.com."}, Records: []string{`TXT "v=spf1 ~all"`}},
+				},
+			},
+		}, result.Mismatches)
+	})
+
+	t.Run("QueryTimeout", func(t *testing.T) {
+		// a nameserver which never responds
+		port := newFakeAuthoritativeServers(t, &fakeDNS{drop: true})
+
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithAuthoritativePort(port))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		start := time.Now()
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Authoritative: true, Checks: []string{CheckSPF}, QueryTimeout: time.Millisecond * 100}, "example.com")
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), timeout)
+
+		// ns1 is only reachable at 127.0.0.2, which never responds
+		require.Equal(t, AuthoritativeUnreachable, results[0].Authoritative.Nameservers[0].Status)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Nil(t, results[0].Authoritative)
+	})
+}
+
+func TestMarkStaleNameservers(t *testing.T) {
+	nameservers := []*AuthoritativeNameserver{
+		{Host: "ns1.", Status: AuthoritativeOK, Serial: 4294967295},
+		{Host: "ns2.", Status: AuthoritativeOK, Serial: 5},
+		{Host: "ns3.", Status: AuthoritativeLame},
+	}
+
+	markStaleNameservers(nameservers)
+
+	// serial 5 is newer than 4294967295, as the serial has wrapped around
+	var stale []string
+	for _, nameserver := range nameservers {
+		if nameserver.Stale {
+			stale = append(stale, strings.TrimSuffix(nameserver.Host, "."))
+		}
+	}
+
+	require.Equal(t, []string{"ns1"}, stale)
+}
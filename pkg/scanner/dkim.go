@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxCNAMEHops is the longest CNAME chain that will be followed.
+	maxCNAMEHops = 8
+
+	// maxDKIMLookups is the most selectors which are looked up at once, so
+	// that a long list of selectors doesn't flood the nameservers.
+	maxDKIMLookups = 8
+)
+
+// DKIMRecord is the DKIM record published for a single selector.
+type DKIMRecord struct {
+	Selector    string `json:"selector" yaml:"selector" doc:"The DKIM selector." example:"google"`
+	Record      string `json:"record" yaml:"record" doc:"The DKIM record for the selector." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+	CNAMETarget string `json:"cnameTarget,omitempty" yaml:"cnameTarget,omitempty" doc:"The name the selector is a CNAME for, if it's hosted elsewhere (such as by an email service provider)." example:"selector1-example-com._domainkey.example.onmicrosoft.com."`
+}
+
+// getTypeDKIM queries the DNS server for the DKIM records of a domain, using
+// both the caller's selectors and the known selectors. It returns every
+// selector which has a DKIM record, and an error if any occurred.
+func (s *Scanner) getTypeDKIM(ctx context.Context, domain string) ([]*DKIMRecord, error) {
+	var selectors []string
+	seen := make(map[string]bool)
+
+	for _, selector := range append(append([]string{}, s.scanConfig(ctx).dkimSelectors...), knownDkimSelectors...) {
+		if !seen[selector] {
+			seen[selector] = true
+			selectors = append(selectors, selector)
+		}
+	}
+
+	records := make([]*DKIMRecord, len(selectors))
+	errs := make([]error, len(selectors))
+
+	// limit the lookups in flight, as every domain scanned at once looks up every selector
+	limit := make(chan struct{}, maxDKIMLookups)
+
+	var wg sync.WaitGroup
+	for index, selector := range selectors {
+		wg.Add(1)
+		limit <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+
+			record, cnameTarget, err := s.getDKIMRecord(ctx, selector+"._domainkey."+domain)
+			if err != nil {
+				errs[index] = fmt.Errorf("selector %s: %w", selector, err)
+				return
+			}
+
+			if record != "" {
+				records[index] = &DKIMRecord{Selector: selector, Record: record, CNAMETarget: cnameTarget}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// keep the selectors in the order they were specified
+	var found []*DKIMRecord
+	for _, record := range records {
+		if record != nil {
+			found = append(found, record)
+		}
+	}
+
+	return found, errors.Join(errs...)
+}
+
+// getDKIMRecord returns the DKIM record published at a name, following any
+// CNAMEs. It also returns the final target of the CNAME chain, if there was
+// one.
+func (s *Scanner) getDKIMRecord(ctx context.Context, name string) (record, cnameTarget string, err error) {
+	for range maxCNAMEHops {
+		answers, err := s.getDNSAnswers(ctx, name, dns.TypeTXT)
+		if err != nil {
+			return "", "", err
+		}
+
+		var next string
+
+		for _, answer := range answers {
+			switch rr := answer.(type) {
+			case *dns.CNAME:
+				cnameTarget, next = rr.Target, rr.Target
+			case *dns.TXT:
+				// TXT records can be split across multiple strings, so we need to join them
+				if record := strings.Join(rr.Txt, ""); strings.HasPrefix(record, DKIMPrefix) {
+					return record, cnameTarget, nil
+				}
+			}
+		}
+
+		// the resolver didn't include the CNAME target's records in its answer
+		if next == "" {
+			break
+		}
+
+		name = next
+	}
+
+	return "", cnameTarget, nil
+}
@@ -0,0 +1,247 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dmarcTreeWalkLimit is the most DMARC records queried by the DMARCbis tree walk.
+	dmarcTreeWalkLimit = 8
+
+	// dmarcTreeWalkLabels is the number of labels a long domain is shortened to after its first query.
+	dmarcTreeWalkLabels = 7
+)
+
+// getTypeDMARC queries the DNS server for the DMARC record of a domain. If the
+// domain doesn't publish one, the record of its organizational domain is used
+// instead (RFC 7489, section 6.6.3). It returns the DMARC record, the domain it
+// was inherited from (if any), the domain's organizational domain, and an error
+// if any occurred.
+func (s *Scanner) getTypeDMARC(ctx context.Context, domain string) (record, inheritedFrom, orgDomain string, err error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	if s.dmarcTreeWalk {
+		return s.walkDMARCTree(ctx, domain)
+	}
+
+	orgDomain = s.publicSuffixList.organizationalDomain(domain)
+
+	record, err = s.getDMARCRecord(ctx, "_dmarc."+domain)
+	if err != nil || record != "" {
+		return record, "", orgDomain, err
+	}
+
+	if orgDomain == domain {
+		return "", "", orgDomain, nil
+	}
+
+	record, err = s.getDMARCRecord(ctx, "_dmarc."+orgDomain)
+	if err != nil || record == "" {
+		return "", "", orgDomain, err
+	}
+
+	return record, orgDomain, orgDomain, nil
+}
+
+// walkDMARCTree discovers the DMARC policy and organizational domain of a
+// domain using the DMARCbis DNS tree walk (section 4.10), which queries the
+// domain and each of its parents in turn, up to and including its top-level
+// domain. The policy is the first DMARC record found, which lets public suffix
+// operators publish policies (with psd=y) for the domains beneath them.
+//
+// The organizational domain is the first domain whose record has psd=n, or the
+// domain one label below the first parent whose record has psd=y. Otherwise,
+// it's the domain with the fewest labels which publishes a record, or the
+// domain itself if none do. policyDomain is empty if the record was found at
+// the domain itself.
+func (s *Scanner) walkDMARCTree(ctx context.Context, domain string) (record, policyDomain, orgDomain string, err error) {
+	domainLabels := strings.Split(domain, ".")
+	labels := domainLabels
+	orgDomain = domain
+
+	for query := 0; query < dmarcTreeWalkLimit && len(labels) > 0; query++ {
+		name := strings.Join(labels, ".")
+
+		found, err := s.getDMARCRecord(ctx, "_dmarc."+name)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		if found != "" {
+			if record == "" {
+				record = found
+
+				if name != domain {
+					policyDomain = name
+				}
+			}
+
+			switch dmarcTag(found, "psd") {
+			case "n":
+				return record, policyDomain, name, nil
+			case "y":
+				// a public suffix operator's record for the domain itself doesn't make it the organizational domain
+				if name != domain {
+					return record, policyDomain, strings.Join(domainLabels[len(domainLabels)-len(labels)-1:], "."), nil
+				}
+			}
+
+			orgDomain = name
+		}
+
+		// skip straight to the last few labels of long domains, to limit the number of queries
+		if query == 0 && len(labels) > dmarcTreeWalkLabels {
+			labels = labels[len(labels)-dmarcTreeWalkLabels:]
+		} else {
+			labels = labels[1:]
+		}
+	}
+
+	return record, policyDomain, orgDomain, nil
+}
+
+// getDMARCPolicyTag returns which of a DMARC record's policy tags applies to a
+// domain (DMARCbis, section 5.3). A domain's own record uses its p= tag. An
+// inherited record uses its np= tag if the domain doesn't exist, and otherwise
+// its sp= tag, falling back to p= when those aren't set.
+func (s *Scanner) getDMARCPolicyTag(ctx context.Context, domain, record, inheritedFrom string) (string, error) {
+	if record == "" {
+		return "", nil
+	}
+
+	if inheritedFrom == "" {
+		return "p", nil
+	}
+
+	if dmarcTag(record, "np") != "" {
+		resp, err := s.getDNSResponse(ctx, domain, dns.TypeA)
+		if err != nil {
+			return "", err
+		}
+
+		if resp.Rcode == dns.RcodeNameError {
+			return "np", nil
+		}
+	}
+
+	if dmarcTag(record, "sp") != "" {
+		return "sp", nil
+	}
+
+	return "p", nil
+}
+
+// getDMARCRecord returns the DMARC record published at a name, such as
+// _dmarc.<domain>.
+func (s *Scanner) getDMARCRecord(ctx context.Context, name string) (string, error) {
+	records, err := s.getDNSRecords(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+
+	for index, record := range records {
+		if strings.HasPrefix(record, DMARCPrefix) {
+			// TXT records can be split across multiple strings, so we need to join them
+			return strings.Join(records[index:], ""), nil
+		}
+	}
+
+	return "", nil
+}
+
+// DMARCReportAuthorization records whether an external domain has agreed to
+// receive a domain's DMARC reports (RFC 7489, section 7.1).
+type DMARCReportAuthorization struct {
+	Destination string `json:"destination" yaml:"destination" doc:"The report destination, as listed in the rua or ruf tag." example:"mailto:dmarc@reports.example.net"`
+	Domain      string `json:"domain" yaml:"domain" doc:"The domain of the report destination." example:"reports.example.net"`
+	Name        string `json:"name" yaml:"name" doc:"The name the authorization record must be published at." example:"example.com._report._dmarc.reports.example.net"`
+	Authorized  bool   `json:"authorized" yaml:"authorized" doc:"Whether the destination's domain publishes a record authorizing it to receive the reports."`
+	Record      string `json:"record,omitempty" yaml:"record,omitempty" doc:"The authorization record published by the destination's domain." example:"v=DMARC1"`
+}
+
+// getDMARCReportAuthorizations checks that every rua and ruf destination in a
+// DMARC record, which isn't within the organizational domain of the domain
+// that published the record, has authorized it to send it reports.
+func (s *Scanner) getDMARCReportAuthorizations(ctx context.Context, domain, record string) ([]*DMARCReportAuthorization, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	orgDomain := s.publicSuffixList.organizationalDomain(domain)
+	records := make(map[string]string)
+
+	var authorizations []*DMARCReportAuthorization
+
+	for _, tag := range []string{"rua", "ruf"} {
+		for _, destination := range strings.Split(dmarcTag(record, tag), ",") {
+			destination = strings.TrimSpace(destination)
+
+			// destinations can be followed by a maximum report size, such as mailto:dmarc@example.com!10m
+			address, _, _ := strings.Cut(strings.TrimPrefix(destination, "mailto:"), "!")
+
+			at := strings.LastIndex(address, "@")
+			if !strings.HasPrefix(destination, "mailto:") || at == -1 {
+				continue
+			}
+
+			destinationDomain := strings.ToLower(strings.TrimSuffix(address[at+1:], "."))
+			if destinationDomain == "" || s.publicSuffixList.organizationalDomain(destinationDomain) == orgDomain {
+				continue
+			}
+
+			name := domain + "._report._dmarc." + destinationDomain
+
+			authorizationRecord, ok := records[name]
+			if !ok {
+				var err error
+
+				authorizationRecord, err = s.getDMARCReportRecord(ctx, name)
+				if err != nil {
+					return authorizations, err
+				}
+
+				records[name] = authorizationRecord
+			}
+
+			authorizations = append(authorizations, &DMARCReportAuthorization{
+				Destination: destination,
+				Domain:      destinationDomain,
+				Name:        name,
+				Authorized:  authorizationRecord != "",
+				Record:      authorizationRecord,
+			})
+		}
+	}
+
+	return authorizations, nil
+}
+
+// getDMARCReportRecord returns the report authorization record published at a
+// name. Unlike DMARC records, these are usually just "v=DMARC1", without any
+// other tags.
+func (s *Scanner) getDMARCReportRecord(ctx context.Context, name string) (string, error) {
+	records, err := s.getDNSRecords(ctx, name, dns.TypeTXT)
+	if err != nil {
+		return "", err
+	}
+
+	for _, record := range records {
+		if version, _, _ := strings.Cut(record, ";"); strings.TrimSpace(version) == "v=DMARC1" {
+			return record, nil
+		}
+	}
+
+	return "", nil
+}
+
+// dmarcTag returns the value of a tag in a DMARC record, or an empty string if
+// the tag isn't present.
+func dmarcTag(record, name string) string {
+	for _, tag := range strings.Split(record, ";") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(tag), "="); ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,553 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"github.com/miekg/dns"
+)
+
+const (
+	// DNSSECSecure means the answer's signatures were validated.
+	DNSSECSecure DNSSECStatus = "secure"
+
+	// DNSSECInsecure means the answer wasn't signed, and its zone was proven to be unsigned.
+	DNSSECInsecure DNSSECStatus = "insecure"
+
+	// DNSSECBogus means the answer was signed, but its signatures failed to validate.
+	DNSSECBogus DNSSECStatus = "bogus"
+
+	// DNSSECIndeterminate means the answer was signed, but the records needed to validate it couldn't be retrieved.
+	DNSSECIndeterminate DNSSECStatus = "indeterminate"
+
+	// dnssecKeyCacheDuration is how long a zone's validated keys are cached for.
+	dnssecKeyCacheDuration = 10 * time.Minute
+
+	// rootTrustAnchors holds the DS records of the root zone's key signing keys (KSK-2017 and KSK-2024), as published
+	// by IANA at https://data.iana.org/root-anchors/root-anchors.xml.
+	rootTrustAnchors = `. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+)
+
+type (
+	// DNSSECStatus is the DNSSEC validation status of a set of answers.
+	DNSSECStatus string
+
+	// DNSSECResult holds the DNSSEC validation status of a domain's zone and mail records.
+	DNSSECResult struct {
+		Signed bool         `json:"signed" yaml:"signed" doc:"Whether the domain's zone is signed with DNSSEC." example:"true"`
+		BIMI   DNSSECStatus `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The DNSSEC status of the BIMI record (secure, insecure, bogus or indeterminate)." example:"secure"`
+		DKIM   DNSSECStatus `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DNSSEC status of the DKIM record (secure, insecure, bogus or indeterminate)." example:"secure"`
+		DMARC  DNSSECStatus `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DNSSEC status of the DMARC record (secure, insecure, bogus or indeterminate)." example:"secure"`
+		MX     DNSSECStatus `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The DNSSEC status of the MX records (secure, insecure, bogus or indeterminate)." example:"secure"`
+		SPF    DNSSECStatus `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The DNSSEC status of the SPF record (secure, insecure, bogus or indeterminate)." example:"secure"`
+		TLSRPT DNSSECStatus `json:"tlsrpt,omitempty" yaml:"tlsrpt,omitempty" doc:"The DNSSEC status of the TLS-RPT record (secure, insecure, bogus or indeterminate)." example:"secure"`
+	}
+
+	// dnssecValidator holds the state of the built-in DNSSEC chain validator.
+	dnssecValidator struct {
+		// keys caches the validated DNSKEY records of each zone.
+		keys *cache.Cache[zoneKeys]
+
+		// trustAnchors holds the DS records that are trusted without validation, keyed by zone.
+		trustAnchors map[string][]*dns.DS
+	}
+
+	// rrsetKey identifies an RRset within an answer.
+	rrsetKey struct {
+		name   string
+		rrtype uint16
+	}
+
+	// zoneKeys holds the outcome of validating a zone's DNSKEY records.
+	zoneKeys struct {
+		keys   []*dns.DNSKEY
+		status DNSSECStatus
+	}
+)
+
+func newDNSSECValidator(trustAnchors map[string][]*dns.DS) *dnssecValidator {
+	return &dnssecValidator{
+		keys:         cache.New[zoneKeys](dnssecKeyCacheDuration),
+		trustAnchors: trustAnchors,
+	}
+}
+
+// closeDNSSECValidator stops the cleanup of the DNSSEC validator's key cache,
+// when it's being replaced or the scanner is closed.
+func (s *Scanner) closeDNSSECValidator() {
+	if s.dnssecValidator != nil {
+		s.dnssecValidator.keys.Close()
+	}
+}
+
+// parseTrustAnchors reads DS or DNSKEY records in zone file format, converting
+// any DNSKEY records into their SHA-256 DS equivalent.
+func parseTrustAnchors(reader io.Reader) (map[string][]*dns.DS, error) {
+	trustAnchors := make(map[string][]*dns.DS)
+
+	zoneParser := dns.NewZoneParser(reader, ".", "")
+	for rr, ok := zoneParser.Next(); ok; rr, ok = zoneParser.Next() {
+		zone := dns.CanonicalName(rr.Header().Name)
+
+		switch record := rr.(type) {
+		case *dns.DS:
+			trustAnchors[zone] = append(trustAnchors[zone], record)
+		case *dns.DNSKEY:
+			trustAnchors[zone] = append(trustAnchors[zone], record.ToDS(dns.SHA256))
+		}
+	}
+
+	if err := zoneParser.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(trustAnchors) == 0 {
+		return nil, fmt.Errorf("no DS or DNSKEY records found")
+	}
+
+	return trustAnchors, nil
+}
+
+// weakerThan reports whether the status offers less assurance than other.
+func (status DNSSECStatus) weakerThan(other DNSSECStatus) bool {
+	rank := func(status DNSSECStatus) int {
+		switch status {
+		case DNSSECBogus:
+			return 0
+		case DNSSECIndeterminate:
+			return 1
+		case DNSSECInsecure:
+			return 2
+		default:
+			return 3
+		}
+	}
+
+	return rank(status) < rank(other)
+}
+
+// dnssecStatus returns the DNSSEC status of a response's answers, either by
+// trusting the AD bit set by the nameserver, or by validating the answers with
+// the built-in chain validator when it's enabled. It returns an empty status if
+// there are no answers to validate.
+func (s *Scanner) dnssecStatus(ctx context.Context, in *dns.Msg) DNSSECStatus {
+	if in.Rcode != dns.RcodeSuccess {
+		if isDNSSECFailure(in) {
+			return DNSSECBogus
+		}
+
+		return ""
+	}
+
+	if len(in.Answer) == 0 {
+		return ""
+	}
+
+	if s.dnssecValidator == nil {
+		if in.AuthenticatedData {
+			return DNSSECSecure
+		}
+
+		return DNSSECInsecure
+	}
+
+	return s.validateAnswer(ctx, in.Answer)
+}
+
+// isZoneSigned reports whether the zone that a domain belongs to is signed, by
+// checking for signatures over its SOA record. The SOA record is returned in
+// the authority section if the domain isn't the zone's apex.
+func (s *Scanner) isZoneSigned(ctx context.Context, domain string) (bool, error) {
+	in, err := s.queryDNSSEC(ctx, domain, dns.TypeSOA)
+	if err != nil {
+		return false, err
+	}
+
+	for _, rr := range append(in.Answer, in.Ns...) {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == dns.TypeSOA {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// queryDNSSEC sends a query with the DO and CD bits set, so that signatures
+// are returned even if the nameserver considers them bogus.
+func (s *Scanner) queryDNSSEC(ctx context.Context, name string, recordType uint16) (*dns.Msg, error) {
+	req := &dns.Msg{}
+	req.Id = dns.Id()
+	req.RecursionDesired = true
+	req.CheckingDisabled = true
+	req.SetEdns0(max(s.dnsBuffer, 4096), true)
+	req.SetQuestion(dns.Fqdn(name), recordType)
+
+	resp, err := s.exchange(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Msg.Rcode != dns.RcodeSuccess && resp.Msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("DNS query failed with rcode %v", resp.Msg.Rcode)
+	}
+
+	return resp.Msg, nil
+}
+
+// validateAnswer validates every RRset within an answer, returning the
+// weakest status of them all.
+func (s *Scanner) validateAnswer(ctx context.Context, answer []dns.RR) DNSSECStatus {
+	rrsets := make(map[rrsetKey][]dns.RR)
+	signatures := make(map[rrsetKey][]*dns.RRSIG)
+
+	for _, rr := range answer {
+		name := dns.CanonicalName(rr.Header().Name)
+
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{name: name, rrtype: sig.TypeCovered}
+			signatures[key] = append(signatures[key], sig)
+			continue
+		}
+
+		key := rrsetKey{name: name, rrtype: rr.Header().Rrtype}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+
+	status := DNSSECSecure
+	for key, rrset := range rrsets {
+		if rrsetStatus := s.validateRRset(ctx, rrset, signatures[key]); rrsetStatus.weakerThan(status) {
+			status = rrsetStatus
+		}
+	}
+
+	return status
+}
+
+// validateRRset checks whether any of the signatures over an RRset were made
+// by a validated key of the signing zone. An unsigned RRset is only insecure
+// if the zone it belongs to is provably unsigned.
+func (s *Scanner) validateRRset(ctx context.Context, rrset []dns.RR, signatures []*dns.RRSIG) DNSSECStatus {
+	owner := rrset[0].Header().Name
+
+	if len(signatures) == 0 {
+		return s.unsignedStatus(ctx, owner)
+	}
+	status := DNSSECBogus
+
+	for _, sig := range signatures {
+		// only a zone containing the RRset can sign it
+		if !dns.IsSubDomain(sig.SignerName, owner) {
+			continue
+		}
+
+		keys, keyStatus := s.getZoneKeys(ctx, sig.SignerName)
+		if keyStatus != DNSSECSecure {
+			if keyStatus != DNSSECBogus {
+				status = keyStatus
+			}
+
+			continue
+		}
+
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+
+			if sig.Verify(key, rrset) == nil && sig.ValidityPeriod(time.Now()) {
+				return DNSSECSecure
+			}
+		}
+	}
+
+	return status
+}
+
+// getZoneKeys returns the validated DNSKEY records of a zone.
+func (s *Scanner) getZoneKeys(ctx context.Context, zone string) ([]*dns.DNSKEY, DNSSECStatus) {
+	zone = dns.CanonicalName(zone)
+
+	if cached := s.dnssecValidator.keys.Get(zone); cached != nil {
+		return cached.keys, cached.status
+	}
+
+	keys, status := s.fetchZoneKeys(ctx, zone)
+
+	// don't cache failures caused by the caller giving up
+	if ctx.Err() == nil {
+		s.dnssecValidator.keys.Set(zone, &zoneKeys{keys: keys, status: status})
+	}
+
+	return keys, status
+}
+
+// fetchZoneKeys retrieves a zone's DNSKEY records, and authenticates them
+// against the zone's DS records. These are either configured as a trust
+// anchor, or are retrieved from (and validated by) the parent zone.
+func (s *Scanner) fetchZoneKeys(ctx context.Context, zone string) ([]*dns.DNSKEY, DNSSECStatus) {
+	delegations, ok := s.dnssecValidator.trustAnchors[zone]
+	if !ok {
+		// the chain of trust can't reach this zone
+		if zone == "." {
+			return nil, DNSSECInsecure
+		}
+
+		in, err := s.queryDNSSEC(ctx, zone, dns.TypeDS)
+		if err != nil {
+			return nil, DNSSECIndeterminate
+		}
+
+		var rrset []dns.RR
+		var signatures []*dns.RRSIG
+
+		for _, rr := range in.Answer {
+			switch record := rr.(type) {
+			case *dns.DS:
+				rrset = append(rrset, record)
+				delegations = append(delegations, record)
+			case *dns.RRSIG:
+				// the DS records must be signed by the parent zone
+				if record.TypeCovered == dns.TypeDS && !strings.EqualFold(record.SignerName, zone) {
+					signatures = append(signatures, record)
+				}
+			}
+		}
+
+		if len(signatures) == 0 {
+			return nil, s.unsignedDelegationStatus(ctx, zone, rrset, in.Ns)
+		}
+
+		if status := s.validateRRset(ctx, rrset, signatures); status != DNSSECSecure {
+			return nil, status
+		}
+	}
+
+	in, err := s.queryDNSSEC(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, DNSSECIndeterminate
+	}
+
+	var keys []*dns.DNSKEY
+	var rrset []dns.RR
+	var signatures []*dns.RRSIG
+
+	for _, rr := range in.Answer {
+		switch record := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, record)
+			rrset = append(rrset, record)
+		case *dns.RRSIG:
+			if record.TypeCovered == dns.TypeDNSKEY {
+				signatures = append(signatures, record)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, DNSSECBogus
+	}
+
+	// the DNSKEY RRset must be signed by a key which matches one of the zone's DS records
+	for _, delegation := range delegations {
+		for _, key := range keys {
+			if key.KeyTag() != delegation.KeyTag || key.Algorithm != delegation.Algorithm {
+				continue
+			}
+
+			if ds := key.ToDS(delegation.DigestType); ds == nil || !strings.EqualFold(ds.Digest, delegation.Digest) {
+				continue
+			}
+
+			for _, sig := range signatures {
+				if sig.KeyTag == key.KeyTag() && sig.Verify(key, rrset) == nil && sig.ValidityPeriod(time.Now()) {
+					return keys, DNSSECSecure
+				}
+			}
+		}
+	}
+
+	return nil, DNSSECBogus
+}
+
+// unsignedStatus returns the status of an unsigned RRset. It's insecure if the
+// zone the RRset belongs to is provably unsigned, and bogus if the zone is
+// signed (as the signatures must have been stripped).
+func (s *Scanner) unsignedStatus(ctx context.Context, owner string) DNSSECStatus {
+	zone, err := s.findSigningZone(ctx, owner)
+	if err != nil {
+		return DNSSECIndeterminate
+	}
+
+	if _, status := s.getZoneKeys(ctx, zone); status != DNSSECSecure {
+		return status
+	}
+
+	return DNSSECBogus
+}
+
+// unsignedDelegationStatus returns the status of a zone whose DS records
+// weren't signed by its parent zone. The delegation is only insecure if the
+// parent zone is insecure, or the parent zone's NSEC or NSEC3 records in the
+// authority section prove that there are no DS records.
+func (s *Scanner) unsignedDelegationStatus(ctx context.Context, zone string, rrset, authority []dns.RR) DNSSECStatus {
+	parent, err := s.findSigningZone(ctx, parentName(zone))
+	if err != nil {
+		return DNSSECIndeterminate
+	}
+
+	if _, status := s.getZoneKeys(ctx, parent); status != DNSSECSecure {
+		return status
+	}
+
+	// the parent zone is signed, so its DS records must be too
+	if len(rrset) > 0 {
+		return DNSSECBogus
+	}
+
+	proofs := make(map[rrsetKey][]dns.RR)
+	signatures := make(map[rrsetKey][]*dns.RRSIG)
+
+	for _, rr := range authority {
+		name := dns.CanonicalName(rr.Header().Name)
+
+		switch record := rr.(type) {
+		case *dns.NSEC, *dns.NSEC3:
+			key := rrsetKey{name: name, rrtype: rr.Header().Rrtype}
+			proofs[key] = append(proofs[key], rr)
+		case *dns.RRSIG:
+			// the proof must be signed by the parent zone
+			if dns.CanonicalName(record.SignerName) == parent {
+				key := rrsetKey{name: name, rrtype: record.TypeCovered}
+				signatures[key] = append(signatures[key], record)
+			}
+		}
+	}
+
+	if len(proofs) == 0 {
+		return DNSSECIndeterminate
+	}
+
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+
+	for key, proof := range proofs {
+		if len(signatures[key]) == 0 {
+			return DNSSECBogus
+		}
+
+		if status := s.validateRRset(ctx, proof, signatures[key]); status != DNSSECSecure {
+			return status
+		}
+
+		for _, rr := range proof {
+			switch record := rr.(type) {
+			case *dns.NSEC:
+				nsecs = append(nsecs, record)
+			case *dns.NSEC3:
+				nsec3s = append(nsec3s, record)
+			}
+		}
+	}
+
+	return deniesDS(zone, parent, nsecs, nsec3s)
+}
+
+// deniesDS checks whether validated NSEC or NSEC3 records prove that a
+// delegation has no DS records, as described in RFC 4035 section 5.2 and RFC
+// 5155 section 8.6. It returns insecure if they do, bogus if they show that DS
+// records exist, and indeterminate if they don't cover the delegation.
+func deniesDS(zone, parent string, nsecs []*dns.NSEC, nsec3s []*dns.NSEC3) DNSSECStatus {
+	delegationStatus := func(types []uint16) DNSSECStatus {
+		if slices.Contains(types, dns.TypeDS) || slices.Contains(types, dns.TypeSOA) || !slices.Contains(types, dns.TypeNS) {
+			return DNSSECBogus
+		}
+
+		return DNSSECInsecure
+	}
+
+	for _, nsec := range nsecs {
+		if dns.CanonicalName(nsec.Hdr.Name) == zone {
+			return delegationStatus(nsec.TypeBitMap)
+		}
+	}
+
+	for _, nsec3 := range nsec3s {
+		if nsec3.Match(zone) {
+			return delegationStatus(nsec3.TypeBitMap)
+		}
+	}
+
+	// with opt-out, an unsigned delegation is covered by an NSEC3 record of the next closer name to the closest
+	// encloser, rather than having an NSEC3 record of its own
+	nextCloser := zone
+	for encloser := parentName(zone); dns.IsSubDomain(parent, encloser); encloser = parentName(encloser) {
+		for _, nsec3 := range nsec3s {
+			if !nsec3.Match(encloser) {
+				continue
+			}
+
+			for _, optOut := range nsec3s {
+				if optOut.Flags&1 == 1 && optOut.Cover(nextCloser) {
+					return DNSSECInsecure
+				}
+			}
+
+			return DNSSECIndeterminate
+		}
+
+		if encloser == "." {
+			break
+		}
+
+		nextCloser = encloser
+	}
+
+	return DNSSECIndeterminate
+}
+
+// findSigningZone is the same as findZone, but queries with the CD bit set, so
+// that the zone can still be found when its signatures don't validate.
+func (s *Scanner) findSigningZone(ctx context.Context, name string) (string, error) {
+	in, err := s.queryDNSSEC(ctx, name, dns.TypeSOA)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range append(slices.Clone(in.Answer), in.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok && dns.IsSubDomain(soa.Hdr.Name, name) {
+			return dns.CanonicalName(soa.Hdr.Name), nil
+		}
+	}
+
+	return "", fmt.Errorf("couldn't find the zone for %s", dns.Fqdn(name))
+}
+
+// isDNSSECFailure reports whether a validating nameserver indicated (via an
+// extended DNS error, as defined in RFC 8914) that it failed the query because
+// the answer didn't validate.
+func isDNSSECFailure(in *dns.Msg) bool {
+	opt := in.IsEdns0()
+	if opt == nil {
+		return false
+	}
+
+	for _, option := range opt.Option {
+		if ede, ok := option.(*dns.EDNS0_EDE); ok {
+			switch ede.InfoCode {
+			case dns.ExtendedErrorCodeDNSBogus, dns.ExtendedErrorCodeSignatureExpired, dns.ExtendedErrorCodeSignatureNotYetValid,
+				dns.ExtendedErrorCodeDNSKEYMissing, dns.ExtendedErrorCodeRRSIGsMissing, dns.ExtendedErrorCodeNoZoneKeyBitSet,
+				dns.ExtendedErrorCodeNSECMissing:
+				return true
+			}
+		}
+	}
+
+	return false
+}
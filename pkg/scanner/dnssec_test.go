@@ -0,0 +1,236 @@
+package scanner
+
+import (
+	"context"
+	"crypto"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignedZone returns the records of a zone signed with a single key, along
+// with the path to a trust anchor file for that key.
+func newSignedZone(t *testing.T, zone string, records ...string) ([]string, string) {
+	t.Helper()
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 300},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	privateKey, err := key.Generate(256)
+	require.NoError(t, err)
+
+	records = append(records, key.String())
+
+	rrsets := make(map[rrsetKey][]dns.RR)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+
+		setKey := rrsetKey{name: rr.Header().Name, rrtype: rr.Header().Rrtype}
+		rrsets[setKey] = append(rrsets[setKey], rr)
+	}
+
+	for _, rrset := range rrsets {
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Ttl: 300},
+			Algorithm:  key.Algorithm,
+			Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+			Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+			KeyTag:     key.KeyTag(),
+			SignerName: zone,
+		}
+		require.NoError(t, sig.Sign(privateKey.(crypto.Signer), rrset))
+
+		records = append(records, sig.String())
+	}
+
+	trustAnchor := filepath.Join(t.TempDir(), "anchor.zone")
+	require.NoError(t, os.WriteFile(trustAnchor, []byte(key.ToDS(dns.SHA256).String()+"\n"), 0o600))
+
+	return records, trustAnchor
+}
+
+func TestDNSSEC(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	zone := []string{
+		`example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 300`,
+		`example.com. 300 IN NS ns1.example.com.`,
+		`example.com. 300 IN MX 10 mail.example.com.`,
+		`example.com. 300 IN TXT "v=spf1 -all"`,
+	}
+
+	t.Run("Secure", func(t *testing.T) {
+		records, trustAnchor := newSignedZone(t, "example.com.", zone...)
+
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, records...)), WithDNSSECTrustAnchor(trustAnchor))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+		require.True(t, results[0].DNSSEC.Signed)
+		require.Equal(t, DNSSECSecure, results[0].DNSSEC.MX)
+		require.Equal(t, DNSSECSecure, results[0].DNSSEC.SPF)
+	})
+
+	t.Run("Bogus", func(t *testing.T) {
+		records, trustAnchor := newSignedZone(t, "example.com.", zone...)
+
+		// tamper with the SPF record after it was signed
+		resolver := newMockResolver(t, records...)
+		for _, rr := range resolver.records["example.com."] {
+			if txt, ok := rr.(*dns.TXT); ok {
+				txt.Txt = []string{"v=spf1 +all"}
+			}
+		}
+
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithDNSSECTrustAnchor(trustAnchor))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, DNSSECSecure, results[0].DNSSEC.MX)
+		require.Equal(t, DNSSECBogus, results[0].DNSSEC.SPF)
+	})
+
+	t.Run("StrippedSignatures", func(t *testing.T) {
+		records, trustAnchor := newSignedZone(t, "example.com.", zone...)
+
+		// remove the signatures over the SPF record, as an on-path attacker could
+		resolver := newMockResolver(t, records...)
+		resolver.records["example.com."] = slices.DeleteFunc(resolver.records["example.com."], func(rr dns.RR) bool {
+			sig, ok := rr.(*dns.RRSIG)
+			return ok && sig.TypeCovered == dns.TypeTXT
+		})
+
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithDNSSECTrustAnchor(trustAnchor))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, DNSSECSecure, results[0].DNSSEC.MX)
+		require.Equal(t, DNSSECBogus, results[0].DNSSEC.SPF)
+	})
+
+	t.Run("UnsignedDelegation", func(t *testing.T) {
+		delegation := []string{
+			`sub.example.com. 300 IN NS ns1.sub.example.com.`,
+			`sub.example.com. 300 IN NSEC www.example.com. NS RRSIG NSEC`,
+		}
+
+		subzone := []string{
+			`sub.example.com. 300 IN SOA ns1.sub.example.com. hostmaster.sub.example.com. 1 7200 3600 1209600 300`,
+			`sub.example.com. 300 IN TXT "v=spf1 -all"`,
+		}
+
+		for name, test := range map[string]struct {
+			delegation []string
+			expected   DNSSECStatus
+		}{
+			// the parent zone proves there are no DS records for the subzone
+			"Proven": {delegation: delegation, expected: DNSSECInsecure},
+			// the proof is missing, so the DS records could have been stripped
+			"Unproven": {delegation: delegation[:1], expected: DNSSECIndeterminate},
+			// the parent zone shows that there are DS records for the subzone, which have been stripped
+			"Stripped": {delegation: []string{`sub.example.com. 300 IN NSEC www.example.com. NS DS RRSIG NSEC`}, expected: DNSSECBogus},
+		} {
+			t.Run(name, func(t *testing.T) {
+				records, trustAnchor := newSignedZone(t, "example.com.", append(slices.Clone(zone), test.delegation...)...)
+
+				scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, append(records, subzone...)...)), WithDNSSECTrustAnchor(trustAnchor))
+				require.NoError(t, err)
+				defer scanner.Close()
+
+				results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{CheckDNSSEC, CheckSPF}}, "sub.example.com")
+				require.NoError(t, err)
+				require.Len(t, results, 1)
+				require.False(t, results[0].DNSSEC.Signed)
+				require.Equal(t, test.expected, results[0].DNSSEC.SPF)
+			})
+		}
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, zone...)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.False(t, results[0].DNSSEC.Signed)
+		require.Equal(t, DNSSECInsecure, results[0].DNSSEC.MX)
+		require.Equal(t, DNSSECInsecure, results[0].DNSSEC.SPF)
+	})
+
+	t.Run("Skipped", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, zone...)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{CheckSPF}}, "example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Nil(t, results[0].DNSSEC)
+	})
+}
+
+func TestDeniesDS(t *testing.T) {
+	nsec3 := func(name string, optOut bool, next string, types ...uint16) *dns.NSEC3 {
+		var flags uint8
+		if optOut {
+			flags = 1
+		}
+
+		return &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: dns.HashName(name, dns.SHA1, 0, "") + ".example.com.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			NextDomain: next,
+			TypeBitMap: types,
+		}
+	}
+
+	// an NSEC3 record which covers every hash other than its own, as the next hashed owner name wraps around to it
+	covering := func(name string, optOut bool) *dns.NSEC3 {
+		record := nsec3(name, optOut, "")
+		record.NextDomain = dns.HashName(name, dns.SHA1, 0, "")
+
+		return record
+	}
+
+	apex := nsec3("example.com.", false, "", dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM)
+
+	for name, test := range map[string]struct {
+		nsec3s   []*dns.NSEC3
+		expected DNSSECStatus
+	}{
+		"Matching":          {nsec3s: []*dns.NSEC3{nsec3("sub.example.com.", false, "", dns.TypeNS)}, expected: DNSSECInsecure},
+		"MatchingWithDS":    {nsec3s: []*dns.NSEC3{nsec3("sub.example.com.", false, "", dns.TypeNS, dns.TypeDS)}, expected: DNSSECBogus},
+		"OptOut":            {nsec3s: []*dns.NSEC3{apex, covering("example.com.", true)}, expected: DNSSECInsecure},
+		"CoveredNoOptOut":   {nsec3s: []*dns.NSEC3{apex, covering("example.com.", false)}, expected: DNSSECIndeterminate},
+		"NoClosestEncloser": {nsec3s: []*dns.NSEC3{covering("other.example.com.", true)}, expected: DNSSECIndeterminate},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, deniesDS("sub.example.com.", "example.com.", nil, test.nsec3s))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dohContentType is the media type for DNS wire format messages, as defined in RFC 8484.
+const dohContentType = "application/dns-message"
+
+// dohResolver is a Resolver that sends queries over HTTPS, as defined in RFC 8484.
+type dohResolver struct {
+	// client is shared by all goroutines the scanner spawns, so that HTTP/2
+	// connections to each resolver are reused.
+	client *http.Client
+
+	// method is the HTTP method used for queries (GET or POST).
+	method string
+
+	// nameservers rotates queries through the resolver URLs to issue queries against.
+	nameservers *nameserverPool
+}
+
+func newDoHResolver(timeout time.Duration, tlsConfig *tls.Config, method string, nameservers *nameserverPool, maxConns int) *dohResolver {
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		ForceAttemptHTTP2:   true, // required to negotiate HTTP/2 when a custom TLS config is set
+		MaxIdleConnsPerHost: maxConns,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: timeout,
+	}
+
+	return &dohResolver{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		method:      method,
+		nameservers: nameservers,
+	}
+}
+
+// Exchange sends a query to the next resolver URL in the rotation, failing
+// over to the next one if it fails.
+func (r *dohResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	return r.nameservers.exchange(ctx, func(ctx context.Context, nameserver string) (*Response, error) {
+		return r.query(ctx, req, nameserver)
+	})
+}
+
+// query sends a query to a single resolver URL.
+func (r *dohResolver) query(ctx context.Context, req *dns.Msg, nameserver string) (*Response, error) {
+	// RFC 8484 section 4.1 recommends an ID of 0, to make responses to GET requests more cache friendly
+	query := req.Copy()
+	query.Id = 0
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS query: %w", err)
+	}
+
+	httpReq, err := r.newRequest(ctx, nameserver, packed)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+
+	httpResp, err := r.client.Do(httpReq)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS query to %s failed with status %d", nameserver, httpResp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DNS-over-HTTPS response: %w", err)
+	}
+
+	in := new(dns.Msg)
+	if err = in.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to unpack DNS-over-HTTPS response: %w", err)
+	}
+
+	// restore the ID of the original query, so that callers can match the response to it
+	in.Id = req.Id
+
+	return &Response{
+		Msg:        in,
+		Nameserver: nameserver,
+		RTT:        time.Since(startTime),
+	}, nil
+}
+
+func (r *dohResolver) newRequest(ctx context.Context, nameserver string, packed []byte) (*http.Request, error) {
+	var httpReq *http.Request
+	var err error
+
+	switch r.method {
+	case http.MethodGet:
+		resolverURL, err := url.Parse(nameserver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolver URL: %w", err)
+		}
+
+		query := resolverURL.Query()
+		query.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+		resolverURL.RawQuery = query.Encode()
+
+		httpReq, err = http.NewRequestWithContext(ctx, http.MethodGet, resolverURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		httpReq, err = http.NewRequestWithContext(ctx, http.MethodPost, nameserver, bytes.NewReader(packed))
+		if err != nil {
+			return nil, err
+		}
+
+		httpReq.Header.Set("Content-Type", dohContentType)
+	}
+
+	httpReq.Header.Set("Accept", dohContentType)
+
+	return httpReq, nil
+}
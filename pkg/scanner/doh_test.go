@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// newDoHServer starts a local DNS-over-HTTPS stand-in which answers queries
+// using nameserver, and returns the path to its CA bundle.
+func newDoHServer(t *testing.T, nameserver *fakeDNS, http2Requests *atomic.Int32) (*httptest.Server, string) {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var packed []byte
+		var err error
+
+		switch r.Method {
+		case http.MethodGet:
+			packed, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != dohContentType {
+				http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			packed, err = io.ReadAll(r.Body)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := new(dns.Msg)
+		if err = req.Unpack(packed); err != nil || req.Id != 0 {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+
+		if r.ProtoMajor == 2 {
+			http2Requests.Add(1)
+		}
+
+		packed, _ = nameserver.answer(req).Pack()
+
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(packed)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	return server, bundle
+}
+
+func TestDoHResolver(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	nameserver := newFakeDNS(t, `example.com. 300 IN TXT "v=spf1 -all"`)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			var http2Requests atomic.Int32
+			server, bundle := newDoHServer(t, nameserver, &http2Requests)
+
+			scanner, err := New(logger, timeout,
+				WithDNSProtocol("https"),
+				WithDNSCABundle(bundle),
+				WithDNSHTTPMethod(method),
+				WithNameservers([]string{server.URL + "/dns-query"}),
+			)
+			require.NoError(t, err)
+			defer scanner.Close()
+
+			for i := 0; i < 3; i++ {
+				records, err := scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+				require.NoError(t, err)
+				require.Equal(t, []string{"v=spf1 -all"}, records)
+			}
+
+			require.Equal(t, int32(3), http2Requests.Load())
+		})
+	}
+
+	t.Run("UntrustedCertificate", func(t *testing.T) {
+		var http2Requests atomic.Int32
+		server, _ := newDoHServer(t, nameserver, &http2Requests)
+
+		scanner, err := New(logger, timeout, WithDNSProtocol("https"), WithNameservers([]string{server.URL + "/dns-query"}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+		require.ErrorContains(t, err, "certificate")
+	})
+}
@@ -0,0 +1,260 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// doqALPN is the ALPN token for DNS-over-QUIC, as defined in RFC 9250.
+	doqALPN = "doq"
+
+	// DNS-over-QUIC error codes, as defined in RFC 9250 section 4.3.
+	doqNoError          = 0x0
+	doqRequestCancelled = 0x3
+)
+
+type (
+	// doqResolver is a Resolver that sends queries over QUIC, as defined in RFC 9250.
+	doqResolver struct {
+		// connections holds one QUIC connection per nameserver, which is shared by all goroutines the scanner
+		// spawns. Each query is sent on its own stream.
+		connections map[string]*doqConnection
+
+		// connectionsMutex guards the connections map. It's never held while dialing, so that a slow nameserver
+		// doesn't hold up queries to the others.
+		connectionsMutex sync.Mutex
+
+		// nameservers rotates queries through the "host:port" strings of nameservers to issue queries against.
+		nameservers *nameserverPool
+
+		quicConfig *quic.Config
+		timeout    time.Duration
+		tlsConfig  *tls.Config
+	}
+
+	// doqConnection is a connection to a single nameserver, which may still be
+	// being dialed. Once ready is closed, either conn or err is set.
+	doqConnection struct {
+		conn  quic.EarlyConnection
+		err   error
+		ready chan struct{}
+	}
+)
+
+func newDoQResolver(timeout time.Duration, tlsConfig *tls.Config, nameservers *nameserverPool) *doqResolver {
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+
+	tlsConfig.NextProtos = []string{doqALPN}
+
+	// resuming sessions allows queries to be sent as 0-RTT data when reconnecting to a nameserver
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(len(nameservers.nameservers))
+
+	return &doqResolver{
+		connections: make(map[string]*doqConnection),
+		nameservers: nameservers,
+		quicConfig: &quic.Config{
+			HandshakeIdleTimeout: timeout,
+			MaxIdleTimeout:       30 * time.Second,
+		},
+		timeout:   timeout,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Close closes every open connection.
+func (r *doqResolver) Close() error {
+	r.connectionsMutex.Lock()
+	defer r.connectionsMutex.Unlock()
+
+	for nameserver, connection := range r.connections {
+		// connections which are still being dialed are left to time out
+		if connection.usable() {
+			_ = connection.conn.CloseWithError(doqNoError, "")
+		}
+
+		delete(r.connections, nameserver)
+	}
+
+	return nil
+}
+
+// Exchange sends a query to the next nameserver in the rotation, reusing the
+// existing connection to that nameserver if there is one, and failing over to
+// the next nameserver if it fails.
+func (r *doqResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	return r.nameservers.exchange(ctx, func(ctx context.Context, nameserver string) (*Response, error) {
+		return r.query(ctx, req, nameserver)
+	})
+}
+
+// query sends a query to a single nameserver.
+func (r *doqResolver) query(ctx context.Context, req *dns.Msg, nameserver string) (*Response, error) {
+	// RFC 9250 section 4.2.1 requires the message ID to be 0
+	query := req.Copy()
+	query.Id = 0
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS query: %w", err)
+	}
+
+	startTime := time.Now()
+
+	conn, err := r.getConnection(ctx, nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := r.exchange(ctx, conn, packed)
+	if err != nil && ctx.Err() == nil && conn.Context().Err() != nil {
+		// the shared connection was closed (such as by an idle timeout), so retry once with a fresh one
+		if conn, err = r.getConnection(ctx, nameserver); err != nil {
+			return nil, err
+		}
+
+		in, err = r.exchange(ctx, conn, packed)
+	}
+
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		return nil, err
+	}
+
+	// restore the ID of the original query, so that callers can match the response to it
+	in.Id = req.Id
+
+	return &Response{
+		Msg:        in,
+		Nameserver: nameserver,
+		RTT:        time.Since(startTime),
+	}, nil
+}
+
+// exchange sends a packed query on a new stream, as per RFC 9250 section 4.2.
+func (r *doqResolver) exchange(ctx context.Context, conn quic.EarlyConnection, packed []byte) (*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(r.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	if err = stream.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelRead(doqRequestCancelled)
+		stream.CancelWrite(doqRequestCancelled)
+	})
+	defer stop()
+
+	// each message is prefixed with its length, and the client must close the write side of the stream once sent
+	buf := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(buf, uint16(len(packed)))
+	copy(buf[2:], packed)
+
+	if _, err = stream.Write(buf); err != nil {
+		return nil, err
+	}
+
+	if err = stream.Close(); err != nil {
+		return nil, err
+	}
+
+	var length uint16
+	if err = binary.Read(stream, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("failed to read DNS-over-QUIC response length: %w", err)
+	}
+
+	body := make([]byte, length)
+	if _, err = io.ReadFull(stream, body); err != nil {
+		return nil, fmt.Errorf("failed to read DNS-over-QUIC response: %w", err)
+	}
+
+	in := new(dns.Msg)
+	if err = in.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to unpack DNS-over-QUIC response: %w", err)
+	}
+
+	return in, nil
+}
+
+// getConnection returns the open connection to the nameserver, dialing a new one if it doesn't exist or has been
+// closed. Concurrent queries to the same nameserver share a single dial.
+func (r *doqResolver) getConnection(ctx context.Context, nameserver string) (quic.EarlyConnection, error) {
+	for {
+		r.connectionsMutex.Lock()
+
+		connection, ok := r.connections[nameserver]
+		if !ok || connection.failed() {
+			connection = &doqConnection{ready: make(chan struct{})}
+			r.connections[nameserver] = connection
+			r.connectionsMutex.Unlock()
+
+			connection.conn, connection.err = quic.DialAddrEarly(ctx, nameserver, r.tlsConfig, r.quicConfig)
+			close(connection.ready)
+
+			return connection.conn, connection.err
+		}
+
+		r.connectionsMutex.Unlock()
+
+		select {
+		case <-connection.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if connection.usable() {
+			return connection.conn, nil
+		}
+
+		// the dial was only abandoned because its caller gave up, so try again with this query's context
+		if connection.err != nil && !errors.Is(connection.err, context.Canceled) && !errors.Is(connection.err, context.DeadlineExceeded) {
+			return nil, connection.err
+		}
+	}
+}
+
+// failed reports whether the connection has finished dialing, but can't be
+// used. Connections which are still being dialed haven't failed.
+func (c *doqConnection) failed() bool {
+	select {
+	case <-c.ready:
+		return !c.usable()
+	default:
+		return false
+	}
+}
+
+// usable reports whether the connection has been dialed successfully, and is
+// still open.
+func (c *doqConnection) usable() bool {
+	select {
+	case <-c.ready:
+		return c.err == nil && c.conn.Context().Err() == nil
+	default:
+		return false
+	}
+}
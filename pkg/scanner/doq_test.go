@@ -0,0 +1,233 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1, and
+// returns it along with the path to a CA bundle containing it.
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, bundle
+}
+
+// newDoQServer starts a local DNS-over-QUIC stand-in which answers queries
+// using nameserver, counting the connections it accepts and how many of those
+// used 0-RTT.
+func newDoQServer(t *testing.T, nameserver *fakeDNS, connections, earlyConnections *atomic.Int32) (string, string) {
+	t.Helper()
+
+	certificate, bundle := newTestCertificate(t)
+
+	listener, err := quic.ListenAddrEarly("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{doqALPN},
+	}, &quic.Config{Allow0RTT: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+
+			connections.Add(1)
+
+			go func() {
+				<-conn.HandshakeComplete()
+				if conn.ConnectionState().Used0RTT {
+					earlyConnections.Add(1)
+				}
+			}()
+
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+
+					go serveDoQStream(nameserver, stream)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), bundle
+}
+
+func serveDoQStream(nameserver *fakeDNS, stream quic.Stream) {
+	defer stream.Close()
+
+	// the client must close its side of the stream once the query has been sent
+	packed, err := io.ReadAll(stream)
+	if err != nil || len(packed) < 2 {
+		return
+	}
+
+	req := new(dns.Msg)
+	if err = req.Unpack(packed[2:]); err != nil || req.Id != 0 {
+		stream.CancelWrite(0x2)
+		return
+	}
+
+	body, _ := nameserver.answer(req).Pack()
+	buf := make([]byte, 2+len(body))
+	binary.BigEndian.PutUint16(buf, uint16(len(body)))
+	copy(buf[2:], body)
+
+	_, _ = stream.Write(buf)
+}
+
+func TestDoQResolver(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	nameserver := newFakeDNS(t, `example.com. 300 IN TXT "v=spf1 -all"`)
+
+	t.Run("ConnectionReuse", func(t *testing.T) {
+		var connections, earlyConnections atomic.Int32
+		address, bundle := newDoQServer(t, nameserver, &connections, &earlyConnections)
+
+		scanner, err := New(logger, timeout,
+			WithDNSProtocol("quic"),
+			WithDNSCABundle(bundle),
+			WithNameservers([]string{address}),
+		)
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		for i := 0; i < 5; i++ {
+			records, err := scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+			require.NoError(t, err)
+			require.Equal(t, []string{"v=spf1 -all"}, records)
+		}
+
+		require.Equal(t, int32(1), connections.Load())
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		var connections, earlyConnections atomic.Int32
+		address, bundle := newDoQServer(t, nameserver, &connections, &earlyConnections)
+
+		scanner, err := New(logger, timeout,
+			WithDNSProtocol("quic"),
+			WithDNSCABundle(bundle),
+			WithNameservers([]string{address}),
+		)
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+		require.NoError(t, err)
+
+		// drop the shared connection, which should be transparently replaced by one resumed with 0-RTT
+		require.NoError(t, scanner.resolver.(*doqResolver).Close())
+
+		records, err := scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, []string{"v=spf1 -all"}, records)
+		require.Equal(t, int32(2), connections.Load())
+		require.Eventually(t, func() bool { return earlyConnections.Load() == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("ConcurrentDials", func(t *testing.T) {
+		var connections, earlyConnections atomic.Int32
+		address, bundle := newDoQServer(t, nameserver, &connections, &earlyConnections)
+
+		scanner, err := New(logger, timeout,
+			WithDNSProtocol("quic"),
+			WithDNSCABundle(bundle),
+			WithNameservers([]string{address}),
+		)
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		// a nameserver which never completes the handshake
+		blackhole, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer blackhole.Close()
+
+		resolver := scanner.resolver.(*doqResolver)
+
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeTXT)
+
+		go func() { _, _ = resolver.query(context.Background(), req, blackhole.LocalAddr().String()) }()
+
+		require.Eventually(t, func() bool {
+			resolver.connectionsMutex.Lock()
+			defer resolver.connectionsMutex.Unlock()
+
+			_, ok := resolver.connections[blackhole.LocalAddr().String()]
+			return ok
+		}, time.Second, time.Millisecond)
+
+		// queries to other nameservers aren't held up while it's being dialed, and share a single connection
+		start := time.Now()
+		errs := make([]error, 5)
+
+		var wg sync.WaitGroup
+		for index := range errs {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, errs[index] = resolver.query(context.Background(), req, address)
+			}()
+		}
+
+		wg.Wait()
+
+		require.Less(t, time.Since(start), timeout/2)
+		require.Equal(t, make([]error, 5), errs)
+		require.Equal(t, int32(1), connections.Load())
+	})
+}
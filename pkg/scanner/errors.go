@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// The classes of DNS query failure, as reported by QueryError and CheckError.
+const (
+	// QueryErrorCancelled means the query was aborted because the scan was cancelled.
+	QueryErrorCancelled = "cancelled"
+
+	// QueryErrorNetwork means the query couldn't be sent or its response couldn't be read, such as when a
+	// nameserver is unreachable.
+	QueryErrorNetwork = "network"
+
+	// QueryErrorRcode means the nameserver responded with an error rcode, such as SERVFAIL or REFUSED.
+	QueryErrorRcode = "rcode"
+
+	// QueryErrorTimeout means the nameserver didn't respond before the query (or scan) timed out.
+	QueryErrorTimeout = "timeout"
+)
+
+type (
+	// QueryError is returned when a DNS query fails, and describes which query
+	// failed and why.
+	QueryError struct {
+		// Name is the name that was queried.
+		Name string
+
+		// Type is the record type that was queried, such as TXT.
+		Type string
+
+		// Class is the class of failure, such as QueryErrorTimeout.
+		Class string
+
+		// Rcode is the rcode the nameserver responded with, if Class is QueryErrorRcode.
+		Rcode string
+
+		// Nameserver is the nameserver which failed, if it's known.
+		Nameserver string
+
+		// Err is the underlying error, if Class isn't QueryErrorRcode.
+		Err error
+	}
+
+	// CheckError is an error encountered by one of the checks run against a
+	// domain. Errors from DNS queries carry the details of the query that
+	// failed, so that failed lookups can be told apart from missing records.
+	CheckError struct {
+		Check      string `json:"check" yaml:"check" doc:"The check which failed, such as dkim or spf." example:"spf"`
+		Name       string `json:"name,omitempty" yaml:"name,omitempty" doc:"The name that was queried, if a DNS query failed." example:"example.com."`
+		RecordType string `json:"recordType,omitempty" yaml:"recordType,omitempty" doc:"The record type that was queried, if a DNS query failed." example:"TXT"`
+		Class      string `json:"class,omitempty" yaml:"class,omitempty" doc:"The class of DNS query failure (rcode, timeout, network or cancelled)." example:"rcode"`
+		Rcode      string `json:"rcode,omitempty" yaml:"rcode,omitempty" doc:"The rcode the nameserver responded with, if it responded with an error." example:"SERVFAIL"`
+		Nameserver string `json:"nameserver,omitempty" yaml:"nameserver,omitempty" doc:"The nameserver which failed, if it's known." example:"8.8.8.8:53"`
+		Message    string `json:"message" yaml:"message" doc:"A description of the error." example:"TXT query for example.com. failed with rcode SERVFAIL"`
+	}
+
+	// nameserverError records which nameserver a failed query was sent to.
+	nameserverError struct {
+		nameserver string
+		err        error
+	}
+)
+
+func (e *QueryError) Error() string {
+	message := e.Type + " query for " + e.Name
+	if e.Nameserver != "" {
+		message += " to " + e.Nameserver
+	}
+
+	if e.Class == QueryErrorRcode {
+		return message + " failed with rcode " + e.Rcode
+	}
+
+	return message + " failed: " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+func (e *nameserverError) Error() string {
+	return e.err.Error()
+}
+
+func (e *nameserverError) Unwrap() error {
+	return e.err
+}
+
+// newQueryError wraps an error returned by the resolver, classifying it and
+// noting which nameserver failed.
+func newQueryError(name, recordType string, err error) *QueryError {
+	queryErr := &QueryError{
+		Name:  name,
+		Type:  recordType,
+		Class: QueryErrorNetwork,
+		Err:   err,
+	}
+
+	var nsErr *nameserverError
+	if errors.As(err, &nsErr) {
+		queryErr.Nameserver = nsErr.nameserver
+		queryErr.Err = nsErr.err
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		queryErr.Class = QueryErrorCancelled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		queryErr.Class = QueryErrorTimeout
+	}
+
+	return queryErr
+}
+
+// newCheckErrors converts an error returned by a check into structured
+// errors, splitting up errors which were joined together (such as one per
+// DKIM selector).
+func newCheckErrors(check string, err error) []*CheckError {
+	if err == nil {
+		return nil
+	}
+
+	// only split errors joined by errors.Join, so that wrapped errors (which add context) keep their message
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var checkErrs []*CheckError
+		for _, err := range joined.Unwrap() {
+			checkErrs = append(checkErrs, newCheckErrors(check, err)...)
+		}
+
+		return checkErrs
+	}
+
+	checkErr := &CheckError{
+		Check:   check,
+		Message: err.Error(),
+	}
+
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		checkErr.Name = queryErr.Name
+		checkErr.RecordType = queryErr.Type
+		checkErr.Class = queryErr.Class
+		checkErr.Rcode = queryErr.Rcode
+		checkErr.Nameserver = queryErr.Nameserver
+	}
+
+	return []*CheckError{checkErr}
+}
+
+// String returns the error in the "check:message" format used by Result.Error.
+func (e *CheckError) String() string {
+	return fmt.Sprintf("%s:%s", e.Check, e.Message)
+}
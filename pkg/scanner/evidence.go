@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type (
+	// DNSEvidence is a record of a single DNS query made while scanning a
+	// domain, and exactly what was returned for it, so that the results (and
+	// any advice based on them) can be reproduced.
+	DNSEvidence struct {
+		Name       string               `json:"name" yaml:"name" doc:"The name that was queried." example:"example.com."`
+		Type       string               `json:"type" yaml:"type" doc:"The record type that was queried." example:"TXT"`
+		Nameserver string               `json:"nameserver,omitempty" yaml:"nameserver,omitempty" doc:"The nameserver which responded (or failed), if it's known." example:"8.8.8.8:53"`
+		Rcode      string               `json:"rcode,omitempty" yaml:"rcode,omitempty" doc:"The rcode of the response." example:"NOERROR"`
+		AD         bool                 `json:"ad,omitempty" yaml:"ad,omitempty" doc:"Whether the AD (authenticated data) flag was set on the response."`
+		TC         bool                 `json:"tc,omitempty" yaml:"tc,omitempty" doc:"Whether the TC (truncated) flag was set on the response."`
+		TCP        bool                 `json:"tcp,omitempty" yaml:"tcp,omitempty" doc:"Whether the UDP response was truncated, so the query had to be retried over TCP."`
+		LatencyMS  float64              `json:"latencyMs" yaml:"latencyMs" doc:"How long the query took in milliseconds, including any retries." example:"12.5"`
+		CNAMEChain []string             `json:"cnameChain,omitempty" yaml:"cnameChain,omitempty" doc:"The CNAME targets followed from the queried name, in order." example:"example.net."`
+		Answer     []*DNSEvidenceRecord `json:"answer,omitempty" yaml:"answer,omitempty" doc:"The records in the answer section of the response."`
+		Authority  []*DNSEvidenceRecord `json:"authority,omitempty" yaml:"authority,omitempty" doc:"The records in the authority section of the response, such as the SOA record of a negative answer."`
+		Error      string               `json:"error,omitempty" yaml:"error,omitempty" doc:"Why the query failed, if it did." example:"TXT query for example.com. to 8.8.8.8:53 failed: i/o timeout"`
+	}
+
+	// DNSEvidenceRecord is a single resource record returned in a DNS response.
+	DNSEvidenceRecord struct {
+		Name string `json:"name" yaml:"name" doc:"The owner name of the record." example:"example.com."`
+		Type string `json:"type" yaml:"type" doc:"The type of the record." example:"TXT"`
+		TTL  uint32 `json:"ttl" yaml:"ttl" doc:"The TTL of the record in seconds, as returned by the nameserver." example:"300"`
+		Data string `json:"data" yaml:"data" doc:"The RDATA of the record, in presentation format." example:"\"v=spf1 -all\""`
+	}
+)
+
+// newDNSEvidence records the outcome of a query sent to the resolver.
+func newDNSEvidence(req *dns.Msg, resp *Response, err error, latency time.Duration) *DNSEvidence {
+	question := req.Question[0]
+
+	evidence := &DNSEvidence{
+		Name:      question.Name,
+		Type:      dns.TypeToString[question.Qtype],
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		queryErr := newQueryError(evidence.Name, evidence.Type, err)
+		evidence.Nameserver = queryErr.Nameserver
+		evidence.Error = queryErr.Error()
+
+		return evidence
+	}
+
+	msg := resp.Msg
+
+	evidence.Nameserver = resp.Nameserver
+	evidence.Rcode = dns.RcodeToString[msg.Rcode]
+	evidence.AD = msg.AuthenticatedData
+	evidence.TC = msg.Truncated
+	evidence.TCP = resp.TCPFallback
+	evidence.CNAMEChain = cnameChain(question.Name, msg.Answer)
+	evidence.Answer = newDNSEvidenceRecords(msg.Answer)
+	evidence.Authority = newDNSEvidenceRecords(msg.Ns)
+
+	return evidence
+}
+
+// newDNSEvidenceRecords converts the records from a section of a response.
+func newDNSEvidenceRecords(rrs []dns.RR) []*DNSEvidenceRecord {
+	var records []*DNSEvidenceRecord
+
+	for _, rr := range rrs {
+		header := rr.Header()
+
+		records = append(records, &DNSEvidenceRecord{
+			Name: header.Name,
+			Type: dns.TypeToString[header.Rrtype],
+			TTL:  header.Ttl,
+			Data: rdata(rr),
+		})
+	}
+
+	return records
+}
+
+// rdata returns the RDATA of a record in presentation format.
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// cnameChain returns the CNAME targets followed from name within an answer.
+func cnameChain(name string, answer []dns.RR) []string {
+	var chain []string
+
+	for range maxCNAMEHops {
+		var next string
+
+		for _, rr := range answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+				next = cname.Target
+				break
+			}
+		}
+
+		if next == "" {
+			break
+		}
+
+		chain = append(chain, next)
+		name = next
+	}
+
+	return chain
+}
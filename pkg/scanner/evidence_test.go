@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanEvidence(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := &failingResolver{
+		Resolver: newMockResolver(t,
+			`example.com. 300 IN NS ns1.example.com.`,
+			`example.com. 300 IN TXT "v=spf1 -all"`,
+			`custom._domainkey.example.com. 600 IN CNAME custom.dkim.example.net.`,
+			`custom.dkim.example.net. 60 IN TXT "v=DKIM1; k=rsa; p=MIIB"`,
+		),
+		rcodes: map[string]int{
+			"_dmarc.example.com.": dns.RcodeServerFailure,
+		},
+	}
+
+	// findEvidence returns the first query made for name and recordType
+	findEvidence := func(t *testing.T, result *Result, name, recordType string) *DNSEvidence {
+		t.Helper()
+
+		for _, evidence := range result.Evidence {
+			if evidence.Name == name && evidence.Type == recordType {
+				return evidence
+			}
+		}
+
+		require.Failf(t, "missing evidence", "no evidence for %s %s", name, recordType)
+
+		return nil
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Empty(t, results[0].Evidence)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithEvidence(true), WithDKIMSelectors("custom"))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+
+		result := results[0]
+
+		evidence := findEvidence(t, result, "example.com.", "TXT")
+		require.Equal(t, "mock", evidence.Nameserver)
+		require.Equal(t, "NOERROR", evidence.Rcode)
+		require.Equal(t, []*DNSEvidenceRecord{
+			{Name: "example.com.", Type: "TXT", TTL: 300, Data: `"v=spf1 -all"`},
+		}, evidence.Answer)
+
+		evidence = findEvidence(t, result, "custom._domainkey.example.com.", "TXT")
+		require.Equal(t, []string{"custom.dkim.example.net."}, evidence.CNAMEChain)
+		require.Equal(t, []*DNSEvidenceRecord{
+			{Name: "custom._domainkey.example.com.", Type: "CNAME", TTL: 600, Data: "custom.dkim.example.net."},
+		}, evidence.Answer)
+
+		// the CNAME target is looked up with its own query
+		evidence = findEvidence(t, result, "custom.dkim.example.net.", "TXT")
+		require.Equal(t, uint32(60), evidence.Answer[0].TTL)
+
+		evidence = findEvidence(t, result, "_dmarc.example.com.", "TXT")
+		require.Equal(t, "SERVFAIL", evidence.Rcode)
+		require.Empty(t, evidence.Answer)
+
+		evidence = findEvidence(t, result, "google._domainkey.example.com.", "TXT")
+		require.Equal(t, "NXDOMAIN", evidence.Rcode)
+	})
+
+	t.Run("PerScan", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithCacheDuration(time.Minute))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Empty(t, results[0].Evidence)
+
+		// results without evidence aren't served from the cache when evidence is requested
+		results, err = scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{CheckSPF}, Evidence: true}, "example.com")
+		require.NoError(t, err)
+		require.NotEmpty(t, results[0].Evidence)
+
+		for _, evidence := range results[0].Evidence {
+			require.NotEqual(t, "_dmarc.example.com.", evidence.Name)
+		}
+	})
+}
+
+func TestCNAMEChain(t *testing.T) {
+	var answer []dns.RR
+	for _, record := range []string{
+		`a.example.com. 300 IN CNAME b.example.net.`,
+		`b.example.net. 300 IN CNAME c.example.org.`,
+		`c.example.org. 300 IN TXT "v=spf1 -all"`,
+	} {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+
+		answer = append(answer, rr)
+	}
+
+	require.Equal(t, []string{"b.example.net.", "c.example.org."}, cnameChain("a.example.com.", answer))
+	require.Empty(t, cnameChain("c.example.org.", answer))
+}
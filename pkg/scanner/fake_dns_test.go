@@ -0,0 +1,249 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDNS answers queries from a fixed set of records, as a nameserver would.
+// The tests' stand-in nameservers all answer through it, whatever transport
+// they use, so each of them only sets the behaviour that's specific to it.
+type fakeDNS struct {
+	*mockResolver
+
+	// queries counts the queries received, when it's set.
+	queries *atomic.Int32
+
+	// rcode is returned for every query instead of the records, when it's set.
+	rcode int
+
+	// drop ignores every query, so that it times out.
+	drop bool
+
+	// maxUDPSize truncates UDP responses larger than it, when it's set.
+	maxUDPSize int
+
+	// zones are the zones the nameserver answers authoritatively for, when
+	// it's set. Queries for names outside of them are refused, and the SOA
+	// record (with serial) is returned for the apex of each zone, and in the
+	// authority section of negative answers. NS records below a zone's apex
+	// delegate the names beneath them, so queries for those names are
+	// answered with a referral (including glue for any nameservers with
+	// address records).
+	zones  []string
+	serial uint32
+}
+
+func newFakeDNS(t *testing.T, records ...string) *fakeDNS {
+	t.Helper()
+
+	return &fakeDNS{mockResolver: newMockResolver(t, records...)}
+}
+
+// answer returns the response to req, or nil if it should be dropped.
+func (f *fakeDNS) answer(req *dns.Msg) *dns.Msg {
+	if f.queries != nil {
+		f.queries.Add(1)
+	}
+
+	if f.drop {
+		return nil
+	}
+
+	if f.rcode != dns.RcodeSuccess {
+		resp := new(dns.Msg)
+		resp.SetRcode(req, f.rcode)
+
+		return resp
+	}
+
+	resp, _ := f.Exchange(context.Background(), req)
+	if len(f.zones) == 0 {
+		return resp.Msg
+	}
+
+	question := req.Question[0]
+	name := dns.CanonicalName(question.Name)
+
+	zone := ""
+	for _, candidate := range f.zones {
+		if dns.IsSubDomain(candidate, name) && len(candidate) > len(zone) {
+			zone = candidate
+		}
+	}
+
+	if zone == "" {
+		resp.Msg.Answer = nil
+		resp.Msg.Rcode = dns.RcodeRefused
+
+		return resp.Msg
+	}
+
+	// refer queries at or below a delegation to its nameservers
+	for cut := name; cut != zone; cut = parentName(cut) {
+		var ns []dns.RR
+		for _, rr := range f.records[cut] {
+			if rr.Header().Rrtype == dns.TypeNS {
+				ns = append(ns, rr)
+			}
+		}
+
+		if len(ns) == 0 {
+			continue
+		}
+
+		referral := new(dns.Msg)
+		referral.SetReply(req)
+		referral.Ns = ns
+
+		for _, rr := range ns {
+			for _, glue := range f.records[rr.(*dns.NS).Ns] {
+				if glue.Header().Rrtype == dns.TypeA {
+					referral.Extra = append(referral.Extra, glue)
+				}
+			}
+		}
+
+		return referral
+	}
+
+	resp.Msg.Authoritative = true
+
+	soa := &dns.SOA{
+		Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:     "ns1." + zone,
+		Mbox:   "hostmaster." + zone,
+		Serial: f.serial,
+	}
+
+	if name == zone {
+		resp.Msg.Rcode = dns.RcodeSuccess
+
+		if question.Qtype == dns.TypeSOA {
+			resp.Msg.Answer = append(resp.Msg.Answer, soa)
+		}
+	}
+
+	if len(resp.Msg.Answer) == 0 {
+		resp.Msg.Ns = append(resp.Msg.Ns, soa)
+	}
+
+	return resp.Msg
+}
+
+func (f *fakeDNS) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := f.answer(req)
+	if resp == nil {
+		return
+	}
+
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok && f.maxUDPSize > 0 {
+		resp.Truncate(f.maxUDPSize)
+	}
+
+	_ = w.WriteMsg(resp)
+}
+
+// listen serves f on 127.0.0.1 over each of networks (udp or tcp), all on the
+// same port, until the test finishes. It listens over UDP if no networks are
+// given, and returns the address it's listening on.
+func (f *fakeDNS) listen(t *testing.T, networks ...string) string {
+	t.Helper()
+
+	if len(networks) == 0 {
+		networks = []string{"udp"}
+	}
+
+	address := "127.0.0.1:0"
+
+	for _, network := range networks {
+		server := &dns.Server{Handler: f}
+
+		if network == "tcp" {
+			listener, err := net.Listen(network, address)
+			require.NoError(t, err)
+
+			server.Listener = listener
+			address = listener.Addr().String()
+		} else {
+			conn, err := net.ListenPacket(network, address)
+			require.NoError(t, err)
+
+			server.PacketConn = conn
+			address = conn.LocalAddr().String()
+		}
+
+		startDNSServer(t, server)
+	}
+
+	return address
+}
+
+// startDNSServer starts server, and shuts it down once the test finishes.
+func startDNSServer(t *testing.T, server *dns.Server) {
+	t.Helper()
+
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	<-started
+}
+
+// newFakeAuthoritativeServers starts a local UDP nameserver for each handler,
+// on consecutive loopback addresses starting at 127.0.0.2, all listening on the
+// same port (as authoritative nameservers do). It returns the port.
+func newFakeAuthoritativeServers(t *testing.T, handlers ...dns.Handler) string {
+	t.Helper()
+
+	for range 10 {
+		conns, port := listenLoopbacks(len(handlers))
+		if conns == nil {
+			continue
+		}
+
+		for index, conn := range conns {
+			startDNSServer(t, &dns.Server{PacketConn: conn, Handler: handlers[index]})
+		}
+
+		return port
+	}
+
+	t.Fatal("couldn't find a free port on the loopback addresses")
+
+	return ""
+}
+
+// listenLoopbacks listens on the same UDP port on count loopback addresses,
+// returning nil if the port is taken on any of them.
+func listenLoopbacks(count int) ([]net.PacketConn, string) {
+	first, err := net.ListenPacket("udp", "127.0.0.2:0")
+	if err != nil {
+		return nil, ""
+	}
+
+	_, port, _ := net.SplitHostPort(first.LocalAddr().String())
+	conns := []net.PacketConn{first}
+
+	for index := 1; index < count; index++ {
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(net.IPv4(127, 0, 0, byte(2+index)).String(), port))
+		if err != nil {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+
+			return nil, ""
+		}
+
+		conns = append(conns, conn)
+	}
+
+	return conns, port
+}
@@ -0,0 +1,383 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"github.com/miekg/dns"
+)
+
+const (
+	// iterativeDelegationCacheDuration caps how long a delegation is cached for, regardless of its TTL.
+	iterativeDelegationCacheDuration = time.Hour
+
+	// iterativeMaxDepth is how many nested resolutions (for nameservers without glue, or CNAME targets) a single
+	// query may trigger, so that delegations which depend on each other can't recurse forever.
+	iterativeMaxDepth = 8
+
+	// iterativeMaxNameserverLookups is how many nameservers without glue are resolved for each referral, as each
+	// needs its own resolution.
+	iterativeMaxNameserverLookups = 3
+
+	// iterativeMaxQueries is the most queries a single resolution may send, including those for nested
+	// resolutions, so that long or looping delegation chains fail rather than running away.
+	iterativeMaxQueries = 64
+)
+
+// defaultRootHints are the IPv4 addresses of the root servers (a.root-servers.net
+// to m.root-servers.net), from https://www.internic.net/domain/named.root.
+var defaultRootHints = []string{
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+// errQueryBudgetExhausted is returned when a resolution sends more queries than
+// it's allowed to.
+var errQueryBudgetExhausted = fmt.Errorf("iterative resolution exceeded its budget of %d queries", iterativeMaxQueries)
+
+type (
+	// iterativeResolver is a Resolver which doesn't rely on a recursive
+	// resolver. Instead, it resolves each query itself by starting at the root
+	// servers and following referrals down to the authoritative nameservers,
+	// caching the delegations it learns along the way.
+	iterativeResolver struct {
+		// delegations caches the nameservers each zone is delegated to, keyed by zone.
+		delegations *cache.Cache[delegation]
+
+		// port is the port every nameserver (other than the root hints) is queried on.
+		port string
+
+		// query sends a query to a single nameserver, retrying truncated responses over TCP.
+		query func(ctx context.Context, req *dns.Msg, nameserver string) (*Response, error)
+
+		// roots holds the "host:port" addresses of the root servers.
+		roots []string
+	}
+
+	// delegation is the set of nameservers a zone is delegated to.
+	delegation struct {
+		// expires is when the delegation's TTL runs out.
+		expires time.Time
+
+		// servers holds the "host:port" addresses of the zone's nameservers.
+		servers []string
+	}
+
+	// iterativeBudget tracks the queries left for a single call to Exchange,
+	// which are shared with any nested resolutions it triggers.
+	iterativeBudget struct {
+		queries int
+	}
+)
+
+// newIterativeResolver creates an iterative resolver, which sends queries
+// using client, starting at the given root servers and querying every other
+// nameserver on port.
+func newIterativeResolver(client *dns.Client, roots []string, port string, delegations *cache.Cache[delegation]) *iterativeResolver {
+	resolver := newDNSResolver(client, nil)
+
+	return &iterativeResolver{
+		delegations: delegations,
+		port:        port,
+		query:       resolver.query,
+		roots:       roots,
+	}
+}
+
+// Exchange resolves the query iteratively, starting from the closest
+// delegation that's been cached (or the root servers). The response's
+// Nameserver is the authoritative nameserver which gave the final answer.
+func (r *iterativeResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	if len(req.Question) != 1 {
+		return nil, errors.New("iterative resolution requires exactly one question")
+	}
+
+	resp, err := r.resolve(ctx, req, req.Question[0], &iterativeBudget{queries: iterativeMaxQueries}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Msg.Id = req.Id
+	resp.Msg.Question = req.Question
+	resp.Msg.RecursionDesired = req.RecursionDesired
+	resp.Msg.RecursionAvailable = true
+
+	return resp, nil
+}
+
+// resolve resolves a single question, following referrals from the closest
+// known delegation, and chasing any CNAME in the final answer.
+func (r *iterativeResolver) resolve(ctx context.Context, req *dns.Msg, question dns.Question, budget *iterativeBudget, depth int) (*Response, error) {
+	if depth > iterativeMaxDepth {
+		return nil, fmt.Errorf("iterative resolution of %s exceeded the maximum depth of %d", question.Name, iterativeMaxDepth)
+	}
+
+	zone, servers := r.closestDelegation(question)
+
+	for {
+		resp, err := r.queryServers(ctx, req, question, zone, servers, budget)
+		if err != nil {
+			return nil, err
+		}
+
+		msg := resp.Msg
+
+		child, ns, ttl := referral(msg, zone, question.Name)
+		if child == "" {
+			return r.chaseCNAME(ctx, req, question, resp, budget, depth)
+		}
+
+		servers, err = r.referralServers(ctx, req, msg, zone, ns, budget, depth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to follow the referral to %s: %w", child, err)
+		}
+
+		r.delegations.Set(child, &delegation{
+			expires: time.Now().Add(time.Duration(ttl) * time.Second),
+			servers: servers,
+		})
+
+		zone = child
+	}
+}
+
+// closestDelegation returns the deepest cached delegation which the question
+// falls under, falling back to the root servers. DS records are served by the
+// parent of the zone they belong to, so the search for those starts at the
+// parent of the name.
+func (r *iterativeResolver) closestDelegation(question dns.Question) (string, []string) {
+	name := dns.Fqdn(strings.ToLower(question.Name))
+	if question.Qtype == dns.TypeDS && name != "." {
+		name = parentName(name)
+	}
+
+	for ; name != "."; name = parentName(name) {
+		if cached := r.delegations.Get(name); cached != nil && time.Now().Before(cached.expires) {
+			return name, cached.servers
+		}
+	}
+
+	return ".", r.roots
+}
+
+// queryServers sends the question to each of a zone's nameservers in turn,
+// until one of them gives a usable response. Nameservers which time out,
+// return SERVFAIL or REFUSED, or are lame (responding without authority or a
+// referral further down the tree) are skipped.
+func (r *iterativeResolver) queryServers(ctx context.Context, req *dns.Msg, question dns.Question, zone string, servers []string, budget *iterativeBudget) (*Response, error) {
+	var lastErr error
+	var lastResp *Response
+
+	for _, server := range servers {
+		if budget.queries <= 0 {
+			return nil, errQueryBudgetExhausted
+		}
+
+		budget.queries--
+
+		msg := req.Copy()
+		msg.Id = dns.Id()
+		msg.RecursionDesired = false
+		msg.Question = []dns.Question{question}
+
+		resp, err := r.query(ctx, msg, server)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			lastErr = &nameserverError{nameserver: server, err: err}
+			continue
+		}
+
+		lastResp = resp
+
+		if resp.Msg.Rcode != dns.RcodeSuccess && resp.Msg.Rcode != dns.RcodeNameError {
+			continue
+		}
+
+		if child, _, _ := referral(resp.Msg, zone, question.Name); child != "" || resp.Msg.Authoritative || len(resp.Msg.Answer) > 0 {
+			return resp, nil
+		}
+	}
+
+	if lastResp != nil {
+		// none of the nameservers are authoritative for the zone, so answer as recursive resolvers do
+		if lastResp.Msg.Rcode == dns.RcodeSuccess || lastResp.Msg.Rcode == dns.RcodeNameError {
+			lastResp.Msg.Rcode = dns.RcodeServerFailure
+			lastResp.Msg.Answer, lastResp.Msg.Ns = nil, nil
+		}
+
+		return lastResp, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return nil, errors.New("no nameservers to query")
+}
+
+// referralServers returns the addresses of the nameservers a referral points
+// to. Glue records are only trusted for nameservers within the zone that gave
+// the referral, and the addresses of any other nameservers are resolved (up to
+// a limit) if there's no usable glue.
+func (r *iterativeResolver) referralServers(ctx context.Context, req *dns.Msg, msg *dns.Msg, zone string, ns []string, budget *iterativeBudget, depth int) ([]string, error) {
+	var servers, servers6 []string
+
+	for _, rr := range msg.Extra {
+		host := strings.ToLower(rr.Header().Name)
+		if !dns.IsSubDomain(zone, host) || !slices.Contains(ns, host) {
+			continue
+		}
+
+		switch glue := rr.(type) {
+		case *dns.A:
+			servers = append(servers, net.JoinHostPort(glue.A.String(), r.port))
+		case *dns.AAAA:
+			servers6 = append(servers6, net.JoinHostPort(glue.AAAA.String(), r.port))
+		}
+	}
+
+	// IPv6 glue is only used as a fallback, as not every network can reach IPv6 nameservers
+	if len(servers) == 0 {
+		servers = servers6
+	}
+
+	if len(servers) > 0 {
+		return servers, nil
+	}
+
+	var errs []error
+
+	for index, host := range ns {
+		if index >= iterativeMaxNameserverLookups {
+			break
+		}
+
+		lookup := new(dns.Msg)
+		lookup.SetEdns0(4096, false)
+
+		resp, err := r.resolve(ctx, lookup, dns.Question{Name: host, Qtype: dns.TypeA, Qclass: dns.ClassINET}, budget, depth+1)
+		if err != nil {
+			if errors.Is(err, errQueryBudgetExhausted) || ctx.Err() != nil {
+				return nil, err
+			}
+
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, rr := range resp.Msg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				servers = append(servers, net.JoinHostPort(a.A.String(), r.port))
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+
+		return nil, errors.New("none of the nameservers resolve to an address")
+	}
+
+	return servers, nil
+}
+
+// chaseCNAME follows a CNAME chain in an answer which doesn't include the
+// records for its final target, resolving the target and appending its answer
+// (as a recursive resolver would).
+func (r *iterativeResolver) chaseCNAME(ctx context.Context, req *dns.Msg, question dns.Question, resp *Response, budget *iterativeBudget, depth int) (*Response, error) {
+	msg := resp.Msg
+	if msg.Rcode != dns.RcodeSuccess || question.Qtype == dns.TypeCNAME {
+		return resp, nil
+	}
+
+	chain := cnameChain(question.Name, msg.Answer)
+	if len(chain) == 0 {
+		return resp, nil
+	}
+
+	target := chain[len(chain)-1]
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype == question.Qtype && strings.EqualFold(rr.Header().Name, target) {
+			return resp, nil
+		}
+	}
+
+	targetResp, err := r.resolve(ctx, req, dns.Question{Name: target, Qtype: question.Qtype, Qclass: question.Qclass}, budget, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Answer = append(msg.Answer, targetResp.Msg.Answer...)
+	msg.Ns = targetResp.Msg.Ns
+	msg.Rcode = targetResp.Msg.Rcode
+	msg.Authoritative = msg.Authoritative && targetResp.Msg.Authoritative
+	resp.Nameserver = targetResp.Nameserver
+	resp.TCPFallback = resp.TCPFallback || targetResp.TCPFallback
+
+	return resp, nil
+}
+
+// referral returns the zone a response refers the query to, along with its
+// nameservers and the lowest TTL of their NS records. It returns an empty zone
+// if the response isn't a referral to a zone below the current one and above
+// (or at) the name being queried, which rules out referrals that go sideways or
+// back up the tree.
+func referral(msg *dns.Msg, zone, name string) (child string, ns []string, ttl uint32) {
+	if msg.Rcode != dns.RcodeSuccess || len(msg.Answer) > 0 || msg.Authoritative {
+		return "", nil, 0
+	}
+
+	for _, rr := range msg.Ns {
+		record, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(record.Hdr.Name)
+		if owner == zone || !dns.IsSubDomain(zone, owner) || !dns.IsSubDomain(owner, strings.ToLower(name)) {
+			continue
+		}
+
+		if child == "" {
+			child, ttl = owner, record.Hdr.Ttl
+		}
+
+		if owner == child {
+			ns = append(ns, strings.ToLower(record.Ns))
+			ttl = min(ttl, record.Hdr.Ttl)
+		}
+	}
+
+	return child, ns, ttl
+}
+
+// parentName returns the parent of a fully-qualified name.
+func parentName(name string) string {
+	if index, end := dns.NextLabel(name, 0); !end {
+		return name[index:]
+	}
+
+	return "."
+}
@@ -0,0 +1,186 @@
+package scanner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterativeResolver(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 2
+
+	var rootQueries, comQueries, authQueries, lameQueries atomic.Int32
+
+	port := newFakeAuthoritativeServers(t,
+		// 127.0.0.2 is the root server
+		&fakeDNS{
+			mockResolver: newMockResolver(t,
+				`com. 86400 IN NS ns.com.`,
+				`ns.com. 86400 IN A 127.0.0.3`,
+			),
+			queries: &rootQueries,
+			zones:   []string{"."},
+		},
+		// 127.0.0.3 serves com.
+		&fakeDNS{
+			mockResolver: newMockResolver(t,
+				`example.com. 3600 IN NS ns1.example.com.`,
+				`ns1.example.com. 3600 IN A 127.0.0.4`,
+				// other.com's nameserver has no glue, so it has to be resolved
+				`other.com. 3600 IN NS ns2.example.com.`,
+				// the first of lame.com's nameservers doesn't serve it
+				`lame.com. 3600 IN NS ns1.lame.com.`,
+				`lame.com. 3600 IN NS ns2.lame.com.`,
+				`ns1.lame.com. 3600 IN A 127.0.0.5`,
+				`ns2.lame.com. 3600 IN A 127.0.0.4`,
+				// a.com and b.com can only be resolved through each other
+				`a.com. 3600 IN NS ns1.b.com.`,
+				`a.com. 3600 IN NS ns2.b.com.`,
+				`b.com. 3600 IN NS ns1.a.com.`,
+				`b.com. 3600 IN NS ns2.a.com.`,
+			),
+			queries: &comQueries,
+			zones:   []string{"com."},
+		},
+		// 127.0.0.4 serves example.com, other.com and lame.com
+		&fakeDNS{
+			mockResolver: newMockResolver(t,
+				`example.com. 3600 IN NS ns1.example.com.`,
+				`example.com. 300 IN TXT "v=spf1 -all"`,
+				`ns1.example.com. 3600 IN A 127.0.0.4`,
+				`ns2.example.com. 3600 IN A 127.0.0.4`,
+				`alias.example.com. 300 IN CNAME target.other.com.`,
+				`target.other.com. 300 IN TXT "v=spf1 ~all"`,
+				`lame.com. 300 IN TXT "v=spf1 ?all"`,
+			),
+			queries: &authQueries,
+			zones:   []string{"example.com.", "other.com.", "lame.com."},
+		},
+		// 127.0.0.5 doesn't serve any zones, but answers anyway
+		&fakeDNS{mockResolver: newMockResolver(t), queries: &lameQueries},
+	)
+
+	newScanner := func(t *testing.T, opts ...Option) *Scanner {
+		scanner, err := New(logger, timeout, append([]Option{
+			WithIterativeResolution(true),
+			WithRootHints("127.0.0.2:" + port),
+			WithAuthoritativePort(port),
+		}, opts...)...)
+		require.NoError(t, err)
+		t.Cleanup(scanner.Close)
+
+		return scanner
+	}
+
+	exchange := func(t *testing.T, scanner *Scanner, name string, qtype uint16) (*Response, error) {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		req.SetEdns0(4096, false)
+
+		return scanner.resolver.Exchange(context.Background(), req)
+	}
+
+	t.Run("FollowsReferrals", func(t *testing.T) {
+		rootQueries.Store(0)
+		scanner := newScanner(t)
+
+		resp, err := exchange(t, scanner, "example.com.", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, "127.0.0.4:"+port, resp.Nameserver)
+		require.Len(t, resp.Msg.Answer, 1)
+		require.Equal(t, []string{"v=spf1 -all"}, resp.Msg.Answer[0].(*dns.TXT).Txt)
+		require.Equal(t, int32(1), rootQueries.Load())
+
+		// the delegations are cached, so the root isn't queried again
+		resp, err = exchange(t, scanner, "example.com.", dns.TypeNS)
+		require.NoError(t, err)
+		require.Len(t, resp.Msg.Answer, 1)
+		require.Equal(t, int32(1), rootQueries.Load())
+
+		resp, err = exchange(t, scanner, "missing.example.com.", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, dns.RcodeNameError, resp.Msg.Rcode)
+	})
+
+	t.Run("ResolvesNameserversWithoutGlue", func(t *testing.T) {
+		scanner := newScanner(t)
+
+		// target.other.com is a CNAME target, so this also checks that the chain is followed
+		resp, err := exchange(t, scanner, "alias.example.com.", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Len(t, resp.Msg.Answer, 2)
+		require.Equal(t, "target.other.com.", resp.Msg.Answer[0].(*dns.CNAME).Target)
+		require.Equal(t, []string{"v=spf1 ~all"}, resp.Msg.Answer[1].(*dns.TXT).Txt)
+	})
+
+	t.Run("SkipsLameNameservers", func(t *testing.T) {
+		lameQueries.Store(0)
+		scanner := newScanner(t)
+
+		resp, err := exchange(t, scanner, "lame.com.", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Equal(t, []string{"v=spf1 ?all"}, resp.Msg.Answer[0].(*dns.TXT).Txt)
+		require.Equal(t, int32(1), lameQueries.Load())
+	})
+
+	t.Run("QueryBudget", func(t *testing.T) {
+		comQueries.Store(0)
+		scanner := newScanner(t)
+
+		_, err := exchange(t, scanner, "a.com.", dns.TypeTXT)
+		require.ErrorIs(t, err, errQueryBudgetExhausted)
+		require.LessOrEqual(t, comQueries.Load(), int32(iterativeMaxQueries))
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		scanner := newScanner(t)
+
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{CheckSPF}}, "example.com")
+		require.NoError(t, err)
+		require.Equal(t, "v=spf1 -all", results[0].SPF)
+		require.Equal(t, []string{"ns1.example.com."}, results[0].NS)
+	})
+
+	t.Run("Nameservers", func(t *testing.T) {
+		scanner := newScanner(t)
+
+		_, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Nameservers: []string{"8.8.8.8"}}, "example.com")
+		require.ErrorContains(t, err, "iterative resolution")
+	})
+
+	t.Run("EncryptedProtocol", func(t *testing.T) {
+		_, err := New(logger, timeout, WithIterativeResolution(true), WithDNSProtocol("tcp-tls"))
+		require.ErrorContains(t, err, "requires the udp or tcp DNS protocol")
+	})
+}
+
+func TestReferral(t *testing.T) {
+	msg := new(dns.Msg)
+	for _, record := range []string{
+		`example.com. 3600 IN NS ns1.example.com.`,
+		`example.com. 300 IN NS ns2.example.net.`,
+	} {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+
+		msg.Ns = append(msg.Ns, rr)
+	}
+
+	child, ns, ttl := referral(msg, "com.", "www.example.com.")
+	require.Equal(t, "example.com.", child)
+	require.Equal(t, []string{"ns1.example.com.", "ns2.example.net."}, ns)
+	require.Equal(t, uint32(300), ttl)
+
+	// referrals which go sideways or back up the tree are ignored
+	child, _, _ = referral(msg, "com.", "www.example.org.")
+	require.Empty(t, child)
+
+	child, _, _ = referral(msg, "example.com.", "www.example.com.")
+	require.Empty(t, child)
+}
@@ -0,0 +1,252 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// mtastsMaxAge is the largest max_age allowed in an MTA-STS policy (RFC 8461, section 3.2).
+	mtastsMaxAge = 31557600
+
+	// mtastsMaxPolicySize is the largest MTA-STS policy that will be read. RFC 8461 doesn't set a limit, but policies
+	// are only a handful of lines, and this prevents a hostile server from exhausting memory.
+	mtastsMaxPolicySize = 64 * 1024
+
+	// mtastsPolicyCacheDuration is how long fetched policies are remembered for, so that a policy which changes
+	// without its record's id changing can be detected.
+	mtastsPolicyCacheDuration = 24 * time.Hour
+)
+
+var mtastsIDRegex = regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`)
+
+type (
+	// MTASTSResult holds a domain's MTA-STS record and policy.
+	MTASTSResult struct {
+		Record      string        `json:"record" yaml:"record" doc:"The MTA-STS TXT record for the domain." example:"v=STSv1; id=20240101T000000;"`
+		ID          string        `json:"id,omitempty" yaml:"id,omitempty" doc:"The policy ID from the MTA-STS TXT record." example:"20240101T000000"`
+		Policy      *MTASTSPolicy `json:"policy,omitempty" yaml:"policy,omitempty" doc:"The MTA-STS policy served at https://mta-sts.<domain>/.well-known/mta-sts.txt."`
+		UnmatchedMX []string      `json:"unmatchedMx,omitempty" yaml:"unmatchedMx,omitempty" doc:"The MX records which don't match any mx pattern in the policy." example:"mail.example.com."`
+		Errors      []string      `json:"errors,omitempty" yaml:"errors,omitempty" doc:"Problems with the MTA-STS record or policy." example:"policy request returned HTTP 404"`
+	}
+
+	// cachedMTASTSPolicy is a fetched MTA-STS policy, along with the id of the
+	// record it was fetched for, as senders cache it.
+	cachedMTASTSPolicy struct {
+		id     string
+		policy *MTASTSPolicy
+	}
+
+	// MTASTSPolicy is a parsed MTA-STS policy file.
+	MTASTSPolicy struct {
+		Version string   `json:"version" yaml:"version" doc:"The policy version." example:"STSv1"`
+		Mode    string   `json:"mode" yaml:"mode" doc:"The policy mode (enforce, testing or none)." example:"enforce"`
+		MX      []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The patterns which the domain's MX records must match." example:"*.example.com"`
+		MaxAge  int      `json:"maxAge" yaml:"maxAge" doc:"The number of seconds senders may cache the policy for." example:"604800"`
+	}
+)
+
+// getTypeMTASTS queries the DNS server for the MTA-STS record of a domain, and
+// fetches the policy it advertises. It returns a nil result if the domain
+// doesn't publish an MTA-STS record.
+func (s *Scanner) getTypeMTASTS(ctx context.Context, domain string) (*MTASTSResult, error) {
+	answers, err := s.getDNSAnswers(ctx, "_mta-sts."+domain, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for _, answer := range answers {
+		if txt, ok := answer.(*dns.TXT); ok {
+			// TXT records can be split across multiple strings, so we need to join them
+			if record := strings.Join(txt.Txt, ""); strings.HasPrefix(record, MTASTSPrefix) {
+				records = append(records, record)
+			}
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	result := &MTASTSResult{Record: records[0]}
+
+	// senders must ignore a domain with more than one record (RFC 8461, section 3.1)
+	if len(records) > 1 {
+		result.Errors = append(result.Errors, "multiple MTA-STS records found, so senders will ignore them all")
+	}
+
+	for _, field := range strings.Split(result.Record, ";") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(field), "="); ok && key == "id" {
+			result.ID = value
+		}
+	}
+
+	if !mtastsIDRegex.MatchString(result.ID) {
+		result.Errors = append(result.Errors, "the record's id must be 1-32 letters or digits")
+	}
+
+	if result.Policy, err = s.getMTASTSPolicy(ctx, domain); err != nil {
+		// don't report a failure caused by the scan being cancelled
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	if result.Policy != nil && s.mtastsPolicyChanged(domain, result.ID, result.Policy) {
+		result.Errors = append(result.Errors, "the policy has changed since it was last fetched, but the record's id hasn't, so senders which cached the previous policy won't fetch the new one")
+	}
+
+	return result, nil
+}
+
+// mtastsPolicyChanged compares a domain's policy with the one fetched for it
+// previously, reporting whether the policy changed even though the id of the
+// record it was fetched for didn't. Senders only fetch the policy again when
+// the id changes, so they'd keep using the previous policy.
+func (s *Scanner) mtastsPolicyChanged(domain, id string, policy *MTASTSPolicy) bool {
+	key := strings.ToLower(dns.Fqdn(domain))
+
+	previous := s.mtastsPolicies.Get(key)
+	if previous != nil && previous.id == id {
+		// keep the policy senders would have cached, so the change is reported until the id is updated
+		return !reflect.DeepEqual(previous.policy, policy)
+	}
+
+	s.mtastsPolicies.Set(key, &cachedMTASTSPolicy{id: id, policy: policy})
+
+	return false
+}
+
+// getMTASTSPolicy fetches and parses a domain's MTA-STS policy.
+func (s *Scanner) getMTASTSPolicy(ctx context.Context, domain string) (*MTASTSPolicy, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://mta-sts."+strings.TrimSuffix(domain, ".")+"/.well-known/mta-sts.txt", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy request: %w", err)
+	}
+
+	// redirects must not be followed when fetching a policy (RFC 8461, section 3.3)
+	client := *s.httpClient
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return errors.New("policy redirects are not allowed")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy request returned HTTP %d", resp.StatusCode)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/plain" {
+		return nil, fmt.Errorf("policy must be served as text/plain, not %q", resp.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, mtastsMaxPolicySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	if len(body) > mtastsMaxPolicySize {
+		return nil, fmt.Errorf("policy is larger than %d bytes", mtastsMaxPolicySize)
+	}
+
+	return parseMTASTSPolicy(string(body))
+}
+
+// parseMTASTSPolicy parses the key/value pairs of an MTA-STS policy, as
+// defined in RFC 8461, section 3.2.
+func parseMTASTSPolicy(body string) (*MTASTSPolicy, error) {
+	policy := &MTASTSPolicy{MaxAge: -1}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy line %q", line)
+		}
+
+		value = strings.TrimSpace(value)
+
+		// unknown keys are ignored, to allow for future extensions
+		switch key {
+		case "version":
+			policy.Version = value
+		case "mode":
+			policy.Mode = value
+		case "mx":
+			policy.MX = append(policy.MX, value)
+		case "max_age":
+			maxAge, err := strconv.Atoi(value)
+			if err != nil || maxAge < 0 || maxAge > mtastsMaxAge {
+				return nil, fmt.Errorf("invalid policy max_age %q", value)
+			}
+
+			policy.MaxAge = maxAge
+		}
+	}
+
+	if policy.Version != "STSv1" {
+		return nil, fmt.Errorf("invalid policy version %q", policy.Version)
+	}
+
+	switch policy.Mode {
+	case "enforce", "testing":
+		if len(policy.MX) == 0 {
+			return nil, errors.New("policy has no mx patterns")
+		}
+	case "none":
+	default:
+		return nil, fmt.Errorf("invalid policy mode %q", policy.Mode)
+	}
+
+	if policy.MaxAge < 0 {
+		return nil, errors.New("policy has no max_age")
+	}
+
+	return policy, nil
+}
+
+// Matches reports whether an MX host matches any of the policy's mx patterns.
+// A pattern may start with a wildcard, which matches exactly one label.
+func (p *MTASTSPolicy) Matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range p.MX {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if label, rest, found := strings.Cut(host, "."); found && label != "" && rest == suffix {
+				return true
+			}
+
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// newMTASTSServer starts a local HTTPS stand-in for mta-sts.example.com, and
+// returns a client which routes every request to it.
+func newMTASTSServer(t *testing.T, handler http.HandlerFunc) *http.Client {
+	t.Helper()
+
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	return client
+}
+
+func TestMTASTS(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	records := []string{
+		`example.com. 300 IN NS ns1.example.com.`,
+		`example.com. 300 IN MX 10 mail.example.com.`,
+		`example.com. 300 IN MX 20 backup.example.net.`,
+		`_mta-sts.example.com. 300 IN TXT "v=STSv1; id=20240101T000000;"`,
+	}
+
+	scan := func(t *testing.T, handler http.HandlerFunc, records ...string) *MTASTSResult {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, records...)), WithHTTPClient(newMTASTSServer(t, handler)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		return results[0].MTASTS
+	}
+
+	t.Run("Policy", func(t *testing.T) {
+		result := scan(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "mta-sts.example.com", r.Host)
+			require.Equal(t, "/.well-known/mta-sts.txt", r.URL.Path)
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("version: STSv1\r\nmode: testing\r\nmx: *.example.com\r\nmax_age: 604800\r\n"))
+		}, records...)
+
+		require.Equal(t, "20240101T000000", result.ID)
+		require.Empty(t, result.Errors)
+		require.Equal(t, &MTASTSPolicy{Version: "STSv1", Mode: "testing", MX: []string{"*.example.com"}, MaxAge: 604800}, result.Policy)
+		require.Equal(t, []string{"backup.example.net."}, result.UnmatchedMX)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		result := scan(t, http.NotFound, records...)
+
+		require.Nil(t, result.Policy)
+		require.Equal(t, []string{"policy request returned HTTP 404"}, result.Errors)
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		result := scan(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://example.com/mta-sts.txt", http.StatusFound)
+		}, records...)
+
+		require.Nil(t, result.Policy)
+		require.Len(t, result.Errors, 1)
+		require.Contains(t, result.Errors[0], "policy redirects are not allowed")
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		result := scan(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("version: STSv1\n" + strings.Repeat("mx: mail.example.com\n", 4096)))
+		}, records...)
+
+		require.Nil(t, result.Policy)
+		require.Equal(t, []string{"policy is larger than 65536 bytes"}, result.Errors)
+	})
+
+	t.Run("ChangedPolicy", func(t *testing.T) {
+		policy := "version: STSv1\nmode: testing\nmx: *.example.com\nmax_age: 604800\n"
+
+		resolver := newMockResolver(t, records...)
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithHTTPClient(newMTASTSServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(policy))
+		})))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		scanMTASTS := func() *MTASTSResult {
+			results, err := scanner.Scan("example.com")
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			return results[0].MTASTS
+		}
+
+		require.Empty(t, scanMTASTS().Errors)
+
+		policy = "version: STSv1\nmode: enforce\nmx: *.example.com\nmax_age: 604800\n"
+
+		result := scanMTASTS()
+		require.Len(t, result.Errors, 1)
+		require.Contains(t, result.Errors[0], "the record's id hasn't")
+
+		record, err := dns.NewRR(`_mta-sts.example.com. 300 IN TXT "v=STSv1; id=20240102T000000;"`)
+		require.NoError(t, err)
+		resolver.records["_mta-sts.example.com."] = []dns.RR{record}
+
+		require.Empty(t, scanMTASTS().Errors)
+	})
+
+	t.Run("NoRecord", func(t *testing.T) {
+		result := scan(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Error("policy fetched without an MTA-STS record")
+		}, records[:3]...)
+
+		require.Nil(t, result)
+	})
+}
+
+func TestParseMTASTSPolicy(t *testing.T) {
+	for name, policy := range map[string]string{
+		"MissingMaxAge": "version: STSv1\nmode: enforce\nmx: mail.example.com\n",
+		"InvalidMode":   "version: STSv1\nmode: strict\nmx: mail.example.com\nmax_age: 86400\n",
+		"InvalidMaxAge": "version: STSv1\nmode: enforce\nmx: mail.example.com\nmax_age: 31557601\n",
+		"NoMX":          "version: STSv1\nmode: enforce\nmax_age: 86400\n",
+		"NoVersion":     "mode: enforce\nmx: mail.example.com\nmax_age: 86400\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseMTASTSPolicy(policy)
+			require.Error(t, err)
+		})
+	}
+
+	policy := &MTASTSPolicy{MX: []string{"mail.example.com", "*.example.net"}}
+	require.True(t, policy.Matches("MAIL.example.com."))
+	require.True(t, policy.Matches("mx1.example.net."))
+	require.False(t, policy.Matches("example.net."))
+	require.False(t, policy.Matches("a.b.example.net."))
+}
@@ -0,0 +1,203 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// reservedPrefixes are the special-purpose address blocks (RFC 6890) which mail
+// servers on the public internet can't be reached at, other than those covered
+// by netip.Addr's own checks (such as private and loopback addresses).
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space (CGNAT)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and the limited broadcast address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use IPv4/IPv6 translation
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// MXHost is a mail server listed in a domain's MX records, along with the
+// addresses it resolves to.
+type MXHost struct {
+	Host              string   `json:"host" yaml:"host" doc:"The mail server's hostname." example:"mail.example.com."`
+	Preference        uint16   `json:"preference" yaml:"preference" doc:"The MX preference, where lower values are tried first." example:"10"`
+	Addresses         []string `json:"addresses,omitempty" yaml:"addresses,omitempty" doc:"The IPv4 and IPv6 addresses the hostname resolves to." example:"192.0.2.25"`
+	CNAME             string   `json:"cname,omitempty" yaml:"cname,omitempty" doc:"The name the hostname is a CNAME for. MX records must point directly at a hostname with A/AAAA records (RFC 2181, section 10.3)." example:"mail.example.net."`
+	IPLiteral         bool     `json:"ipLiteral,omitempty" yaml:"ipLiteral,omitempty" doc:"Whether the MX record points at an IP address rather than a hostname, which senders won't deliver to."`
+	Unresolvable      bool     `json:"unresolvable,omitempty" yaml:"unresolvable,omitempty" doc:"Whether the hostname doesn't resolve to any addresses, such as a dangling record for a decommissioned server."`
+	ReservedAddresses []string `json:"reservedAddresses,omitempty" yaml:"reservedAddresses,omitempty" doc:"The addresses which are private or reserved, and so can't be reached from the internet." example:"10.0.0.25"`
+}
+
+// getTypeMX queries the DNS server for the MX records of a domain, following
+// any CNAMEs. It returns the mail servers sorted by preference, and an error
+// if any occurred.
+func (s *Scanner) getTypeMX(ctx context.Context, domain string) ([]*MXHost, error) {
+	var hosts []*MXHost
+
+	for range maxCNAMEHops {
+		answers, err := s.getDNSAnswers(ctx, domain, dns.TypeMX)
+		if err != nil {
+			return nil, err
+		}
+
+		var next string
+
+		for _, answer := range answers {
+			switch rr := answer.(type) {
+			case *dns.CNAME:
+				next = rr.Target
+			case *dns.MX:
+				hosts = append(hosts, &MXHost{Host: rr.Mx, Preference: rr.Preference})
+			}
+		}
+
+		// the resolver didn't include the CNAME target's records in its answer
+		if len(hosts) > 0 || next == "" {
+			break
+		}
+
+		domain = next
+	}
+
+	slices.SortStableFunc(hosts, func(a, b *MXHost) int {
+		return int(a.Preference) - int(b.Preference)
+	})
+
+	return hosts, nil
+}
+
+// resolveMXHosts resolves the addresses of each mail server concurrently, and
+// flags any which senders can't deliver to.
+func (s *Scanner) resolveMXHosts(ctx context.Context, hosts []*MXHost) error {
+	errs := make([]error, len(hosts))
+
+	var wg sync.WaitGroup
+	for index, host := range hosts {
+		// a null MX doesn't accept mail
+		if host.Host == "." {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := s.resolveMXHost(ctx, host); err != nil {
+				errs[index] = fmt.Errorf("%s: %w", host.Host, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// resolveMXHost resolves the A and AAAA records of a single mail server.
+func (s *Scanner) resolveMXHost(ctx context.Context, host *MXHost) error {
+	// some domains list an address (or an address literal, such as [192.0.2.25]) instead of a hostname
+	literal := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSuffix(host.Host, "."), "["), "]")
+	if addr, err := netip.ParseAddr(literal); err == nil {
+		host.IPLiteral = true
+		host.Addresses = []string{addr.String()}
+
+		if isReservedAddress(addr) {
+			host.ReservedAddresses = host.Addresses
+		}
+
+		return nil
+	}
+
+	for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		addrs, cname, err := s.resolveAddresses(ctx, host.Host, recordType)
+		if err != nil {
+			return err
+		}
+
+		if cname != "" {
+			host.CNAME = cname
+		}
+
+		for _, addr := range addrs {
+			host.Addresses = append(host.Addresses, addr.String())
+
+			if isReservedAddress(addr) {
+				host.ReservedAddresses = append(host.ReservedAddresses, addr.String())
+			}
+		}
+	}
+
+	host.Unresolvable = len(host.Addresses) == 0
+
+	return nil
+}
+
+// resolveAddresses returns the addresses of a host, following any CNAMEs. It
+// also returns the final target of the CNAME chain, if there was one.
+func (s *Scanner) resolveAddresses(ctx context.Context, host string, recordType uint16) (addrs []netip.Addr, cname string, err error) {
+	for range maxCNAMEHops {
+		answers, err := s.getDNSAnswers(ctx, host, recordType)
+		if err != nil {
+			return nil, cname, err
+		}
+
+		var next string
+
+		for _, answer := range answers {
+			switch rr := answer.(type) {
+			case *dns.CNAME:
+				cname, next = rr.Target, rr.Target
+			case *dns.A:
+				if addr, ok := netip.AddrFromSlice(rr.A); ok {
+					addrs = append(addrs, addr.Unmap())
+				}
+			case *dns.AAAA:
+				if addr, ok := netip.AddrFromSlice(rr.AAAA); ok {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+
+		// the resolver didn't include the CNAME target's records in its answer
+		if len(addrs) > 0 || next == "" {
+			break
+		}
+
+		host = next
+	}
+
+	return addrs, cname, nil
+}
+
+// isReservedAddress reports whether an address is private or reserved, and so
+// can't be reached from the internet.
+func isReservedAddress(addr netip.Addr) bool {
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsUnspecified() || addr.IsMulticast() ||
+		addr.IsLinkLocalUnicast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
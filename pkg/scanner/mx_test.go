@@ -0,0 +1,66 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanMXHosts(t *testing.T) {
+	resolver := newMockResolver(t,
+		`example.com. 300 IN NS ns1.example.com.`,
+		`example.com. 300 IN MX 20 alias.example.com.`,
+		`example.com. 300 IN MX 10 mail.example.com.`,
+		`example.com. 300 IN MX 30 192.0.2.25.`,
+		`example.com. 300 IN MX 40 gone.example.com.`,
+		`example.com. 300 IN MX 50 internal.example.com.`,
+		`mail.example.com. 300 IN A 8.8.8.8`,
+		`mail.example.com. 300 IN AAAA 2606:4700::1`,
+		`alias.example.com. 300 IN CNAME mail.example.net.`,
+		`mail.example.net. 300 IN A 1.1.1.1`,
+		`internal.example.com. 300 IN A 10.0.0.25`,
+	)
+
+	scanner, err := New(zerolog.Nop(), time.Second*5, WithResolver(resolver))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.Empty(t, result.Error)
+	require.Equal(t, []string{"mail.example.com.", "alias.example.com.", "192.0.2.25.", "gone.example.com.", "internal.example.com."}, result.MX)
+	require.Equal(t, []*MXHost{
+		{Host: "mail.example.com.", Preference: 10, Addresses: []string{"8.8.8.8", "2606:4700::1"}},
+		{Host: "alias.example.com.", Preference: 20, Addresses: []string{"1.1.1.1"}, CNAME: "mail.example.net."},
+		{Host: "192.0.2.25.", Preference: 30, Addresses: []string{"192.0.2.25"}, IPLiteral: true, ReservedAddresses: []string{"192.0.2.25"}},
+		{Host: "gone.example.com.", Preference: 40, Unresolvable: true},
+		{Host: "internal.example.com.", Preference: 50, Addresses: []string{"10.0.0.25"}, ReservedAddresses: []string{"10.0.0.25"}},
+	}, result.MXHosts)
+}
+
+func TestIsReservedAddress(t *testing.T) {
+	for address, reserved := range map[string]bool{
+		"8.8.8.8":          false,
+		"2606:4700::1":     false,
+		"10.1.2.3":         true,
+		"127.0.0.1":        true,
+		"100.64.0.1":       true,
+		"169.254.1.1":      true,
+		"255.255.255.255":  true,
+		"::1":              true,
+		"fd00::25":         true,
+		"fe80::1":          true,
+		"2001:db8::25":     true,
+		"::ffff:192.0.2.1": true,
+	} {
+		t.Run(address, func(t *testing.T) {
+			require.Equal(t, reserved, isReservedAddress(netip.MustParseAddr(address)))
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// nameserverEjectAfter is the number of consecutive failed queries after which a nameserver is ejected from the
+	// rotation.
+	nameserverEjectAfter = 3
+
+	// nameserverEjectFor is how long an ejected nameserver is left out of the rotation, before it's tried again.
+	nameserverEjectFor = 30 * time.Second
+
+	// nameserverMaxBackoffDoublings caps how many times the retry backoff doubles, so that it doesn't overflow.
+	nameserverMaxBackoffDoublings = 8
+
+	// nameserverPoolCacheDuration is how long the scanner keeps the pool for a set of nameservers, along with the
+	// health of each nameserver.
+	nameserverPoolCacheDuration = time.Hour
+)
+
+type (
+	// nameserverPool rotates queries through a set of nameservers, retrying
+	// failed queries against the next nameserver and temporarily ejecting any
+	// which keep failing. It's shared by the built-in resolvers.
+	nameserverPool struct {
+		// backoff is the delay before the first retry, which doubles (with jitter) for each subsequent retry.
+		backoff time.Duration
+
+		// ejectAfter is the number of consecutive failures after which a nameserver is ejected.
+		ejectAfter int
+
+		// ejectFor is how long an ejected nameserver is left out of the rotation.
+		ejectFor time.Duration
+
+		// health holds the health of each nameserver, and is guarded by healthMutex.
+		health      map[string]*nameserverHealth
+		healthMutex sync.Mutex
+
+		// The index of the last-used nameserver, from the nameservers slice.
+		//
+		// This field is managed by atomic operations, and should only ever be referenced by the
+		// (*nameserverPool).next() method.
+		lastNameserverIndex uint32
+
+		// nameservers is a slice of "host:port" strings (or URLs for DNS-over-HTTPS) of nameservers to issue queries
+		// against.
+		nameservers []string
+
+		// retries is the number of times a failed query is retried.
+		retries int
+	}
+
+	// nameserverHealth tracks the recent failures of a nameserver.
+	nameserverHealth struct {
+		failures     int
+		ejectedUntil time.Time
+	}
+)
+
+func newNameserverPool(nameservers []string, retries int, backoff time.Duration) *nameserverPool {
+	return &nameserverPool{
+		backoff:     backoff,
+		ejectAfter:  nameserverEjectAfter,
+		ejectFor:    nameserverEjectFor,
+		health:      make(map[string]*nameserverHealth),
+		nameservers: nameservers,
+		retries:     retries,
+	}
+}
+
+// nameserverPool returns the pool for nameservers, creating it if the scanner
+// hasn't queried them before.
+func (s *Scanner) nameserverPool(nameservers []string) *nameserverPool {
+	key := strings.Join(nameservers, ",")
+
+	s.nameserverPoolsMutex.Lock()
+	defer s.nameserverPoolsMutex.Unlock()
+
+	if pool := s.nameserverPools.Get(key); pool != nil {
+		return pool
+	}
+
+	pool := newNameserverPool(nameservers, int(s.dnsRetries), s.dnsRetryBackoff)
+	s.nameserverPools.Set(key, pool)
+
+	return pool
+}
+
+// exchange sends a query using send, which queries a single nameserver. If the
+// query times out, fails, or is answered with SERVFAIL or REFUSED, it's retried
+// against the next nameserver after a jittered backoff. The last response is
+// returned as-is once the retries are exhausted.
+func (p *nameserverPool) exchange(ctx context.Context, send func(ctx context.Context, nameserver string) (*Response, error)) (*Response, error) {
+	tried := make(map[string]bool)
+
+	for attempt := 0; ; attempt++ {
+		nameserver := p.next(tried)
+		tried[nameserver] = true
+
+		resp, err := send(ctx, nameserver)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		failed := err != nil || resp.Msg.Rcode == dns.RcodeServerFailure || resp.Msg.Rcode == dns.RcodeRefused
+		p.report(nameserver, failed)
+
+		if !failed || attempt >= p.retries {
+			if err != nil {
+				return nil, &nameserverError{nameserver: nameserver, err: err}
+			}
+
+			return resp, nil
+		}
+
+		// back off exponentially, with jitter so that concurrent retries don't arrive in bursts
+		delay := p.backoff << min(attempt, nameserverMaxBackoffDoublings)
+		delay = delay/2 + rand.N(delay/2+1)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// next returns the next nameserver in the rotation, skipping any which have
+// already been tried for this query or are ejected. If every untried
+// nameserver is ejected, the one due to return soonest is used, and once every
+// nameserver has been tried, the rotation starts again.
+func (p *nameserverPool) next(tried map[string]bool) string {
+	start := int(atomic.AddUint32(&p.lastNameserverIndex, 1))
+	now := time.Now()
+
+	p.healthMutex.Lock()
+	defer p.healthMutex.Unlock()
+
+	var fallback string
+	var fallbackUntil time.Time
+
+	for offset := range p.nameservers {
+		nameserver := p.nameservers[(start+offset)%len(p.nameservers)]
+		if tried[nameserver] {
+			continue
+		}
+
+		health := p.health[nameserver]
+		if health == nil || !now.Before(health.ejectedUntil) {
+			return nameserver
+		}
+
+		if fallback == "" || health.ejectedUntil.Before(fallbackUntil) {
+			fallback, fallbackUntil = nameserver, health.ejectedUntil
+		}
+	}
+
+	if fallback != "" {
+		return fallback
+	}
+
+	// every nameserver has been tried, so clear the slate
+	clear(tried)
+
+	return p.nameservers[start%len(p.nameservers)]
+}
+
+// report records the outcome of a query, ejecting the nameserver once it has
+// failed too many times in a row.
+func (p *nameserverPool) report(nameserver string, failed bool) {
+	p.healthMutex.Lock()
+	defer p.healthMutex.Unlock()
+
+	health, ok := p.health[nameserver]
+	if !ok {
+		health = &nameserverHealth{}
+		p.health[nameserver] = health
+	}
+
+	if !failed {
+		health.failures = 0
+		return
+	}
+
+	health.failures++
+	if health.failures >= p.ejectAfter {
+		health.failures = 0
+		health.ejectedUntil = time.Now().Add(p.ejectFor)
+	}
+}
@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameserverFailover(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Millisecond * 200
+	records := newMockResolver(t, `example.com. 300 IN TXT "v=spf1 -all"`)
+
+	for name, nameserver := range map[string]fakeDNS{
+		"ServerFailure": {rcode: dns.RcodeServerFailure},
+		"Refused":       {rcode: dns.RcodeRefused},
+		"Timeout":       {drop: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var badQueries, goodQueries atomic.Int32
+			nameserver.queries = &badQueries
+			bad := nameserver.listen(t)
+			good := (&fakeDNS{mockResolver: records, queries: &goodQueries}).listen(t)
+
+			scanner, err := New(logger, timeout, WithNameservers([]string{bad, good}), WithDNSRetryBackoff(time.Millisecond))
+			require.NoError(t, err)
+			defer scanner.Close()
+
+			for range 10 {
+				records, err := scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+				require.NoError(t, err)
+				require.Equal(t, []string{"v=spf1 -all"}, records)
+			}
+
+			// the bad nameserver is ejected once it has failed too many times in a row
+			require.Equal(t, int32(10), goodQueries.Load())
+			require.Equal(t, int32(nameserverEjectAfter), badQueries.Load())
+		})
+	}
+}
+
+func TestNameserverRetries(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Millisecond * 200
+	records := newMockResolver(t, `example.com. 300 IN TXT "v=spf1 -all"`)
+
+	t.Run("RetriesExhausted", func(t *testing.T) {
+		var queries atomic.Int32
+		bad := (&fakeDNS{rcode: dns.RcodeServerFailure, queries: &queries}).listen(t)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{bad}), WithDNSRetries(3), WithDNSRetryBackoff(time.Millisecond))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+		require.Equal(t, int32(4), queries.Load())
+
+		var queryErr *QueryError
+		require.ErrorAs(t, err, &queryErr)
+		require.Equal(t, QueryErrorRcode, queryErr.Class)
+		require.Equal(t, "SERVFAIL", queryErr.Rcode)
+		require.Equal(t, bad, queryErr.Nameserver)
+	})
+
+	t.Run("TimeoutExhausted", func(t *testing.T) {
+		var queries atomic.Int32
+		bad := (&fakeDNS{drop: true, queries: &queries}).listen(t)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{bad}), WithDNSRetries(0))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT)
+
+		var queryErr *QueryError
+		require.ErrorAs(t, err, &queryErr)
+		require.Equal(t, QueryErrorTimeout, queryErr.Class)
+		require.Equal(t, "example.com.", queryErr.Name)
+		require.Equal(t, "TXT", queryErr.Type)
+		require.Equal(t, bad, queryErr.Nameserver)
+	})
+
+	t.Run("RetriesDisabled", func(t *testing.T) {
+		var badQueries, goodQueries atomic.Int32
+		bad := (&fakeDNS{rcode: dns.RcodeServerFailure, queries: &badQueries}).listen(t)
+		good := (&fakeDNS{mockResolver: records, queries: &goodQueries}).listen(t)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{bad, good}), WithDNSRetries(0))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		var failures int
+		for range 2 {
+			if _, err = scanner.getDNSRecords(context.Background(), "example.com", dns.TypeTXT); err != nil {
+				failures++
+			}
+		}
+
+		require.Equal(t, 1, failures)
+		require.Equal(t, int32(1), badQueries.Load())
+		require.Equal(t, int32(1), goodQueries.Load())
+	})
+
+	t.Run("CancelledDuringBackoff", func(t *testing.T) {
+		var queries atomic.Int32
+		bad := (&fakeDNS{rcode: dns.RcodeServerFailure, queries: &queries}).listen(t)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{bad}), WithDNSRetryBackoff(time.Minute))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		_, err = scanner.getDNSRecords(ctx, "example.com", dns.TypeTXT)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, int32(1), queries.Load())
+	})
+}
+
+func TestNameserverPool(t *testing.T) {
+	failing := func(context.Context, string) (*Response, error) {
+		return &Response{Msg: &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeServerFailure}}}, nil
+	}
+
+	t.Run("EjectsFailingNameservers", func(t *testing.T) {
+		pool := newNameserverPool([]string{"bad", "good"}, 0, 0)
+
+		queries := make(map[string]int)
+		send := func(ctx context.Context, nameserver string) (*Response, error) {
+			queries[nameserver]++
+			if nameserver == "bad" {
+				return failing(ctx, nameserver)
+			}
+
+			return &Response{Msg: new(dns.Msg)}, nil
+		}
+
+		for range 20 {
+			_, _ = pool.exchange(context.Background(), send)
+		}
+
+		require.Equal(t, nameserverEjectAfter, queries["bad"])
+		require.Equal(t, 20-nameserverEjectAfter, queries["good"])
+	})
+
+	t.Run("RestoresEjectedNameservers", func(t *testing.T) {
+		pool := newNameserverPool([]string{"bad", "good"}, 0, 0)
+		pool.ejectFor = time.Millisecond * 10
+
+		for range nameserverEjectAfter {
+			pool.report("bad", true)
+		}
+
+		require.Equal(t, "good", pool.next(map[string]bool{}))
+		require.Equal(t, "good", pool.next(map[string]bool{}))
+
+		time.Sleep(pool.ejectFor)
+
+		seen := make(map[string]bool)
+		for range 2 {
+			seen[pool.next(map[string]bool{})] = true
+		}
+
+		require.True(t, seen["bad"])
+	})
+
+	t.Run("FallsBackToEjectedNameservers", func(t *testing.T) {
+		pool := newNameserverPool([]string{"first", "second"}, 1, 0)
+
+		for range nameserverEjectAfter {
+			pool.report("first", true)
+			pool.report("second", true)
+		}
+
+		var queries int
+		_, err := pool.exchange(context.Background(), func(ctx context.Context, nameserver string) (*Response, error) {
+			queries++
+			return failing(ctx, nameserver)
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, queries)
+	})
+}
@@ -1,25 +1,86 @@
 package scanner
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"net/netip"
+	"net/url"
+	"os"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-// OverwriteOption allows the caller to overwrite an existing option.
+// OverwriteOption allows the caller to overwrite an existing option. It isn't
+// safe to call while scans are running, as the option applies to every scan;
+// use ScanWithOptions to change the configuration for a single scan instead.
 func (s *Scanner) OverwriteOption(option Option) error {
 	if option == nil {
 		return errors.New("invalid option")
 	}
 
-	return option(s)
+	if err := option(s); err != nil {
+		return err
+	}
+
+	// rebuild the default resolver, in case the option changed its protocol or nameservers
+	if !s.customResolver {
+		resolver, err := s.newDefaultResolver()
+		if err != nil {
+			return err
+		}
+
+		if closer, ok := s.resolver.(io.Closer); ok {
+			_ = closer.Close()
+		}
+
+		s.resolver = resolver
+
+		// the delegations are only used by iterative resolvers
+		if !s.iterative && s.delegations != nil {
+			s.delegations.Close()
+			s.delegations = nil
+		}
+	}
+
+	return nil
+}
+
+// WithAuthoritativeCheck sends the queries behind the SPF, DMARC, DKIM and MX
+// checks directly to each nameserver a domain's zone is delegated to, as well
+// as through the scanner's nameservers. Nameservers which are lame, refuse
+// queries, serve an older SOA serial than the others, or give different
+// answers are reported in Result.Authoritative.
+func WithAuthoritativeCheck(enabled bool) Option {
+	return func(s *Scanner) error {
+		s.authoritative = enabled
+
+		return nil
+	}
+}
+
+// WithAuthoritativePort sets the port authoritative nameservers are queried on,
+// both by WithAuthoritativeCheck and by WithIterativeResolution. It defaults to
+// 53.
+func WithAuthoritativePort(port string) Option {
+	return func(s *Scanner) error {
+		if number, err := strconv.ParseUint(port, 10, 16); err != nil || number == 0 {
+			return fmt.Errorf("invalid authoritative port: %s", port)
+		}
+
+		s.authoritativePort = port
+
+		return nil
+	}
 }
 
 // WithCacheDuration sets the duration that a cache entry will be valid for.
@@ -68,6 +129,18 @@ func WithDKIMSelectors(selectors ...string) Option {
 	}
 }
 
+// WithDMARCTreeWalk enables the DMARCbis DNS tree walk when discovering a
+// domain's DMARC policy. Rather than only falling back to the organizational
+// domain, each parent of the domain is queried in turn (up to 8 queries), so
+// policies published by public suffix operators are found too.
+func WithDMARCTreeWalk(enabled bool) Option {
+	return func(s *Scanner) error {
+		s.dmarcTreeWalk = enabled
+
+		return nil
+	}
+}
+
 // WithDNSBuffer increases the allocated buffer for DNS responses.
 func WithDNSBuffer(bufferSize uint16) Option {
 	return func(s *Scanner) error {
@@ -81,7 +154,48 @@ func WithDNSBuffer(bufferSize uint16) Option {
 	}
 }
 
-// WithDNSProtocol sets the DNS protocol to use for queries.
+// WithDNSCABundle sets the PEM-encoded CA bundle used to verify the
+// certificates of tcp-tls, https and quic nameservers, instead of the system's
+// certificate pool.
+func WithDNSCABundle(path string) Option {
+	return func(s *Scanner) error {
+		bundle, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("no valid certificates found in CA bundle: %s", path)
+		}
+
+		s.dnsClient.TLSConfig = &tls.Config{RootCAs: pool}
+
+		return nil
+	}
+}
+
+// WithDNSHTTPMethod sets the HTTP method used for DNS-over-HTTPS queries. Both
+// the GET and POST wire formats from RFC 8484 are supported.
+func WithDNSHTTPMethod(method string) Option {
+	return func(s *Scanner) error {
+		method = strings.ToUpper(method)
+
+		switch method {
+		case http.MethodGet, http.MethodPost:
+			s.dnsHTTPMethod = method
+		default:
+			return fmt.Errorf("invalid DNS HTTP method: %s, valid options: GET, POST", method)
+		}
+
+		return nil
+	}
+}
+
+// WithDNSProtocol sets the DNS protocol to use for queries. When using https,
+// the nameservers must be DNS-over-HTTPS resolver URLs. Nameservers given
+// without a port are queried on port 853 when using tcp-tls or quic, and on
+// port 53 otherwise.
 func WithDNSProtocol(protocol string) Option {
 	return func(s *Scanner) error {
 		protocol = strings.ToLower(protocol)
@@ -89,17 +203,139 @@ func WithDNSProtocol(protocol string) Option {
 		switch protocol {
 		case "udp", "tcp", "tcp-tls":
 			s.dnsClient.Net = protocol
+		case "https", "quic":
 		default:
-			return fmt.Errorf("invalid DNS protocol: %s, valid options: udp, tcp, tcp-tls", protocol)
+			return fmt.Errorf("invalid DNS protocol: %s, valid options: udp, tcp, tcp-tls, https, quic", protocol)
+		}
+
+		s.dnsProtocol = protocol
+
+		return nil
+	}
+}
+
+// WithDNSRetries sets the number of times the default resolver retries a query
+// which times out, fails, or is answered with SERVFAIL or REFUSED. Each retry
+// is sent to the next nameserver, and nameservers which keep failing are
+// temporarily ejected from the rotation. Set to 0 to disable retries.
+func WithDNSRetries(retries uint16) Option {
+	return func(s *Scanner) error {
+		s.dnsRetries = retries
+		return nil
+	}
+}
+
+// WithDNSRetryBackoff sets the delay before the default resolver's first
+// retry, which doubles for each subsequent retry. A random jitter of up to
+// half the delay is applied, so that concurrent retries are spread out.
+func WithDNSRetryBackoff(backoff time.Duration) Option {
+	return func(s *Scanner) error {
+		if backoff < 0 {
+			return errors.New("DNS retry backoff must not be negative")
 		}
 
+		s.dnsRetryBackoff = backoff
+
+		return nil
+	}
+}
+
+// WithDNSSECTrustAnchor loads the trust anchors used by the built-in DNSSEC
+// validator from a file of DS or DNSKEY records in zone file format, replacing
+// the embedded root zone anchors. This implies WithDNSSECValidation(true).
+func WithDNSSECTrustAnchor(path string) Option {
+	return func(s *Scanner) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read trust anchor: %w", err)
+		}
+		defer file.Close()
+
+		trustAnchors, err := parseTrustAnchors(file)
+		if err != nil {
+			return fmt.Errorf("invalid trust anchor %s: %w", path, err)
+		}
+
+		s.closeDNSSECValidator()
+		s.dnssecValidator = newDNSSECValidator(trustAnchors)
+
+		return nil
+	}
+}
+
+// WithDNSSECValidation enables the built-in DNSSEC validator, which verifies
+// the chain of signatures from each answer up to the root zone's trust
+// anchors, rather than trusting the AD bit set by the nameservers.
+func WithDNSSECValidation(enabled bool) Option {
+	return func(s *Scanner) error {
+		if !enabled {
+			s.closeDNSSECValidator()
+			s.dnssecValidator = nil
+			return nil
+		}
+
+		// keep any trust anchors loaded by WithDNSSECTrustAnchor
+		if s.dnssecValidator != nil {
+			return nil
+		}
+
+		trustAnchors, err := parseTrustAnchors(strings.NewReader(rootTrustAnchors))
+		if err != nil {
+			return fmt.Errorf("invalid root trust anchors: %w", err)
+		}
+
+		s.dnssecValidator = newDNSSECValidator(trustAnchors)
+
+		return nil
+	}
+}
+
+// WithEvidence records every DNS query made while scanning a domain in its
+// result, along with exactly what was returned (the records, their TTLs, the
+// responding nameserver, flags and latency), so the results can be audited.
+func WithEvidence(enabled bool) Option {
+	return func(s *Scanner) error {
+		s.evidence = enabled
+
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to fetch policies published over
+// HTTPS, such as MTA-STS policies.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Scanner) error {
+		if client == nil {
+			return errors.New("invalid HTTP client")
+		}
+
+		s.httpClient = client
+
+		return nil
+	}
+}
+
+// WithIterativeResolution resolves every query iteratively, starting from the
+// built-in root hints and following referrals down to the authoritative
+// nameservers, instead of relying on a recursive resolver. Delegations are
+// cached, and each query is limited to a budget of queries so that long or
+// looping delegation chains fail rather than running away. The scanner's
+// nameservers are ignored, and only the udp and tcp DNS protocols can be used.
+//
+// Authoritative nameservers don't set the AD bit, so use
+// WithDNSSECValidation to check DNSSEC signatures.
+func WithIterativeResolution(enabled bool) Option {
+	return func(s *Scanner) error {
+		s.iterative = enabled
+
 		return nil
 	}
 }
 
 // WithNameservers allows the caller to provide a custom set of nameservers for
 // a *Scanner to use. If ns is nil, or zero-length, the *Scanner will use
-// the nameservers specified in /etc/resolv.conf.
+// the nameservers specified in /etc/resolv.conf. DNS-over-HTTPS resolvers are
+// provided as URLs, such as https://dns.google/dns-query.
 func WithNameservers(nameservers []string) Option {
 	return func(s *Scanner) error {
 		// If the provided slice of nameservers is nil, or has zero
@@ -117,42 +353,89 @@ func WithNameservers(nameservers []string) Option {
 			nameservers = config.Servers
 		}
 
-		// Make sure each of the nameservers is in the "host:port" format.
-		//
-		// The "dns" package requires that you explicitly state the port
-		// number for the resolvers that get queried.
-		for index := range nameservers {
-			addr, err := netip.ParseAddr(nameservers[index])
-			if err != nil {
-				// might contain a port
-				host, port, err := net.SplitHostPort(nameservers[index])
-				if err != nil {
-					return fmt.Errorf("invalid IP address: %s", nameservers[index])
-				}
-
-				// validate IP
-				addr, err = netip.ParseAddr(host)
-				if err != nil {
-					return fmt.Errorf("invalid IP address: %s", nameservers[index])
-				}
-
-				if addr.Is6() {
-					nameservers[index] = fmt.Sprintf("[%s]:%v", addr.String(), port)
-				} else {
-					nameservers[index] = fmt.Sprintf("%s:%v", addr.String(), port)
-				}
-
-				continue
-			}
+		// the port is added once the resolver is created, as it depends on the DNS protocol
+		if _, err := normalizeNameservers(nameservers, ""); err != nil {
+			return err
+		}
 
-			if addr.Is6() {
-				nameservers[index] = fmt.Sprintf("[%s]:53", addr.String())
-			} else {
-				nameservers[index] = fmt.Sprintf("%s:53", addr.String())
+		s.nameservers = nameservers
+
+		return nil
+	}
+}
+
+// WithPublicSuffixList loads the Public Suffix List used to find a domain's
+// organizational domain from a file, replacing the embedded snapshot. The file
+// must be in the format published at https://publicsuffix.org/list/.
+func WithPublicSuffixList(path string) Option {
+	return func(s *Scanner) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read public suffix list: %w", err)
+		}
+		defer file.Close()
+
+		list, err := parsePublicSuffixList(file)
+		if err != nil {
+			return fmt.Errorf("invalid public suffix list %s: %w", path, err)
+		}
+
+		s.publicSuffixList = list
+
+		return nil
+	}
+}
+
+// WithResolver sets the Resolver used for every DNS query the scanner makes.
+// This replaces the default resolver, so WithDNSProtocol and WithNameservers
+// have no effect when it's used.
+func WithResolver(resolver Resolver) Option {
+	return func(s *Scanner) error {
+		if resolver == nil {
+			return errors.New("invalid resolver")
+		}
+
+		s.customResolver = true
+		s.resolver = resolver
+
+		return nil
+	}
+}
+
+// WithRootHints sets the root servers that iterative resolution starts from,
+// instead of the built-in root hints. Each is an IP address with an optional
+// port, such as 198.41.0.4 or 198.41.0.4:53. The built-in root hints are used
+// again if none are given.
+func WithRootHints(hints ...string) Option {
+	return func(s *Scanner) error {
+		for _, hint := range hints {
+			if strings.HasPrefix(hint, "https://") {
+				return fmt.Errorf("invalid root hint: %s", hint)
 			}
 		}
 
-		s.nameservers = nameservers
+		normalized, err := normalizeNameservers(hints, "53")
+		if err != nil {
+			return fmt.Errorf("invalid root hint: %w", err)
+		}
+
+		s.rootHints = normalized
+
+		return nil
+	}
+}
+
+// WithScanTimeout sets an overall deadline for scanning a single domain. This
+// is separate from the per-query timeout passed to New, and bounds the total
+// time spent across every query issued for that domain. A zero value disables
+// the deadline.
+func WithScanTimeout(timeout time.Duration) Option {
+	return func(s *Scanner) error {
+		if timeout < 0 {
+			return fmt.Errorf("invalid scan timeout: %v", timeout)
+		}
+
+		s.scanTimeout = timeout
 
 		return nil
 	}
@@ -178,3 +461,69 @@ func validateDKIMSelector(selector string) error {
 
 	return nil
 }
+
+// defaultDNSPort returns the port nameservers are queried on over protocol when
+// they're given without one: 853 for DNS-over-TLS (RFC 7858) and DNS-over-QUIC
+// (RFC 9250), and 53 otherwise.
+func defaultDNSPort(protocol string) string {
+	switch protocol {
+	case "tcp-tls", "quic":
+		return "853"
+	default:
+		return "53"
+	}
+}
+
+// normalizeNameservers makes sure each nameserver is in the "host:port" format,
+// adding defaultPort if the port is missing. DNS-over-HTTPS resolver URLs are
+// validated, but otherwise left as-is.
+func normalizeNameservers(nameservers []string, defaultPort string) ([]string, error) {
+	// Make sure each of the nameservers is in the "host:port" format.
+	//
+	// The "dns" package requires that you explicitly state the port
+	// number for the resolvers that get queried.
+	normalized := make([]string, len(nameservers))
+	copy(normalized, nameservers)
+
+	for index := range normalized {
+		if strings.HasPrefix(normalized[index], "https://") {
+			resolverURL, err := url.Parse(normalized[index])
+			if err != nil || resolverURL.Host == "" {
+				return nil, fmt.Errorf("invalid resolver URL: %s", normalized[index])
+			}
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(normalized[index])
+		if err != nil {
+			// might contain a port
+			host, port, err := net.SplitHostPort(normalized[index])
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address: %s", normalized[index])
+			}
+
+			// validate IP
+			addr, err = netip.ParseAddr(host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address: %s", normalized[index])
+			}
+
+			if addr.Is6() {
+				normalized[index] = fmt.Sprintf("[%s]:%v", addr.String(), port)
+			} else {
+				normalized[index] = fmt.Sprintf("%s:%v", addr.String(), port)
+			}
+
+			continue
+		}
+
+		if addr.Is6() {
+			normalized[index] = fmt.Sprintf("[%s]:%s", addr.String(), defaultPort)
+		} else {
+			normalized[index] = fmt.Sprintf("%s:%s", addr.String(), defaultPort)
+		}
+	}
+
+	return normalized, nil
+}
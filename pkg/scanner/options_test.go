@@ -30,6 +30,22 @@ func TestOptionOverwrite(t *testing.T) {
 	})
 }
 
+func TestOptionWithAuthoritativePort(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("ValidPort", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithAuthoritativePort("5353"))
+		require.NoError(t, err)
+		require.Equal(t, "5353", scanner.authoritativePort)
+	})
+
+	t.Run("InvalidPort", func(t *testing.T) {
+		_, err := New(logger, timeout, WithAuthoritativePort("65536"))
+		require.ErrorContains(t, err, "invalid authoritative port")
+	})
+}
+
 func TestOptionWithCacheDuration(t *testing.T) {
 	logger := zerolog.Nop()
 	timeout := time.Second * 5
@@ -154,6 +170,55 @@ func TestOptionWithDNSProtocol(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, "udp", scanner.dnsClient.Net)
 	})
+
+	t.Run("ValidProtocolHTTPS", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithDNSProtocol("HTTPS"), WithNameservers([]string{"https://dns.google/dns-query"}))
+		require.NoError(t, err)
+		require.Equal(t, "https", scanner.dnsProtocol)
+		require.IsType(t, &dohResolver{}, scanner.resolver)
+	})
+
+	t.Run("HTTPSWithoutResolverURLs", func(t *testing.T) {
+		_, err := New(logger, timeout, WithDNSProtocol("https"), WithNameservers([]string{"8.8.8.8"}))
+		require.ErrorContains(t, err, "DNS-over-HTTPS requires resolver URLs")
+	})
+
+	t.Run("ResolverURLsWithoutHTTPS", func(t *testing.T) {
+		_, err := New(logger, timeout, WithNameservers([]string{"https://dns.google/dns-query"}))
+		require.ErrorContains(t, err, "is a URL")
+	})
+}
+
+func TestOptionWithDNSHTTPMethod(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("ValidMethod", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithDNSHTTPMethod("get"))
+		require.NoError(t, err)
+		require.Equal(t, "GET", scanner.dnsHTTPMethod)
+	})
+
+	t.Run("InvalidMethod", func(t *testing.T) {
+		_, err := New(logger, timeout, WithDNSHTTPMethod("PUT"))
+		require.ErrorContains(t, err, "invalid DNS HTTP method")
+	})
+}
+
+func TestOptionWithDNSRetryBackoff(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("ValidBackoff", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithDNSRetryBackoff(time.Second))
+		require.NoError(t, err)
+		require.Equal(t, time.Second, scanner.dnsRetryBackoff)
+	})
+
+	t.Run("NegativeBackoff", func(t *testing.T) {
+		_, err := New(logger, timeout, WithDNSRetryBackoff(-time.Second))
+		require.ErrorContains(t, err, "must not be negative")
+	})
 }
 
 func TestOptionWithNameservers(t *testing.T) {
@@ -174,24 +239,95 @@ func TestOptionWithNameservers(t *testing.T) {
 	t.Run("ValidNameserverWithPort", func(t *testing.T) {
 		scanner, err := New(logger, timeout, WithNameservers([]string{"8.8.8.8:53"}))
 		require.NoError(t, err)
-		require.Equal(t, []string{"8.8.8.8:53"}, scanner.nameservers)
+		require.Equal(t, []string{"8.8.8.8:53"}, scanner.resolver.(*dnsResolver).nameservers.nameservers)
 	})
 
 	t.Run("ValidNameserverWithoutPort", func(t *testing.T) {
 		scanner, err := New(logger, timeout, WithNameservers([]string{"8.8.8.8"}))
 		require.NoError(t, err)
-		require.Equal(t, []string{"8.8.8.8:53"}, scanner.nameservers)
+		require.Equal(t, []string{"8.8.8.8:53"}, scanner.resolver.(*dnsResolver).nameservers.nameservers)
 	})
 
 	t.Run("ValidNameserverWithPortV6", func(t *testing.T) {
 		scanner, err := New(logger, timeout, WithNameservers([]string{"[2001:4860:4860::8888]:53"}))
 		require.NoError(t, err)
-		require.Equal(t, []string{"[2001:4860:4860::8888]:53"}, scanner.nameservers)
+		require.Equal(t, []string{"[2001:4860:4860::8888]:53"}, scanner.resolver.(*dnsResolver).nameservers.nameservers)
 	})
 
 	t.Run("ValidNameserverWithoutPortV6", func(t *testing.T) {
 		scanner, err := New(logger, timeout, WithNameservers([]string{"2001:4860:4860::8888"}))
 		require.NoError(t, err)
-		require.Equal(t, []string{"[2001:4860:4860::8888]:53"}, scanner.nameservers)
+		require.Equal(t, []string{"[2001:4860:4860::8888]:53"}, scanner.resolver.(*dnsResolver).nameservers.nameservers)
+	})
+
+	t.Run("QUICNameserverWithoutPort", func(t *testing.T) {
+		// the port depends on the protocol, whichever order the options are given in
+		scanner, err := New(logger, timeout, WithNameservers([]string{"9.9.9.9", "2620:fe::fe", "149.112.112.112:8853"}), WithDNSProtocol("quic"))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		require.Equal(t, []string{"9.9.9.9:853", "[2620:fe::fe]:853", "149.112.112.112:8853"}, scanner.resolver.(*doqResolver).nameservers.nameservers)
+	})
+
+	t.Run("TLSNameserverWithoutPort", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithDNSProtocol("tcp-tls"), WithNameservers([]string{"9.9.9.9"}))
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"9.9.9.9:853"}, scanner.resolver.(*dnsResolver).nameservers.nameservers)
+	})
+}
+
+func TestOptionWithResolver(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("DefaultResolver", func(t *testing.T) {
+		scanner, err := New(logger, timeout)
+		require.NoError(t, err)
+		require.IsType(t, &dnsResolver{}, scanner.resolver)
+	})
+
+	t.Run("CustomResolver", func(t *testing.T) {
+		resolver := &mockResolver{}
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		require.Equal(t, resolver, scanner.resolver)
+	})
+
+	t.Run("NilResolver", func(t *testing.T) {
+		_, err := New(logger, timeout, WithResolver(nil))
+		require.ErrorContains(t, err, "invalid resolver")
+	})
+}
+
+func TestOptionWithRootHints(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("ValidHints", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithRootHints("198.41.0.4", "[2001:503:ba3e::2:30]:53"))
+		require.NoError(t, err)
+		require.Equal(t, []string{"198.41.0.4:53", "[2001:503:ba3e::2:30]:53"}, scanner.rootHints)
+	})
+
+	t.Run("InvalidHint", func(t *testing.T) {
+		_, err := New(logger, timeout, WithRootHints("a.root-servers.net"))
+		require.ErrorContains(t, err, "invalid root hint")
+	})
+}
+
+func TestOptionWithScanTimeout(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("ValidScanTimeout", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithScanTimeout(time.Second*30))
+		require.NoError(t, err)
+		require.Equal(t, time.Second*30, scanner.scanTimeout)
+	})
+
+	t.Run("NegativeScanTimeout", func(t *testing.T) {
+		_, err := New(logger, timeout, WithScanTimeout(-time.Second))
+		require.ErrorContains(t, err, "invalid scan timeout")
 	})
 }
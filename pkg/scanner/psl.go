@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+)
+
+// embeddedPublicSuffixList is a snapshot of the Public Suffix List, as published at
+// https://publicsuffix.org/list/public_suffix_list.dat.
+//
+//go:embed public_suffix_list.dat
+var embeddedPublicSuffixList string
+
+// defaultPublicSuffixList parses the embedded Public Suffix List once, as it's shared by every scanner that doesn't
+// load its own.
+var defaultPublicSuffixList = sync.OnceValues(func() (*publicSuffixList, error) {
+	return parsePublicSuffixList(strings.NewReader(embeddedPublicSuffixList))
+})
+
+// publicSuffixList holds the rules of the Public Suffix List, keyed by the suffix they apply to.
+type publicSuffixList struct {
+	rules      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+}
+
+// parsePublicSuffixList parses a list in the format described at https://publicsuffix.org/list/. Both the ICANN and
+// private sections are used, as browsers and DMARC receivers do.
+func parsePublicSuffixList(reader io.Reader) (*publicSuffixList, error) {
+	list := &publicSuffixList{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		// rules end at the first whitespace, and anything after it is ignored
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+
+		rule, err := idna.ToASCII(strings.ToLower(fields[0]))
+		if err != nil {
+			rule = strings.ToLower(fields[0])
+		}
+
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			list.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			list.wildcards[rule[2:]] = true
+		default:
+			list.rules[rule] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(list.rules) == 0 && len(list.wildcards) == 0 {
+		return nil, errors.New("no rules found")
+	}
+
+	return list, nil
+}
+
+// publicSuffix returns the public suffix of a domain, using the algorithm described at
+// https://publicsuffix.org/list/. Domains which don't match any rule use the implicit "*" rule.
+func (l *publicSuffixList) publicSuffix(domain string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	suffixLabels := 1
+
+	for index := range labels {
+		suffix := strings.Join(labels[index:], ".")
+
+		// exception rules always take priority, and make the suffix their parent
+		if l.exceptions[suffix] {
+			return strings.Join(labels[index+1:], ".")
+		}
+
+		if l.rules[suffix] {
+			suffixLabels = max(suffixLabels, len(labels)-index)
+		}
+
+		if index+1 < len(labels) && l.wildcards[strings.Join(labels[index+1:], ".")] {
+			suffixLabels = max(suffixLabels, len(labels)-index)
+		}
+	}
+
+	return strings.Join(labels[len(labels)-suffixLabels:], ".")
+}
+
+// organizationalDomain returns the organizational domain of a domain (RFC 7489, section 3.2), which is its public
+// suffix plus one label. Public suffixes are their own organizational domain.
+func (l *publicSuffixList) organizationalDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	suffix := l.publicSuffix(domain)
+
+	if domain == suffix {
+		return domain
+	}
+
+	labels := strings.Split(strings.TrimSuffix(domain, "."+suffix), ".")
+
+	return labels[len(labels)-1] + "." + suffix
+}
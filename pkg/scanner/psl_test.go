@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicSuffixList(t *testing.T) {
+	list, err := defaultPublicSuffixList()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		domain               string
+		organizationalDomain string
+	}{
+		{domain: "example.com", organizationalDomain: "example.com"},
+		{domain: "mail.example.com.", organizationalDomain: "example.com"},
+		{domain: "mail.example.co.uk", organizationalDomain: "example.co.uk"},
+		{domain: "a.b.Example.CO.UK", organizationalDomain: "example.co.uk"},
+		{domain: "co.uk", organizationalDomain: "co.uk"},
+		{domain: "mail.example.unknowntld", organizationalDomain: "example.unknowntld"},
+		// wildcard and exception rules (*.ck and !www.ck)
+		{domain: "mail.example.foo.ck", organizationalDomain: "example.foo.ck"},
+		{domain: "mail.www.ck", organizationalDomain: "www.ck"},
+		// private section rules
+		{domain: "example.github.io", organizationalDomain: "example.github.io"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.domain, func(t *testing.T) {
+			require.Equal(t, testCase.organizationalDomain, list.organizationalDomain(testCase.domain))
+		})
+	}
+}
+
+func TestWithPublicSuffixList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "public_suffix_list.dat")
+	require.NoError(t, os.WriteFile(path, []byte("// test list\nexample\nco.example\n"), 0o600))
+
+	scanner, err := New(zerolog.Nop(), time.Second, WithPublicSuffixList(path))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	require.Equal(t, "example.co.example", scanner.publicSuffixList.organizationalDomain("mail.example.co.example"))
+
+	require.NoError(t, os.WriteFile(path, []byte("// no rules\n"), 0o600))
+
+	_, err = New(zerolog.Nop(), time.Second, WithPublicSuffixList(path))
+	require.Error(t, err)
+}
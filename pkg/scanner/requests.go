@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -8,17 +9,21 @@ import (
 )
 
 const (
-	DefaultBIMIPrefix  = "v=BIMI1;"
-	DefaultDKIMPrefix  = "v=DKIM1;"
-	DefaultDMARCPrefix = "v=DMARC1;"
-	DefaultSPFPrefix   = "v=spf1 "
+	DefaultBIMIPrefix   = "v=BIMI1;"
+	DefaultDKIMPrefix   = "v=DKIM1;"
+	DefaultDMARCPrefix  = "v=DMARC1;"
+	DefaultMTASTSPrefix = "v=STSv1"
+	DefaultSPFPrefix    = "v=spf1 "
+	DefaultTLSRPTPrefix = "v=TLSRPTv1"
 )
 
 var (
-	BIMIPrefix  = DefaultBIMIPrefix
-	DKIMPrefix  = DefaultDKIMPrefix
-	DMARCPrefix = DefaultDMARCPrefix
-	SPFPrefix   = DefaultSPFPrefix
+	BIMIPrefix   = DefaultBIMIPrefix
+	DKIMPrefix   = DefaultDKIMPrefix
+	DMARCPrefix  = DefaultDMARCPrefix
+	MTASTSPrefix = DefaultMTASTSPrefix
+	SPFPrefix    = DefaultSPFPrefix
+	TLSRPTPrefix = DefaultTLSRPTPrefix
 
 	// knownDkimSelectors is a list of known DKIM selectors.
 	knownDkimSelectors = []string{
@@ -39,8 +44,8 @@ var (
 
 // getDNSRecords queries the DNS server for records of a specific type for a domain.
 // It returns a slice of strings (the records) and an error if any occurred.
-func (s *Scanner) getDNSRecords(domain string, recordType uint16) (records []string, err error) {
-	answers, err := s.getDNSAnswers(domain, recordType)
+func (s *Scanner) getDNSRecords(ctx context.Context, domain string, recordType uint16) (records []string, err error) {
+	answers, err := s.getDNSAnswers(ctx, domain, recordType)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +53,7 @@ func (s *Scanner) getDNSRecords(domain string, recordType uint16) (records []str
 	for _, answer := range answers {
 		if answer.Header().Rrtype == dns.TypeCNAME {
 			if t, ok := answer.(*dns.CNAME); ok {
-				recursiveLookupTxt, err := s.getDNSRecords(t.Target, recordType)
+				recursiveLookupTxt, err := s.getDNSRecords(ctx, t.Target, recordType)
 				if err != nil {
 					return nil, fmt.Errorf("failed to recursively lookup txt record for %v: %w", t.Target, err)
 				}
@@ -80,98 +85,83 @@ func (s *Scanner) getDNSRecords(domain string, recordType uint16) (records []str
 
 // getDNSAnswers queries the DNS server for answers to a specific question.
 // It returns a slice of dns.RR (DNS resource records) and an error if any occurred.
-func (s *Scanner) getDNSAnswers(domain string, recordType uint16) ([]dns.RR, error) {
+func (s *Scanner) getDNSAnswers(ctx context.Context, domain string, recordType uint16) ([]dns.RR, error) {
+	in, err := s.getDNSResponse(ctx, domain, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	// disregard NXDOMAIN errors
+	if in.Rcode == dns.RcodeNameError {
+		return nil, nil
+	}
+
+	return in.Answer, nil
+}
+
+// getDNSResponse queries the DNS server for a specific question, returning the
+// whole response. Responses with an rcode other than NOERROR or NXDOMAIN, and
+// failed queries, are returned as a *QueryError.
+func (s *Scanner) getDNSResponse(ctx context.Context, domain string, recordType uint16) (*dns.Msg, error) {
 	req := &dns.Msg{}
 	req.Id = dns.Id()
 	req.RecursionDesired = true
 	req.SetEdns0(s.dnsBuffer, true) // increases the response buffer size
 	req.SetQuestion(dns.Fqdn(domain), recordType)
 
-	in, _, err := s.dnsClient.Exchange(req, s.getNS())
+	// the built-in validator checks the signatures itself, so ask for answers even if the nameserver considers them bogus
+	req.CheckingDisabled = s.dnssecValidator != nil
+
+	resp, err := s.exchange(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, newQueryError(req.Question[0].Name, dns.TypeToString[recordType], err)
 	}
 
+	in := resp.Msg
+
 	if in.Rcode != dns.RcodeSuccess {
-		// disregard NXDOMAIN errors
 		if in.Rcode == dns.RcodeNameError {
-			return nil, nil
+			return in, nil
 		}
 
-		return nil, fmt.Errorf("DNS query failed with rcode %v", in.Rcode)
-	}
-
-	if in.MsgHdr.Truncated && s.dnsBuffer < 4096 {
-		s.logger.Warn().Msg(fmt.Sprintf("DNS buffer %v was too small for %v, retrying with larger buffer (4096)", s.dnsBuffer, domain))
-
-		req.SetEdns0(4096, true)
-
-		in, _, err = s.dnsClient.Exchange(req, s.getNS())
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return in.Answer, nil
-}
-
-func (s *Scanner) getTypeBIMI(domain string) (string, error) {
-	for _, dname := range []string{
-		"default._bimi." + domain,
-		domain,
-	} {
-		records, err := s.getDNSRecords(dname, dns.TypeTXT)
-		if err != nil {
-			return "", err
-		}
+		trackerFromContext(ctx).observeDNSSEC(s.dnssecStatus(ctx, in))
 
-		for index, record := range records {
-			if strings.HasPrefix(record, BIMIPrefix) {
-				// TXT records can be split across multiple strings, so we need to join them
-				return strings.Join(records[index:], ""), nil
-			}
+		return nil, &QueryError{
+			Name:       req.Question[0].Name,
+			Type:       dns.TypeToString[recordType],
+			Class:      QueryErrorRcode,
+			Rcode:      dns.RcodeToString[in.Rcode],
+			Nameserver: resp.Nameserver,
 		}
 	}
 
-	return "", nil
-}
-
-// getTypeDKIM queries the DNS server for DKIM records of a domain.
-// It returns a string (DKIM record) and an error if any occurred.
-func (s *Scanner) getTypeDKIM(domain string) (string, error) {
-	selectors := append(s.dkimSelectors, knownDkimSelectors...)
+	trackerFromContext(ctx).observeDNSSEC(s.dnssecStatus(ctx, in))
 
-	for _, selector := range selectors {
-		records, err := s.getDNSRecords(selector+"._domainkey."+domain, dns.TypeTXT)
-		if err != nil {
-			return "", err
-		}
-
-		for index, record := range records {
-			if strings.HasPrefix(record, DKIMPrefix) {
-				// TXT records can be split across multiple strings, so we need to join them
-				return strings.Join(records[index:], ""), nil
-			}
-		}
+	if size := responseSize(in); resp.TCPFallback || size > maxUDPResponseSize {
+		trackerFromContext(ctx).observeLargeResponse(LargeResponse{
+			Name: dns.Fqdn(domain),
+			Type: dns.TypeToString[recordType],
+			Size: size,
+			TCP:  resp.TCPFallback,
+			SPF:  includesSPF(in),
+		})
 	}
 
-	return "", nil
+	return in, nil
 }
 
-// getTypeDMARC queries the DNS server for DMARC records of a domain.
-// It returns a string (DMARC record) and an error if any occurred.
-func (s *Scanner) getTypeDMARC(domain string) (string, error) {
+func (s *Scanner) getTypeBIMI(ctx context.Context, domain string) (string, error) {
 	for _, dname := range []string{
-		"_dmarc." + domain,
+		"default._bimi." + domain,
 		domain,
 	} {
-		records, err := s.getDNSRecords(dname, dns.TypeTXT)
+		records, err := s.getDNSRecords(ctx, dname, dns.TypeTXT)
 		if err != nil {
 			return "", err
 		}
 
 		for index, record := range records {
-			if strings.HasPrefix(record, DMARCPrefix) {
+			if strings.HasPrefix(record, BIMIPrefix) {
 				// TXT records can be split across multiple strings, so we need to join them
 				return strings.Join(records[index:], ""), nil
 			}
@@ -181,27 +171,18 @@ func (s *Scanner) getTypeDMARC(domain string) (string, error) {
 	return "", nil
 }
 
-// getTypeSPF queries the DNS server for SPF records of a domain.
-// It returns a string (SPF record) and an error if any occurred.
-func (s *Scanner) getTypeSPF(domain string) (string, error) {
-	records, err := s.getDNSRecords(domain, dns.TypeTXT)
+// getTypeTLSRPT queries the DNS server for the SMTP TLS Reporting record of a domain.
+// It returns a string (TLS-RPT record) and an error if any occurred.
+func (s *Scanner) getTypeTLSRPT(ctx context.Context, domain string) (string, error) {
+	records, err := s.getDNSRecords(ctx, "_smtp._tls."+domain, dns.TypeTXT)
 	if err != nil {
 		return "", err
 	}
 
-	for _, record := range records {
-		if strings.HasPrefix(record, SPFPrefix) {
-			if !strings.Contains(record, "redirect=") {
-				return record, nil
-			}
-
-			parts := strings.Fields(record)
-			for _, part := range parts {
-				if strings.Contains(part, "redirect=") {
-					redirectDomain := strings.TrimPrefix(part, "redirect=")
-					return s.getTypeSPF(redirectDomain)
-				}
-			}
+	for index, record := range records {
+		if strings.HasPrefix(record, TLSRPTPrefix) {
+			// TXT records can be split across multiple strings, so we need to join them
+			return strings.Join(records[index:], ""), nil
 		}
 	}
 
@@ -0,0 +1,205 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
+	"github.com/miekg/dns"
+)
+
+type (
+	// Resolver sends DNS queries on behalf of a *Scanner. Every query the
+	// scanner makes goes through its Resolver, so custom transports, caching
+	// layers or test doubles can be plugged in via WithResolver.
+	//
+	// Implementations must be safe for concurrent use.
+	Resolver interface {
+		// Exchange sends the query and returns the response. A response
+		// with a non-success rcode should be returned as-is, rather than as
+		// an error.
+		Exchange(ctx context.Context, req *dns.Msg) (*Response, error)
+	}
+
+	// Response holds a DNS response, along with details of how it was obtained.
+	Response struct {
+		// Msg is the DNS message received.
+		Msg *dns.Msg
+
+		// Nameserver is the address of the nameserver that responded.
+		Nameserver string
+
+		// RTT is the round trip time of the query.
+		RTT time.Duration
+
+		// TCPFallback is whether the response over UDP was truncated, so the query was retried over TCP.
+		TCPFallback bool
+	}
+
+	// dnsResolver is the default Resolver, which sends queries over UDP, TCP
+	// or TCP-TLS via miekg/dns, rotating through a set of nameservers.
+	dnsResolver struct {
+		// DNS client shared by all goroutines the scanner spawns.
+		client *dns.Client
+
+		// tcpClient retries queries whose UDP responses were truncated. It's nil unless client uses UDP.
+		tcpClient *dns.Client
+
+		// nameservers rotates queries through the "host:port" strings of nameservers to issue queries against.
+		nameservers *nameserverPool
+	}
+)
+
+// newDefaultResolver creates the resolver for the scanner's configured DNS
+// protocol and nameservers.
+func (s *Scanner) newDefaultResolver() (Resolver, error) {
+	return s.newResolver(s.nameservers, s.dnsClient.Timeout)
+}
+
+// newResolver creates a resolver for the scanner's configured DNS protocol,
+// which sends queries to the given nameservers.
+func (s *Scanner) newResolver(nameserverList []string, timeout time.Duration) (Resolver, error) {
+	if s.iterative {
+		return s.newIterativeResolver(timeout)
+	}
+
+	nameserverList, err := normalizeNameservers(nameserverList, defaultDNSPort(s.dnsProtocol))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nameserver := range nameserverList {
+		isURL := strings.HasPrefix(nameserver, "https://")
+
+		if s.dnsProtocol == "https" && !isURL {
+			return nil, fmt.Errorf("DNS-over-HTTPS requires resolver URLs (such as https://dns.google/dns-query), got %s", nameserver)
+		}
+
+		if s.dnsProtocol != "https" && isURL {
+			return nil, fmt.Errorf("nameserver %s is a URL, but the DNS protocol is %s", nameserver, s.dnsProtocol)
+		}
+	}
+
+	nameservers := s.nameserverPool(nameserverList)
+
+	switch s.dnsProtocol {
+	case "https":
+		return newDoHResolver(timeout, s.dnsClient.TLSConfig, s.dnsHTTPMethod, nameservers, int(s.poolSize)), nil
+	case "quic":
+		return newDoQResolver(timeout, s.dnsClient.TLSConfig, nameservers), nil
+	default:
+		client := s.dnsClient
+		if timeout != client.Timeout {
+			clientCopy := *client
+			clientCopy.Timeout = timeout
+			client = &clientCopy
+		}
+
+		return newDNSResolver(client, nameservers), nil
+	}
+}
+
+// newIterativeResolver creates a resolver which resolves queries itself from
+// the root servers, ignoring the scanner's nameservers.
+func (s *Scanner) newIterativeResolver(timeout time.Duration) (Resolver, error) {
+	// authoritative nameservers only speak plain DNS
+	if s.dnsProtocol != "udp" && s.dnsProtocol != "tcp" {
+		return nil, fmt.Errorf("iterative resolution requires the udp or tcp DNS protocol, got %s", s.dnsProtocol)
+	}
+
+	roots := s.rootHints
+	if len(roots) == 0 {
+		for _, address := range defaultRootHints {
+			roots = append(roots, net.JoinHostPort(address, "53"))
+		}
+	}
+
+	// delegations are shared by every resolver the scanner creates, including those for a single scan
+	if s.delegations == nil {
+		s.delegations = cache.New[delegation](iterativeDelegationCacheDuration)
+	}
+
+	return newIterativeResolver(&dns.Client{Net: s.dnsProtocol, Timeout: timeout}, roots, s.authoritativePort, s.delegations), nil
+}
+
+func newDNSResolver(client *dns.Client, nameservers *nameserverPool) *dnsResolver {
+	resolver := &dnsResolver{
+		client:      client,
+		nameservers: nameservers,
+	}
+
+	if client.Net == "" || client.Net == "udp" {
+		resolver.tcpClient = &dns.Client{
+			Net:     "tcp",
+			Dialer:  client.Dialer,
+			Timeout: client.Timeout,
+		}
+	}
+
+	return resolver
+}
+
+// Exchange sends a query to the next nameserver in the rotation, failing over
+// to the next one if it fails. Cancelling ctx aborts the in-flight query,
+// rather than waiting for the per-query timeout to elapse.
+func (r *dnsResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	return r.nameservers.exchange(ctx, func(ctx context.Context, nameserver string) (*Response, error) {
+		return r.query(ctx, req, nameserver)
+	})
+}
+
+// query sends a query to a single nameserver. If the UDP response is
+// truncated, the query is retried over TCP (RFC 7766, section 5).
+func (r *dnsResolver) query(ctx context.Context, req *dns.Msg, nameserver string) (*Response, error) {
+	in, rtt, err := r.exchange(ctx, r.client, req, nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{
+		Msg:        in,
+		Nameserver: nameserver,
+		RTT:        rtt,
+	}
+
+	if in.Truncated && r.tcpClient != nil {
+		in, rtt, err = r.exchange(ctx, r.tcpClient, req, nameserver)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retry truncated response over TCP: %w", err)
+		}
+
+		resp.Msg = in
+		resp.RTT += rtt
+		resp.TCPFallback = true
+	}
+
+	return resp, nil
+}
+
+// exchange sends a query to a single nameserver using client.
+func (r *dnsResolver) exchange(ctx context.Context, client *dns.Client, req *dns.Msg, nameserver string) (*dns.Msg, time.Duration, error) {
+	conn, err := client.DialContext(ctx, nameserver)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	in, rtt, err := client.ExchangeWithConnContext(ctx, req, conn)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, 0, ctxErr
+		}
+
+		return nil, 0, err
+	}
+
+	return in, rtt, nil
+}
@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxUDPResponseSize is the largest response that can be sent reliably over
+// UDP without IP fragmentation, and is the EDNS buffer size recommended by DNS
+// Flag Day 2020. Larger responses are truncated by many resolvers, which then
+// have to retry over TCP.
+const maxUDPResponseSize = 1232
+
+// LargeResponse is a DNS response which was too large to be sent reliably over
+// UDP.
+type LargeResponse struct {
+	Name string `json:"name" yaml:"name" doc:"The name that was queried." example:"example.com."`
+	Type string `json:"type" yaml:"type" doc:"The record type that was queried." example:"TXT"`
+	Size int    `json:"size" yaml:"size" doc:"The size of the response in bytes." example:"1536"`
+	TCP  bool   `json:"tcp,omitempty" yaml:"tcp,omitempty" doc:"Whether the UDP response was truncated, so the query had to be retried over TCP."`
+	SPF  bool   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"Whether the response includes an SPF record."`
+}
+
+// responseSize returns the size of a response on the wire, with name
+// compression applied as nameservers do. The response is shared with the
+// caller, so a copy of it is measured.
+func responseSize(msg *dns.Msg) int {
+	msg = msg.Copy()
+	msg.Compress = true
+
+	return msg.Len()
+}
+
+// includesSPF reports whether a response's answers include an SPF record.
+func includesSPF(msg *dns.Msg) bool {
+	for _, answer := range msg.Answer {
+		if txt, ok := answer.(*dns.TXT); ok && strings.HasPrefix(strings.Join(txt.Txt, ""), SPFPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
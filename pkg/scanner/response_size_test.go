@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPFallback(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	var records []string
+	for i := range 8 {
+		records = append(records, `example.com. 300 IN TXT "verification-`+string(rune('a'+i))+`=`+strings.Repeat("x", 200)+`"`)
+	}
+
+	// the records don't fit in a UDP response, so they're only answered in full over TCP
+	newNameserver := func(t *testing.T, queries *atomic.Int32) string {
+		nameserver := newFakeDNS(t, records...)
+		nameserver.maxUDPSize = maxUDPResponseSize
+		nameserver.queries = queries
+
+		return nameserver.listen(t, "udp", "tcp")
+	}
+
+	t.Run("TruncatedResponse", func(t *testing.T) {
+		var queries atomic.Int32
+		nameserver := newNameserver(t, &queries)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{nameserver}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		ctx, tracker := withQueryTracker(context.Background())
+
+		records, err := scanner.getDNSRecords(ctx, "example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Len(t, records, 8)
+		require.Equal(t, int32(2), queries.Load())
+
+		responses := tracker.largeResponseList()
+		require.Len(t, responses, 1)
+		require.Equal(t, "example.com.", responses[0].Name)
+		require.Equal(t, "TXT", responses[0].Type)
+		require.Greater(t, responses[0].Size, maxUDPResponseSize)
+		require.True(t, responses[0].TCP)
+	})
+
+	t.Run("TCPProtocol", func(t *testing.T) {
+		var queries atomic.Int32
+		nameserver := newNameserver(t, &queries)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{nameserver}), WithDNSProtocol("tcp"))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		ctx, tracker := withQueryTracker(context.Background())
+
+		records, err := scanner.getDNSRecords(ctx, "example.com", dns.TypeTXT)
+		require.NoError(t, err)
+		require.Len(t, records, 8)
+		require.Equal(t, int32(1), queries.Load())
+
+		// the response is still large, but it didn't have to be retried
+		responses := tracker.largeResponseList()
+		require.Len(t, responses, 1)
+		require.False(t, responses[0].TCP)
+	})
+}
+
+func TestScanLargeResponses(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	records := []string{
+		"example.com. 300 IN NS ns1.example.com.",
+		`example.com. 300 IN TXT "v=spf1 -all"`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`,
+	}
+
+	for i := range 8 {
+		records = append(records, `example.com. 300 IN TXT "verification-`+string(rune('a'+i))+`=`+strings.Repeat("x", 200)+`"`)
+	}
+
+	scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, records...)))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.Equal(t, "v=spf1 -all", result.SPF)
+	require.Equal(t, "v=DMARC1; p=reject", result.DMARC)
+	require.Len(t, result.LargeResponses, 1)
+	require.Equal(t, "example.com.", result.LargeResponses[0].Name)
+	require.Equal(t, "TXT", result.LargeResponses[0].Type)
+	require.False(t, result.LargeResponses[0].TCP)
+	require.True(t, result.LargeResponses[0].SPF)
+}
+
+func TestResponseSize(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeTXT)
+
+	for range 4 {
+		rr, err := dns.NewRR(`example.com. 300 IN TXT "v=spf1 -all"`)
+		require.NoError(t, err)
+
+		msg.Answer = append(msg.Answer, rr)
+	}
+
+	// the size is measured with compression, without changing the response
+	require.Less(t, responseSize(msg), msg.Len())
+	require.False(t, msg.Compress)
+	require.True(t, includesSPF(msg))
+}
@@ -0,0 +1,299 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The checks which can be run against a domain, as used by ScanOptions.Checks
+// and CheckError.Check.
+const (
+	CheckBIMI   = "bimi"
+	CheckDKIM   = "dkim"
+	CheckDMARC  = "dmarc"
+	CheckDNSSEC = "dnssec"
+	CheckMTASTS = "mta-sts"
+	CheckMX     = "mx"
+	CheckSPF    = "spf"
+	CheckTLSRPT = "tlsrpt"
+)
+
+// These checks are reported in CheckError.Check, but they can't be selected
+// through ScanOptions.Checks. The TLSA records are looked up for each mail
+// server found by CheckMX, as part of that check, and the authoritative
+// nameservers are only checked when ScanOptions.Authoritative (or
+// WithAuthoritativeCheck) is set, as it needs the results of the other checks.
+const (
+	CheckAuthoritative = "authoritative"
+	CheckTLSA          = "tlsa"
+)
+
+// checks lists every check, in the order they're reported.
+var checks = []string{CheckBIMI, CheckDKIM, CheckDMARC, CheckDNSSEC, CheckMTASTS, CheckMX, CheckSPF, CheckTLSRPT}
+
+type (
+	// ScanOptions override the scanner's configuration for a single call to
+	// ScanWithOptions, without affecting any other scans. Zero values fall
+	// back to the scanner's configuration.
+	ScanOptions struct {
+		// Authoritative checks that the domain's authoritative nameservers
+		// agree with each other, as with WithAuthoritativeCheck.
+		Authoritative bool
+
+		// Checks limits the scan to the named checks (such as CheckDKIM). The
+		// fields for any other checks are left empty, so advice for them
+		// won't be meaningful. Every check is run if it's empty.
+		Checks []string
+
+		// DKIMSelectors are scanned for alongside the known selectors, instead
+		// of those set by WithDKIMSelectors.
+		DKIMSelectors []string
+
+		// Evidence records every DNS query made in Result.Evidence, as with
+		// WithEvidence.
+		Evidence bool
+
+		// Nameservers are queried instead of the scanner's nameservers, using
+		// the scanner's DNS protocol. They can't be used with WithResolver or
+		// WithIterativeResolution.
+		Nameservers []string
+
+		// Parked marks the domain as one which doesn't send or receive mail,
+		// setting Result.Parked, so that it's advised against the parked
+		// domain profile even if it doesn't publish a null MX record.
+		Parked bool
+
+		// QueryTimeout is the timeout for each DNS query.
+		QueryTimeout time.Duration
+
+		// ScanTimeout is the overall deadline for scanning a single domain.
+		ScanTimeout time.Duration
+	}
+
+	// scanConfig is the configuration for a single scan, combining the
+	// scanner's configuration with any ScanOptions.
+	scanConfig struct {
+		// authoritative is set when the domain's authoritative nameservers should be checked for consistency.
+		authoritative bool
+
+		// cacheKey identifies the options in the result cache, so that results
+		// scanned with different options are cached separately.
+		cacheKey string
+
+		// checks is the set of checks to run, or nil to run every check.
+		checks map[string]bool
+
+		dkimSelectors []string
+
+		// evidence is set when every query should be recorded in the result.
+		evidence bool
+
+		// parked is set when the domain is known not to send or receive mail.
+		parked bool
+
+		// ownsResolver is set when resolver was created for the scan, and must be closed once it's finished.
+		ownsResolver bool
+
+		// queryTimeout is the timeout for each DNS query.
+		queryTimeout time.Duration
+
+		resolver Resolver
+
+		// resolverTimeout bounds each call to a custom resolver, which the scanner can't otherwise configure.
+		resolverTimeout time.Duration
+
+		scanTimeout time.Duration
+	}
+
+	// scanConfigContextKey is the context key for a *scanConfig.
+	scanConfigContextKey struct{}
+)
+
+// newScanConfig validates opts, and combines them with the scanner's
+// configuration. If the options call for different nameservers or query
+// timeouts, a new resolver is created for them, which the caller must close.
+func (s *Scanner) newScanConfig(opts ScanOptions) (*scanConfig, error) {
+	config := &scanConfig{
+		authoritative: s.authoritative,
+		dkimSelectors: s.dkimSelectors,
+		evidence:      s.evidence,
+		queryTimeout:  s.dnsClient.Timeout,
+		resolver:      s.resolver,
+		scanTimeout:   s.scanTimeout,
+	}
+
+	var key []string
+
+	if opts.Authoritative && !s.authoritative {
+		config.authoritative = true
+		key = append(key, "authoritative")
+	}
+
+	if len(opts.Checks) > 0 {
+		config.checks = make(map[string]bool)
+
+		for _, check := range opts.Checks {
+			check = strings.ToLower(check)
+			if !slices.Contains(checks, check) {
+				return nil, fmt.Errorf("invalid check: %s, valid options: %s", check, strings.Join(checks, ", "))
+			}
+
+			config.checks[check] = true
+		}
+
+		// sort the checks, as their order doesn't affect the result
+		var enabled []string
+		for _, check := range checks {
+			if config.checks[check] {
+				enabled = append(enabled, check)
+			}
+		}
+
+		key = append(key, "checks="+strings.Join(enabled, ","))
+	}
+
+	if len(opts.DKIMSelectors) > 0 {
+		for _, selector := range opts.DKIMSelectors {
+			if err := validateDKIMSelector(selector); err != nil {
+				return nil, fmt.Errorf("invalid DKIM selector: %w", err)
+			}
+		}
+
+		// sort and deduplicate the selectors, as their order doesn't affect the result
+		config.dkimSelectors = slices.Clone(opts.DKIMSelectors)
+		slices.Sort(config.dkimSelectors)
+		config.dkimSelectors = slices.Compact(config.dkimSelectors)
+		key = append(key, "dkimSelectors="+strings.Join(config.dkimSelectors, ","))
+	}
+
+	if opts.Evidence && !s.evidence {
+		config.evidence = true
+		key = append(key, "evidence")
+	}
+
+	if opts.Parked {
+		config.parked = true
+		key = append(key, "parked")
+	}
+
+	if opts.QueryTimeout < 0 {
+		return nil, fmt.Errorf("invalid query timeout: %v", opts.QueryTimeout)
+	}
+
+	if opts.ScanTimeout < 0 {
+		return nil, fmt.Errorf("invalid scan timeout: %v", opts.ScanTimeout)
+	}
+
+	if opts.ScanTimeout > 0 {
+		config.scanTimeout = opts.ScanTimeout
+		key = append(key, "scanTimeout="+opts.ScanTimeout.String())
+	}
+
+	if len(opts.Nameservers) > 0 || opts.QueryTimeout > 0 {
+		nameservers := s.nameservers
+		if len(opts.Nameservers) > 0 {
+			if s.customResolver {
+				return nil, errors.New("nameservers can't be set when using a custom resolver")
+			}
+
+			if s.iterative {
+				return nil, errors.New("nameservers can't be set when using iterative resolution")
+			}
+
+			var err error
+			if nameservers, err = normalizeNameservers(opts.Nameservers, defaultDNSPort(s.dnsProtocol)); err != nil {
+				return nil, err
+			}
+
+			key = append(key, "nameservers="+strings.Join(nameservers, ","))
+		}
+
+		if opts.QueryTimeout > 0 {
+			config.queryTimeout = opts.QueryTimeout
+			key = append(key, "queryTimeout="+opts.QueryTimeout.String())
+		}
+
+		if s.customResolver {
+			config.resolverTimeout = config.queryTimeout
+		} else {
+			resolver, err := s.newResolver(nameservers, config.queryTimeout)
+			if err != nil {
+				return nil, err
+			}
+
+			config.ownsResolver = true
+			config.resolver = resolver
+		}
+	}
+
+	config.cacheKey = strings.Join(key, ";")
+
+	return config, nil
+}
+
+// close closes the resolver created for the scan, if there was one.
+func (c *scanConfig) close() {
+	if !c.ownsResolver {
+		return
+	}
+
+	if closer, ok := c.resolver.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// runs reports whether a check should be run.
+func (c *scanConfig) runs(check string) bool {
+	return c.checks == nil || c.checks[check]
+}
+
+// withScanConfig returns a copy of ctx which carries config.
+func withScanConfig(ctx context.Context, config *scanConfig) context.Context {
+	return context.WithValue(ctx, scanConfigContextKey{}, config)
+}
+
+// scanConfig returns the configuration for the scan carried by ctx, falling
+// back to the scanner's own configuration.
+func (s *Scanner) scanConfig(ctx context.Context) *scanConfig {
+	if config, ok := ctx.Value(scanConfigContextKey{}).(*scanConfig); ok {
+		return config
+	}
+
+	return &scanConfig{
+		authoritative: s.authoritative,
+		dkimSelectors: s.dkimSelectors,
+		evidence:      s.evidence,
+		queryTimeout:  s.dnsClient.Timeout,
+		resolver:      s.resolver,
+		scanTimeout:   s.scanTimeout,
+	}
+}
+
+// exchange sends a query using the resolver for the scan carried by ctx,
+// recording it as evidence if the scan calls for it.
+func (s *Scanner) exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	config := s.scanConfig(ctx)
+
+	if config.resolverTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.resolverTimeout)
+		defer cancel()
+	}
+
+	if !config.evidence {
+		return config.resolver.Exchange(ctx, req)
+	}
+
+	start := time.Now()
+	resp, err := config.resolver.Exchange(ctx, req)
+	trackerFromContext(ctx).observeEvidence(newDNSEvidence(req, resp, err, time.Since(start)))
+
+	return resp, err
+}
@@ -0,0 +1,187 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanWithOptions(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := newMockResolver(t,
+		`example.com. 300 IN TXT "v=spf1 -all"`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject"`,
+		`custom._domainkey.example.com. 300 IN TXT "v=DKIM1; k=rsa; p=MIIB"`,
+	)
+
+	t.Run("DKIMSelectorsAreIsolated", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithCacheDuration(time.Minute))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		var wg sync.WaitGroup
+		var withSelector, withoutSelector []*Result
+		var withErr, withoutErr error
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			withSelector, withErr = scanner.ScanWithOptions(context.Background(), ScanOptions{DKIMSelectors: []string{"custom"}}, "example.com")
+		}()
+		go func() {
+			defer wg.Done()
+			withoutSelector, withoutErr = scanner.ScanWithOptions(context.Background(), ScanOptions{}, "example.com")
+		}()
+		wg.Wait()
+
+		require.NoError(t, withErr)
+		require.NoError(t, withoutErr)
+		require.Len(t, withSelector[0].DKIMRecords, 1)
+		require.Equal(t, "custom", withSelector[0].DKIMRecords[0].Selector)
+		require.Empty(t, withoutSelector[0].DKIMRecords)
+
+		// the cached results are kept apart too
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Empty(t, results[0].DKIMRecords)
+
+		results, err = scanner.ScanWithOptions(context.Background(), ScanOptions{DKIMSelectors: []string{"custom"}}, "example.com")
+		require.NoError(t, err)
+		require.Len(t, results[0].DKIMRecords, 1)
+
+		// and the scanner's own selectors are left untouched
+		require.Empty(t, scanner.dkimSelectors)
+	})
+
+	t.Run("DKIMSelectorsCacheKey", func(t *testing.T) {
+		counter := &countingResolver{Resolver: resolver}
+
+		scanner, err := New(logger, timeout, WithResolver(counter), WithCacheDuration(time.Minute))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.ScanWithOptions(context.Background(), ScanOptions{DKIMSelectors: []string{"custom", "other", "custom"}}, "example.com")
+		require.NoError(t, err)
+
+		// the same selectors in a different order are served from the cache
+		counter.reset()
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{DKIMSelectors: []string{"other", "custom"}}, "example.com")
+		require.NoError(t, err)
+		require.Len(t, results[0].DKIMRecords, 1)
+		require.Zero(t, counter.count(""))
+	})
+
+	t.Run("Parked", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver), WithCacheDuration(time.Minute))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Parked: true}, "example.com")
+		require.NoError(t, err)
+		require.True(t, results[0].Parked)
+
+		// the parked result isn't served to scans without the option
+		results, err = scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.False(t, results[0].Parked)
+	})
+
+	t.Run("Checks", func(t *testing.T) {
+		counter := &countingResolver{Resolver: resolver}
+
+		scanner, err := New(logger, timeout, WithResolver(counter))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{"SPF"}}, "example.com")
+		require.NoError(t, err)
+		require.Equal(t, "v=spf1 -all", results[0].SPF)
+		require.Empty(t, results[0].DMARC)
+		require.Zero(t, counter.count("_dmarc."))
+		require.Zero(t, counter.count("custom._domainkey."))
+	})
+
+	t.Run("InvalidCheck", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{"spf", "ptr"}}, "example.com")
+		require.ErrorContains(t, err, "invalid check: ptr")
+	})
+
+	t.Run("InvalidDKIMSelector", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.ScanWithOptions(context.Background(), ScanOptions{DKIMSelectors: []string{"selector1@"}}, "example.com")
+		require.ErrorContains(t, err, "invalid DKIM selector")
+	})
+
+	t.Run("NameserversWithCustomResolver", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		_, err = scanner.ScanWithOptions(context.Background(), ScanOptions{Nameservers: []string{"8.8.8.8"}}, "example.com")
+		require.ErrorContains(t, err, "custom resolver")
+	})
+
+	t.Run("Nameservers", func(t *testing.T) {
+		var defaultQueries, optionQueries atomic.Int32
+		defaultNameserver := (&fakeDNS{rcode: dns.RcodeRefused, queries: &defaultQueries}).listen(t)
+		optionNameserver := (&fakeDNS{mockResolver: resolver, queries: &optionQueries}).listen(t)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{defaultNameserver}), WithDNSRetries(0))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{CheckSPF}, Nameservers: []string{optionNameserver}}, "example.com")
+		require.NoError(t, err)
+		require.Equal(t, "v=spf1 -all", results[0].SPF)
+		require.NotZero(t, optionQueries.Load())
+		require.Zero(t, defaultQueries.Load())
+	})
+
+	t.Run("QueryTimeout", func(t *testing.T) {
+		var queries atomic.Int32
+		nameserver := (&fakeDNS{drop: true, queries: &queries}).listen(t)
+
+		scanner, err := New(logger, timeout, WithNameservers([]string{nameserver}), WithDNSRetries(0))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		start := time.Now()
+		results, err := scanner.ScanWithOptions(context.Background(), ScanOptions{Checks: []string{CheckSPF}, QueryTimeout: time.Millisecond * 100}, "example.com")
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), time.Second)
+		require.Equal(t, ErrInvalidDomain, results[0].Error)
+	})
+	t.Run("NameserverPools", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithNameservers([]string{"192.0.2.1"}))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		pool := func(opts ScanOptions) *nameserverPool {
+			config, err := scanner.newScanConfig(opts)
+			require.NoError(t, err)
+			defer config.close()
+
+			return config.resolver.(*dnsResolver).nameservers
+		}
+
+		// scans share the health of each nameserver with the scanner, and with each other
+		require.Same(t, scanner.resolver.(*dnsResolver).nameservers, pool(ScanOptions{QueryTimeout: time.Second}))
+		require.Same(t, pool(ScanOptions{Nameservers: []string{"192.0.2.2"}}), pool(ScanOptions{Nameservers: []string{"192.0.2.2"}, QueryTimeout: time.Second}))
+		require.NotSame(t, scanner.resolver.(*dnsResolver).nameservers, pool(ScanOptions{Nameservers: []string{"192.0.2.2"}}))
+	})
+}
@@ -1,12 +1,14 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/GlobalCyberAlliance/domain-security-scanner/v3/pkg/cache"
@@ -23,38 +25,99 @@ const (
 
 type (
 	Scanner struct {
+		// authoritative enables sending the SPF, DMARC, DKIM and MX queries directly to each of a domain's
+		// authoritative nameservers, to check that they agree.
+		authoritative bool
+
+		// authoritativePort is the port authoritative nameservers are queried on.
+		authoritativePort string
+
 		// cache is a simple in-memory cache to reduce external requests from the scanner.
 		cache *cache.Cache[Result]
 
 		// cacheDuration is the time-to-live for cache entries.
 		cacheDuration time.Duration
 
+		// customResolver is set when the caller provided their own resolver via WithResolver.
+		customResolver bool
+
+		// delegations caches the nameservers each zone is delegated to, for iterative resolution.
+		delegations *cache.Cache[delegation]
+
 		// dkimSelectors is used to specify where a DKIM record is hosted for a specific domain.
 		dkimSelectors []string
 
-		// DNS client shared by all goroutines the scanner spawns.
+		// dmarcTreeWalk enables the DMARCbis tree walk when discovering DMARC policies, instead of falling back to the
+		// organizational domain.
+		dmarcTreeWalk bool
+
+		// DNS client used by the default resolver.
 		dnsClient *dns.Client
 
 		// dnsBuffer is used to configure the size of the buffer allocated for DNS responses.
 		dnsBuffer uint16
 
-		// The index of the last-used nameserver, from the nameservers slice.
-		//
-		// This field is managed by atomic operations, and should only ever be referenced by the (*Scanner).getNS()
-		// method.
-		lastNameserverIndex uint32
+		// dnsHTTPMethod is the HTTP method used for DNS-over-HTTPS queries (GET or POST).
+		dnsHTTPMethod string
+
+		// dnsProtocol is the protocol used by the default resolver (udp, tcp, tcp-tls, https or quic).
+		dnsProtocol string
+
+		// dnsRetries is the number of times the default resolver retries a failed query against the next nameserver.
+		dnsRetries uint16
+
+		// dnsRetryBackoff is the delay before the default resolver's first retry, which doubles for each subsequent
+		// retry.
+		dnsRetryBackoff time.Duration
+
+		// dnssecValidator validates DNSSEC signatures itself when set, instead of trusting the AD bit set by the
+		// nameservers.
+		dnssecValidator *dnssecValidator
+
+		// evidence records every DNS query made while scanning a domain in its result.
+		evidence bool
+
+		// httpClient is used to fetch policies published over HTTPS, such as MTA-STS policies.
+		httpClient *http.Client
+
+		// iterative enables resolving queries iteratively from the root servers, instead of sending them to
+		// nameservers.
+		iterative bool
 
 		// logger is the logger for the scanner.
 		logger zerolog.Logger
 
-		// nameservers is a slice of "host:port" strings of nameservers to issue queries against.
+		// mtastsPolicies caches the MTA-STS policy fetched for each domain, keyed by the domain.
+		mtastsPolicies *cache.Cache[cachedMTASTSPolicy]
+
+		// nameservers is a slice of "host:port" strings (or URLs for DNS-over-HTTPS) of nameservers to issue queries
+		// against. The port may be missing, in which case the DNS protocol's default port is used.
 		nameservers []string
 
+		// nameserverPools caches a pool for each set of nameservers queried by the built-in resolvers, keyed by the
+		// nameservers, so that scans with their own nameservers or query timeout share retry and ejection state.
+		nameserverPools      *cache.Cache[nameserverPool]
+		nameserverPoolsMutex sync.Mutex
+
 		// pool is the pool of workers for the scanner.
 		pool *ants.Pool
 
 		// poolSize is the size of the pool of workers for the scanner.
 		poolSize uint16
+
+		// publicSuffixList is used to find the organizational domain of a domain, such as when looking up its DMARC
+		// record.
+		publicSuffixList *publicSuffixList
+
+		// resolver is used to send every DNS query the scanner makes.
+		resolver Resolver
+
+		// rootHints holds the "host:port" addresses of the root servers iterative resolution starts from, and defaults
+		// to the built-in root hints.
+		rootHints []string
+
+		// scanTimeout is the overall deadline for scanning a single domain, independent of the per-query timeout.
+		scanTimeout time.Duration
 	}
 
 	// Option defines a functional configuration type for a *Scanner.
@@ -62,14 +125,32 @@ type (
 
 	// Result holds the results of scanning a domain's DNS records.
 	Result struct {
-		Domain string   `json:"domain" yaml:"domain,omitempty" doc:"The domain name being scanned." example:"example.com"`
-		Error  string   `json:"error,omitempty" yaml:"error,omitempty" doc:"An error message if the scan failed." example:"invalid domain name"`
-		BIMI   string   `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The BIMI record for the domain." example:"https://example.com/bimi.svg"`
-		DKIM   string   `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"The DKIM record for the domain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
-		DMARC  string   `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DMARC record for the domain." example:"v=DMARC1; p=none"`
-		MX     []string `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The MX records for the domain." example:"aspmx.l.google.com"`
-		NS     []string `json:"ns,omitempty" yaml:"ns,omitempty" doc:"The NS records for the domain." example:"ns1.example.com"`
-		SPF    string   `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record for the domain." example:"v=spf1 include:_spf.google.com ~all"`
+		Domain             string                      `json:"domain" yaml:"domain,omitempty" doc:"The domain name being scanned." example:"example.com"`
+		Error              string                      `json:"error,omitempty" yaml:"error,omitempty" doc:"An error message if the scan failed." example:"invalid domain name"`
+		Errors             []*CheckError               `json:"errors,omitempty" yaml:"errors,omitempty" doc:"The errors encountered by each check, including the details of any DNS queries that failed."`
+		BIMI               string                      `json:"bimi,omitempty" yaml:"bimi,omitempty" doc:"The BIMI record for the domain." example:"https://example.com/bimi.svg"`
+		DKIM               string                      `json:"dkim,omitempty" yaml:"dkim,omitempty" doc:"Deprecated: use dkimRecords, which has the record found for every selector. The first DKIM record found for the domain." example:"v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`
+		DKIMRecords        []*DKIMRecord               `json:"dkimRecords,omitempty" yaml:"dkimRecords,omitempty" doc:"The DKIM records found for the domain, one per selector."`
+		DKIMWildcard       string                      `json:"dkimWildcard,omitempty" yaml:"dkimWildcard,omitempty" doc:"The DKIM record published at *._domainkey, which domains that don't send mail use to revoke every selector." example:"v=DKIM1; p="`
+		DMARC              string                      `json:"dmarc,omitempty" yaml:"dmarc,omitempty" doc:"The DMARC record for the domain." example:"v=DMARC1; p=none"`
+		DMARCInheritedFrom string                      `json:"dmarcInheritedFrom,omitempty" yaml:"dmarcInheritedFrom,omitempty" doc:"The domain the DMARC record was inherited from (its organizational domain, or the domain found by the DMARCbis tree walk), if the domain doesn't publish its own." example:"example.co.uk"`
+		DMARCOrgDomain     string                      `json:"dmarcOrgDomain,omitempty" yaml:"dmarcOrgDomain,omitempty" doc:"The domain's organizational domain, from the public suffix list or the psd= tags found by the DMARCbis tree walk." example:"example.co.uk"`
+		DMARCPolicyTag     string                      `json:"dmarcPolicyTag,omitempty" yaml:"dmarcPolicyTag,omitempty" doc:"Which of the DMARC record's policy tags applies to the domain (p, sp or np)." example:"sp"`
+		DMARCReportAuth    []*DMARCReportAuthorization `json:"dmarcReportAuth,omitempty" yaml:"dmarcReportAuth,omitempty" doc:"Whether each external DMARC report destination has authorized the domain to send it reports."`
+		MTASTS             *MTASTSResult               `json:"mtaSts,omitempty" yaml:"mtaSts,omitempty" doc:"The MTA-STS record and policy for the domain."`
+		MX                 []string                    `json:"mx,omitempty" yaml:"mx,omitempty" doc:"The hostnames in the MX records for the domain, sorted by preference." example:"aspmx.l.google.com"`
+		NullMX             bool                        `json:"nullMx,omitempty" yaml:"nullMx,omitempty" doc:"Whether the domain publishes a null MX record (RFC 7505), meaning it doesn't accept mail."`
+		Parked             bool                        `json:"parked,omitempty" yaml:"parked,omitempty" doc:"Whether the domain was scanned as one which doesn't send or receive mail, so it's checked against the parked domain profile."`
+		MXHosts            []*MXHost                   `json:"mxHosts,omitempty" yaml:"mxHosts,omitempty" doc:"The mail servers listed in the MX records for the domain, sorted by preference, along with the addresses they resolve to."`
+		NS                 []string                    `json:"ns,omitempty" yaml:"ns,omitempty" doc:"The NS records for the domain." example:"ns1.example.com"`
+		SPF                string                      `json:"spf,omitempty" yaml:"spf,omitempty" doc:"The SPF record for the domain." example:"v=spf1 include:_spf.google.com ~all"`
+		SPFTree            *SPFTree                    `json:"spfTree,omitempty" yaml:"spfTree,omitempty" doc:"The SPF record for the domain, with every include and redirect expanded."`
+		TLSRPT             string                      `json:"tlsrpt,omitempty" yaml:"tlsrpt,omitempty" doc:"The SMTP TLS Reporting (TLS-RPT) record for the domain." example:"v=TLSRPTv1; rua=mailto:tlsrpt@example.com"`
+		TLSA               []*TLSAResult               `json:"tlsa,omitempty" yaml:"tlsa,omitempty" doc:"The DANE TLSA records published for the domain's mail servers."`
+		Authoritative      *AuthoritativeResult        `json:"authoritative,omitempty" yaml:"authoritative,omitempty" doc:"Whether the domain's authoritative nameservers agree with each other, if the authoritative check was requested."`
+		DNSSEC             *DNSSECResult               `json:"dnssec,omitempty" yaml:"dnssec,omitempty" doc:"The DNSSEC validation status of the domain's records."`
+		LargeResponses     []*LargeResponse            `json:"largeResponses,omitempty" yaml:"largeResponses,omitempty" doc:"The DNS responses which were too large to be sent reliably over UDP, and whether they had to be retried over TCP."`
+		Evidence           []*DNSEvidence              `json:"evidence,omitempty" yaml:"evidence,omitempty" doc:"Every DNS query made while scanning the domain and exactly what was returned, if evidence was requested."`
 	}
 )
 
@@ -83,11 +164,17 @@ func New(logger zerolog.Logger, timeout time.Duration, opts ...Option) (*Scanner
 	dnsClient.Timeout = timeout
 
 	scanner := &Scanner{
-		dnsClient:   dnsClient,
-		dnsBuffer:   4096,
-		logger:      logger,
-		nameservers: []string{"8.8.8.8:53", "8.8.4.4:53", "1.1.1.1:53"}, // Set the default nameservers to Google and Cloudflare
-		poolSize:    uint16(runtime.NumCPU()),
+		authoritativePort: "53",
+		dnsClient:         dnsClient,
+		dnsBuffer:         4096,
+		dnsHTTPMethod:     http.MethodPost,
+		dnsProtocol:       "udp",
+		dnsRetries:        2,
+		dnsRetryBackoff:   100 * time.Millisecond,
+		httpClient:        &http.Client{Timeout: timeout},
+		logger:            logger,
+		nameservers:       []string{"8.8.8.8:53", "8.8.4.4:53", "1.1.1.1:53"}, // Set the default nameservers to Google and Cloudflare
+		poolSize:          uint16(runtime.NumCPU()),
 	}
 
 	for _, opt := range opts {
@@ -96,8 +183,30 @@ func New(logger zerolog.Logger, timeout time.Duration, opts ...Option) (*Scanner
 		}
 	}
 
+	// Fall back to the embedded Public Suffix List if a newer one wasn't provided
+	if scanner.publicSuffixList == nil {
+		list, err := defaultPublicSuffixList()
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedded public suffix list: %w", err)
+		}
+
+		scanner.publicSuffixList = list
+	}
+
+	// Fall back to the default resolver if a custom one wasn't provided
+	scanner.nameserverPools = cache.New[nameserverPool](nameserverPoolCacheDuration)
+	if !scanner.customResolver {
+		resolver, err := scanner.newDefaultResolver()
+		if err != nil {
+			return nil, errors.Wrap(err, "create resolver")
+		}
+
+		scanner.resolver = resolver
+	}
+
 	// Initialize cache
 	scanner.cache = cache.New[Result](scanner.cacheDuration)
+	scanner.mtastsPolicies = cache.New[cachedMTASTSPolicy](mtastsPolicyCacheDuration)
 
 	// Create a new pool of workers for the scanner
 	pool, err := ants.NewPool(int(scanner.poolSize), ants.WithExpiryDuration(timeout), ants.WithPanicHandler(func(err interface{}) {
@@ -114,6 +223,19 @@ func New(logger zerolog.Logger, timeout time.Duration, opts ...Option) (*Scanner
 
 // Scan scans a list of domains and returns the results.
 func (s *Scanner) Scan(domains ...string) ([]*Result, error) {
+	return s.ScanContext(context.Background(), domains...)
+}
+
+// ScanContext scans a list of domains and returns the results. Cancelling ctx
+// stops any queued domains from being scanned and aborts in-flight DNS queries.
+func (s *Scanner) ScanContext(ctx context.Context, domains ...string) ([]*Result, error) {
+	return s.ScanWithOptions(ctx, ScanOptions{}, domains...)
+}
+
+// ScanWithOptions is the same as ScanContext, but overrides the scanner's
+// configuration with opts for this call only. Concurrent scans with different
+// options don't affect each other, and their results are cached separately.
+func (s *Scanner) ScanWithOptions(ctx context.Context, opts ScanOptions, domains ...string) ([]*Result, error) {
 	if s.pool == nil {
 		return nil, errors.New("scanner is closed")
 	}
@@ -128,162 +250,431 @@ func (s *Scanner) Scan(domains ...string) ([]*Result, error) {
 		return nil, errors.New("no domains to scan")
 	}
 
-	var mutex sync.Mutex
-	var results []*Result
-	var wg sync.WaitGroup
+	config, err := s.newScanConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer config.close()
 
-	for _, domainToScan := range domains {
-		wg.Add(1)
+	input := make(chan string, len(domains))
+	for _, domain := range domains {
+		input <- domain
+	}
+	close(input)
 
-		if err := s.pool.Submit(func() {
-			defer func() {
-				wg.Done()
-			}()
+	stream, err := s.ScanStream(withScanConfig(ctx, config), input)
+	if err != nil {
+		return nil, err
+	}
 
-			var err error
-			result := &Result{
-				Domain: domainToScan,
-			}
+	return collectResults(ctx, stream)
+}
+
+// ScanStream scans each domain received on domains, and sends its result on
+// the returned channel as soon as that domain completes, so results may arrive
+// in a different order to the domains. The returned channel is closed once
+// domains is closed and every queued domain has been scanned, or once ctx is
+// cancelled. Callers must either drain the channel or cancel ctx.
+func (s *Scanner) ScanStream(ctx context.Context, domains <-chan string) (<-chan *Result, error) {
+	if s.pool == nil {
+		return nil, errors.New("scanner is closed")
+	}
+
+	results := make(chan *Result, s.poolSize)
+
+	go func() {
+		var wg sync.WaitGroup
+
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
 
-			if s.cache != nil {
-				scanResult := s.cache.Get(domainToScan)
-				if scanResult != nil {
-					s.logger.Debug().Msg("cache hit for " + domainToScan)
-					mutex.Lock()
-					results = append(results, scanResult)
-					mutex.Unlock()
+		for {
+			var domainToScan string
+			var ok bool
+
+			select {
+			case <-ctx.Done():
+				return
+			case domainToScan, ok = <-domains:
+				if !ok {
 					return
 				}
+			}
 
-				s.logger.Debug().Msg("cache miss for " + domainToScan)
+			domainToScan = strings.TrimSpace(domainToScan)
+			if domainToScan == "" {
+				continue
+			}
 
+			wg.Add(1)
+
+			if err := s.pool.Submit(func() {
 				defer func() {
-					s.cache.Set(domainToScan, result)
+					wg.Done()
 				}()
-			}
-
-			// check that the domain name is valid
-			result.NS, err = s.getDNSRecords(domainToScan, dns.TypeNS)
-			if err != nil || len(result.NS) == 0 {
-				// check if TXT records exist, as the nameserver check won't work for subdomains
-				records, err := s.getDNSAnswers(domainToScan, dns.TypeTXT)
-				if err != nil || len(records) == 0 {
-					// fill variable to satisfy deferred cache fill
-					result = &Result{
-						Domain: domainToScan,
-						Error:  ErrInvalidDomain,
-					}
-
-					mutex.Lock()
-					results = append(results, result)
-					mutex.Unlock()
 
+				// the caller may have given up while this domain was queued
+				if ctx.Err() != nil {
 					return
 				}
-			}
 
-			var errs []string
-			scanWg := sync.WaitGroup{}
-			scanWg.Add(5)
+				result := s.scanDomain(ctx, domainToScan)
 
-			// Get BIMI record
-			go func() {
-				defer scanWg.Done()
-				result.BIMI, err = s.getTypeBIMI(domainToScan)
-				if err != nil {
-					errs = append(errs, "bimi:"+err.Error())
-				}
-			}()
-
-			// Get DKIM record
-			go func() {
-				defer scanWg.Done()
-				result.DKIM, err = s.getTypeDKIM(domainToScan)
-				if err != nil {
-					errs = append(errs, "dkim:"+err.Error())
-				}
-			}()
-
-			// Get DMARC record
-			go func() {
-				defer scanWg.Done()
-				result.DMARC, err = s.getTypeDMARC(domainToScan)
-				if err != nil {
-					errs = append(errs, "dmarc:"+err.Error())
+				select {
+				case results <- result:
+				case <-ctx.Done():
 				}
-			}()
-
-			// Get MX records
-			go func() {
-				defer scanWg.Done()
-				result.MX, err = s.getDNSRecords(domainToScan, dns.TypeMX)
-				if err != nil {
-					errs = append(errs, "mx:"+err.Error())
-				}
-			}()
-
-			// Get SPF record
-			go func() {
-				defer scanWg.Done()
-				result.SPF, err = s.getTypeSPF(domainToScan)
-				if err != nil {
-					errs = append(errs, "spf:"+err.Error())
-				}
-			}()
+			}); err != nil {
+				wg.Done()
+				s.logger.Error().Err(err).Msg("failed to queue " + domainToScan + " for scanning")
+				return
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+// ScanZone scans every domain found within an RFC 1035 zone file.
+func (s *Scanner) ScanZone(zone io.Reader) ([]*Result, error) {
+	return s.ScanZoneContext(context.Background(), zone)
+}
+
+// ScanZoneContext is the same as ScanZone, but allows the caller to cancel the scan via ctx.
+func (s *Scanner) ScanZoneContext(ctx context.Context, zone io.Reader) ([]*Result, error) {
+	stream, err := s.ScanZoneStream(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := collectResults(ctx, stream)
+	if err != nil {
+		return results, err
+	}
+
+	if len(results) == 0 {
+		return nil, errors.New("no domains to scan")
+	}
+
+	return results, nil
+}
+
+// ScanZoneStream scans every domain found within an RFC 1035 zone file, sending
+// each result on the returned channel as soon as it's available. Domains are
+// queued as the zone is parsed, so scanning starts before the whole file has
+// been read.
+func (s *Scanner) ScanZoneStream(ctx context.Context, zone io.Reader) (<-chan *Result, error) {
+	domains := make(chan string)
+
+	results, err := s.ScanStream(ctx, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer close(domains)
 
-			scanWg.Wait()
+		zoneParser := dns.NewZoneParser(zone, "", "")
+		zoneParser.SetIncludeAllowed(true)
 
-			if len(errs) > 0 {
-				result.Error = strings.Join(errs, "; ")
+		for tok, ok := zoneParser.Next(); ok; tok, ok = zoneParser.Next() {
+			if tok.Header().Rrtype == dns.TypeNS {
+				continue
 			}
 
-			mutex.Lock()
-			results = append(results, result)
-			mutex.Unlock()
-		}); err != nil {
-			return nil, err
+			domain := strings.Trim(tok.Header().Name, ".")
+			if !strings.Contains(domain, ".") {
+				// we have an NS record that serves as an anchor, and should skip it
+				continue
+			}
+
+			select {
+			case domains <- domain:
+			case <-ctx.Done():
+				return
+			}
 		}
-	}
 
-	wg.Wait()
+		if err := zoneParser.Err(); err != nil {
+			s.logger.Warn().Err(err).Msg("failed to parse zone file")
+		}
+	}()
 
 	return results, nil
 }
 
-func (s *Scanner) ScanZone(zone io.Reader) ([]*Result, error) {
-	if s.pool == nil {
-		return nil, errors.New("scanner is closed")
+// scanDomain scans a single domain's DNS records. The per-domain scan timeout (if any) is applied on top of ctx.
+func (s *Scanner) scanDomain(ctx context.Context, domainToScan string) *Result {
+	config := s.scanConfig(ctx)
+
+	if config.scanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.scanTimeout)
+		defer cancel()
+	}
+
+	var err error
+	result := &Result{
+		Domain: domainToScan,
+		Parked: config.parked,
+	}
+
+	// collects details from every query made for the domain, such as responses which had to be retried over TCP
+	ctx, scanTracker := withQueryTracker(ctx)
+
+	if s.cache != nil {
+		// results scanned with different options are cached separately
+		cacheKey := domainToScan
+		if config.cacheKey != "" {
+			cacheKey += "|" + config.cacheKey
+		}
+
+		scanResult := s.cache.Get(cacheKey)
+		if scanResult != nil {
+			s.logger.Debug().Msg("cache hit for " + domainToScan)
+			return scanResult
+		}
+
+		s.logger.Debug().Msg("cache miss for " + domainToScan)
+
+		defer func() {
+			// don't cache partial results from a cancelled or timed out scan
+			if ctx.Err() == nil {
+				s.cache.Set(cacheKey, result)
+			}
+		}()
+	}
+
+	// check that the domain name is valid
+	result.NS, err = s.getDNSRecords(ctx, domainToScan, dns.TypeNS)
+	if err != nil || len(result.NS) == 0 {
+		// check if TXT records exist, as the nameserver check won't work for subdomains
+		records, err := s.getDNSAnswers(ctx, domainToScan, dns.TypeTXT)
+		if err != nil || len(records) == 0 {
+			// fill variable to satisfy deferred cache fill
+			result = &Result{
+				Domain:   domainToScan,
+				Error:    ErrInvalidDomain,
+				Evidence: scanTracker.evidenceList(),
+				Parked:   config.parked,
+			}
+
+			return result
+		}
+	}
+
+	// each check runs concurrently, so their errors are collected under a lock
+	var errsMutex sync.Mutex
+	addErrors := func(check string, err error) {
+		checkErrs := newCheckErrors(check, err)
+		if len(checkErrs) == 0 {
+			return
+		}
+
+		errsMutex.Lock()
+		defer errsMutex.Unlock()
+
+		result.Errors = append(result.Errors, checkErrs...)
 	}
 
-	zoneParser := dns.NewZoneParser(zone, "", "")
-	zoneParser.SetIncludeAllowed(true)
+	// each check records the DNSSEC status of its own records, but they're only reported if the DNSSEC check runs
+	dnssec := &DNSSECResult{}
+	scanWg := sync.WaitGroup{}
+
+	// runCheck runs a check concurrently, unless the scan's options skip it
+	runCheck := func(check string, fn func()) {
+		if !config.runs(check) {
+			return
+		}
+
+		scanWg.Add(1)
 
-	var domains []string
+		go func() {
+			defer scanWg.Done()
+			fn()
+		}()
+	}
 
-	for tok, ok := zoneParser.Next(); ok; tok, ok = zoneParser.Next() {
-		if tok.Header().Rrtype == dns.TypeNS {
-			continue
+	// Get BIMI record
+	runCheck(CheckBIMI, func() {
+		var err error
+		ctx, tracker := withQueryTracker(ctx)
+		result.BIMI, err = s.getTypeBIMI(ctx, domainToScan)
+		addErrors(CheckBIMI, err)
+		dnssec.BIMI = tracker.dnssecStatus()
+	})
+
+	// Get DKIM record
+	runCheck(CheckDKIM, func() {
+		var err error
+		ctx, tracker := withQueryTracker(ctx)
+		result.DKIMRecords, err = s.getTypeDKIM(ctx, domainToScan)
+		addErrors(CheckDKIM, err)
+
+		if len(result.DKIMRecords) > 0 {
+			result.DKIM = result.DKIMRecords[0].Record
 		}
 
-		domain := strings.Trim(tok.Header().Name, ".")
-		if !strings.Contains(domain, ".") {
-			// we have an NS record that serves as an anchor, and should skip it
-			continue
+		// domains which don't send mail revoke every selector with a wildcard record
+		result.DKIMWildcard, _, err = s.getDKIMRecord(ctx, "*._domainkey."+domainToScan)
+		addErrors(CheckDKIM, err)
+		dnssec.DKIM = tracker.dnssecStatus()
+	})
+
+	// Get DMARC record
+	runCheck(CheckDMARC, func() {
+		var err error
+		ctx, tracker := withQueryTracker(ctx)
+		result.DMARC, result.DMARCInheritedFrom, result.DMARCOrgDomain, err = s.getTypeDMARC(ctx, domainToScan)
+		addErrors(CheckDMARC, err)
+
+		result.DMARCPolicyTag, err = s.getDMARCPolicyTag(ctx, domainToScan, result.DMARC, result.DMARCInheritedFrom)
+		addErrors(CheckDMARC, err)
+
+		// external report destinations must authorize the domain which published the record
+		policyDomain := domainToScan
+		if result.DMARCInheritedFrom != "" {
+			policyDomain = result.DMARCInheritedFrom
 		}
 
-		domains = append(domains, domain)
+		result.DMARCReportAuth, err = s.getDMARCReportAuthorizations(ctx, policyDomain, result.DMARC)
+		addErrors(CheckDMARC, err)
+		dnssec.DMARC = tracker.dnssecStatus()
+	})
+
+	// Get MTA-STS record and policy
+	runCheck(CheckMTASTS, func() {
+		var err error
+		result.MTASTS, err = s.getTypeMTASTS(ctx, domainToScan)
+		addErrors(CheckMTASTS, err)
+	})
+
+	// Get MX records
+	runCheck(CheckMX, func() {
+		var err error
+		ctx, tracker := withQueryTracker(ctx)
+		result.MXHosts, err = s.getTypeMX(ctx, domainToScan)
+		addErrors(CheckMX, err)
+		dnssec.MX = tracker.dnssecStatus()
+
+		for _, host := range result.MXHosts {
+			result.MX = append(result.MX, host.Host)
+		}
+
+		// a null MX record means the domain doesn't accept mail, so there are no mail servers to check (RFC 7505)
+		result.NullMX = len(result.MX) == 1 && result.MX[0] == "."
+		if result.NullMX {
+			return
+		}
+
+		addErrors(CheckMX, s.resolveMXHosts(ctx, result.MXHosts))
+
+		result.TLSA, err = s.getTypeTLSA(ctx, result.MX)
+		addErrors(CheckTLSA, err)
+	})
+
+	// Get SPF record
+	runCheck(CheckSPF, func() {
+		var err error
+		ctx, tracker := withQueryTracker(ctx)
+		result.SPF, result.SPFTree, err = s.getTypeSPF(ctx, domainToScan)
+		addErrors(CheckSPF, err)
+		dnssec.SPF = tracker.dnssecStatus()
+	})
+
+	// Get TLS-RPT record
+	runCheck(CheckTLSRPT, func() {
+		var err error
+		ctx, tracker := withQueryTracker(ctx)
+		result.TLSRPT, err = s.getTypeTLSRPT(ctx, domainToScan)
+		addErrors(CheckTLSRPT, err)
+		dnssec.TLSRPT = tracker.dnssecStatus()
+	})
+
+	// Check whether the zone is signed
+	runCheck(CheckDNSSEC, func() {
+		var err error
+		dnssec.Signed, err = s.isZoneSigned(ctx, domainToScan)
+		addErrors(CheckDNSSEC, err)
+	})
+
+	scanWg.Wait()
+
+	if config.runs(CheckDNSSEC) {
+		result.DNSSEC = dnssec
+	}
+
+	// the authoritative check queries the DKIM selectors found by the other checks, so it has to run afterwards
+	if config.authoritative {
+		result.Authoritative, err = s.checkAuthoritative(ctx, domainToScan, result)
+		addErrors(CheckAuthoritative, err)
 	}
 
-	return s.Scan(domains...)
+	result.LargeResponses = scanTracker.largeResponseList()
+	result.Evidence = scanTracker.evidenceList()
+
+	// every MX must match the MTA-STS policy, or senders enforcing it will refuse to deliver
+	if result.MTASTS != nil && result.MTASTS.Policy != nil && result.MTASTS.Policy.Mode != "none" {
+		for _, mx := range result.MX {
+			if !result.MTASTS.Policy.Matches(mx) {
+				result.MTASTS.UnmatchedMX = append(result.MTASTS.UnmatchedMX, mx)
+			}
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		// the checks finish in any order, so sort their errors to keep results stable
+		slices.SortStableFunc(result.Errors, func(a, b *CheckError) int {
+			return strings.Compare(a.Check, b.Check)
+		})
+
+		errs := make([]string, len(result.Errors))
+		for index, checkErr := range result.Errors {
+			errs[index] = checkErr.String()
+		}
+
+		result.Error = strings.Join(errs, "; ")
+	}
+
+	return result
 }
 
 // Close closes the scanner
 func (s *Scanner) Close() {
 	s.pool.Release()
-	s.cache.Flush()
+
+	// close any connections held open by the default resolver
+	if closer, ok := s.resolver.(io.Closer); ok && !s.customResolver {
+		_ = closer.Close()
+	}
+
+	// stop each cache's cleanup goroutine
+	s.cache.Close()
+
+	if s.delegations != nil {
+		s.delegations.Close()
+	}
+
+	s.closeDNSSECValidator()
+	s.mtastsPolicies.Close()
+	s.nameserverPools.Close()
+
 	s.logger.Debug().Msg("scanner closed")
 }
 
-func (s *Scanner) getNS() string {
-	return s.nameservers[int(atomic.AddUint32(&s.lastNameserverIndex, 1))%len(s.nameservers)]
+// collectResults drains a stream of results into a slice, returning the context's error if the scan was cut short.
+func collectResults(ctx context.Context, stream <-chan *Result) ([]*Result, error) {
+	var results []*Result
+
+	for result := range stream {
+		results = append(results, result)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+
+	return results, nil
 }
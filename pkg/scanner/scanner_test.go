@@ -0,0 +1,543 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// mockResolver answers queries from a fixed set of records, returning NXDOMAIN
+// for any name it doesn't know about.
+type mockResolver struct {
+	records map[string][]dns.RR
+}
+
+func newMockResolver(t *testing.T, records ...string) *mockResolver {
+	t.Helper()
+
+	resolver := &mockResolver{records: make(map[string][]dns.RR)}
+
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+
+		resolver.records[rr.Header().Name] = append(resolver.records[rr.Header().Name], rr)
+	}
+
+	return resolver
+}
+
+func (m *mockResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+
+	question := req.Question[0]
+
+	records, ok := m.records[question.Name]
+	if !ok {
+		resp.Rcode = dns.RcodeNameError
+	}
+
+	for _, record := range records {
+		if record.Header().Rrtype == question.Qtype || record.Header().Rrtype == dns.TypeCNAME {
+			resp.Answer = append(resp.Answer, dns.Copy(record))
+		}
+
+		// include signatures over the answer when DNSSEC records are requested
+		if sig, ok := record.(*dns.RRSIG); ok && sig.TypeCovered == question.Qtype && req.IsEdns0() != nil && req.IsEdns0().Do() {
+			resp.Answer = append(resp.Answer, dns.Copy(record))
+		}
+	}
+
+	// include the (signed) NSEC or NSEC3 records proving there's no answer when DNSSEC records are requested
+	if len(resp.Answer) == 0 && req.IsEdns0() != nil && req.IsEdns0().Do() {
+		for _, record := range records {
+			switch rr := record.(type) {
+			case *dns.NSEC, *dns.NSEC3:
+				resp.Ns = append(resp.Ns, dns.Copy(record))
+			case *dns.RRSIG:
+				if rr.TypeCovered == dns.TypeNSEC || rr.TypeCovered == dns.TypeNSEC3 {
+					resp.Ns = append(resp.Ns, dns.Copy(record))
+				}
+			}
+		}
+	}
+
+	return &Response{Msg: resp, Nameserver: "mock"}, nil
+}
+
+// countingResolver wraps a resolver, recording the name of every query sent
+// to it.
+type countingResolver struct {
+	Resolver
+
+	mutex sync.Mutex
+	names []string
+}
+
+func (c *countingResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	c.mutex.Lock()
+	c.names = append(c.names, req.Question[0].Name)
+	c.mutex.Unlock()
+
+	return c.Resolver.Exchange(ctx, req)
+}
+
+// count returns the number of queries sent for names starting with prefix.
+func (c *countingResolver) count(prefix string) (count int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, name := range c.names {
+		if strings.HasPrefix(name, prefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (c *countingResolver) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.names = nil
+}
+
+// failingResolver wraps a resolver, answering queries for some names with an
+// error rcode instead.
+type failingResolver struct {
+	Resolver
+
+	rcodes map[string]int
+}
+
+func (f *failingResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	if rcode, ok := f.rcodes[req.Question[0].Name]; ok {
+		resp := new(dns.Msg)
+		resp.SetRcode(req, rcode)
+
+		return &Response{Msg: resp, Nameserver: "mock"}, nil
+	}
+
+	return f.Resolver.Exchange(ctx, req)
+}
+
+// slowResolver wraps a resolver, delaying every query and recording the most
+// queries which were in flight at once.
+type slowResolver struct {
+	Resolver
+
+	delay time.Duration
+
+	mutex    sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (s *slowResolver) Exchange(ctx context.Context, req *dns.Msg) (*Response, error) {
+	s.mutex.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.inFlight--
+		s.mutex.Unlock()
+	}()
+
+	time.Sleep(s.delay)
+
+	return s.Resolver.Exchange(ctx, req)
+}
+
+func TestScanContext(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("CancelledContext", func(t *testing.T) {
+		scanner, err := New(logger, timeout)
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := scanner.ScanContext(ctx, "example.com")
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, results)
+	})
+}
+
+func TestScanStream(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	t.Run("ClosedInput", func(t *testing.T) {
+		scanner, err := New(logger, timeout)
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		domains := make(chan string)
+		close(domains)
+
+		results, err := scanner.ScanStream(context.Background(), domains)
+		require.NoError(t, err)
+
+		for range results {
+			t.Fatal("expected no results")
+		}
+	})
+
+	t.Run("SkipsEmptyDomains", func(t *testing.T) {
+		scanner, err := New(logger, timeout)
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		domains := make(chan string, 2)
+		domains <- ""
+		domains <- "  "
+		close(domains)
+
+		results, err := scanner.ScanStream(context.Background(), domains)
+		require.NoError(t, err)
+
+		for range results {
+			t.Fatal("expected no results")
+		}
+	})
+}
+
+func TestScanWithResolver(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := newMockResolver(t,
+		`example.com. 300 IN NS ns1.example.com.`,
+		`example.com. 300 IN MX 10 mail.example.com.`,
+		`_25._tcp.mail.example.com. 300 IN TLSA 3 1 1 0B8D8D2BA0EF1EA2E2B94A6F0D1F6E0C0DBF6A3C5C8D2E6F1A9B7C3D4E5F6A7B`,
+		`example.com. 300 IN TXT "v=spf1 include:_spf.example.com -all"`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject;"`,
+		`_smtp._tls.example.com. 300 IN TXT "v=TLSRPTv1; rua=mailto:tlsrpt@example.com"`,
+		`google._domainkey.example.com. 300 IN TXT "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`,
+		`selector1._domainkey.example.com. 300 IN CNAME selector1._domainkey.example.net.`,
+		`selector1._domainkey.example.net. 300 IN TXT "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC"`,
+	)
+
+	scanner, err := New(logger, timeout, WithResolver(resolver))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.Empty(t, result.Error)
+	require.Equal(t, []string{"ns1.example.com."}, result.NS)
+	require.Equal(t, []string{"mail.example.com."}, result.MX)
+	require.Equal(t, []*TLSAResult{{
+		Host:    "mail.example.com.",
+		Records: []TLSARecord{{Usage: 3, Selector: 1, MatchingType: 1, Certificate: "0b8d8d2ba0ef1ea2e2b94a6f0d1f6e0c0dbf6a3c5c8d2e6f1a9b7c3d4e5f6a7b"}},
+		DNSSEC:  DNSSECInsecure,
+	}}, result.TLSA)
+	require.Equal(t, "v=spf1 include:_spf.example.com -all", result.SPF)
+	require.Equal(t, "v=DMARC1; p=reject;", result.DMARC)
+	require.Equal(t, []*DKIMRecord{
+		{Selector: "google", Record: "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"},
+		{Selector: "selector1", Record: "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC", CNAMETarget: "selector1._domainkey.example.net."},
+	}, result.DKIMRecords)
+	require.Equal(t, "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA", result.DKIM)
+	require.Equal(t, "v=TLSRPTv1; rua=mailto:tlsrpt@example.com", result.TLSRPT)
+	require.Empty(t, result.BIMI)
+}
+
+func TestGetTypeDKIMLimit(t *testing.T) {
+	resolver := &slowResolver{Resolver: newMockResolver(t, `google._domainkey.example.com. 300 IN TXT "v=DKIM1; p="`), delay: time.Millisecond * 10}
+
+	scanner, err := New(zerolog.Nop(), time.Second*5, WithResolver(resolver))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	require.Greater(t, len(knownDkimSelectors), maxDKIMLookups)
+
+	records, err := scanner.getTypeDKIM(context.Background(), "example.com.")
+	require.NoError(t, err)
+	require.Equal(t, []*DKIMRecord{{Selector: "google", Record: "v=DKIM1; p="}}, records)
+	require.LessOrEqual(t, resolver.peak, maxDKIMLookups)
+}
+
+func TestScanDMARCOrganizationalDomain(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := newMockResolver(t,
+		`mail.example.co.uk. 300 IN NS ns1.example.co.uk.`,
+		`mail.example.com. 300 IN NS ns1.example.com.`,
+		`own.example.com. 300 IN NS ns1.example.com.`,
+		`example.org. 300 IN NS ns1.example.org.`,
+		`_dmarc.example.co.uk. 300 IN TXT "v=DMARC1; p=reject; sp=quarantine;"`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject;"`,
+		`_dmarc.own.example.com. 300 IN TXT "v=DMARC1; p=none;"`,
+	)
+
+	scanner, err := New(logger, timeout, WithResolver(resolver))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	testCases := []struct {
+		domain        string
+		dmarc         string
+		inheritedFrom string
+		orgDomain     string
+		policyTag     string
+	}{
+		{domain: "mail.example.co.uk", dmarc: "v=DMARC1; p=reject; sp=quarantine;", inheritedFrom: "example.co.uk", orgDomain: "example.co.uk", policyTag: "sp"},
+		{domain: "mail.example.com", dmarc: "v=DMARC1; p=reject;", inheritedFrom: "example.com", orgDomain: "example.com", policyTag: "p"},
+		{domain: "own.example.com", dmarc: "v=DMARC1; p=none;", orgDomain: "example.com", policyTag: "p"},
+		{domain: "example.org", orgDomain: "example.org"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.domain, func(t *testing.T) {
+			results, err := scanner.Scan(testCase.domain)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			require.Equal(t, testCase.dmarc, results[0].DMARC)
+			require.Equal(t, testCase.inheritedFrom, results[0].DMARCInheritedFrom)
+			require.Equal(t, testCase.orgDomain, results[0].DMARCOrgDomain)
+			require.Equal(t, testCase.policyTag, results[0].DMARCPolicyTag)
+		})
+	}
+}
+
+func TestScanDMARCTreeWalk(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := &countingResolver{Resolver: newMockResolver(t,
+		`mail.example.co.uk. 300 IN NS ns1.example.co.uk.`,
+		`a.b.c.d.e.f.g.h.i.example.com. 300 IN NS ns1.example.com.`,
+		`mail.example.org. 300 IN NS ns1.example.org.`,
+		`mail.dept.example.net. 300 IN NS ns1.example.net.`,
+		`mail.team.example.edu. 300 IN NS ns1.example.edu.`,
+		`_dmarc.co.uk. 300 IN TXT "v=DMARC1; p=reject; sp=quarantine; psd=y;"`,
+		`_dmarc.f.g.h.i.example.com. 300 IN TXT "v=DMARC1; p=none;"`,
+		`_dmarc.dept.example.net. 300 IN TXT "v=DMARC1; p=quarantine; psd=n;"`,
+		`_dmarc.example.net. 300 IN TXT "v=DMARC1; p=reject;"`,
+		`_dmarc.team.example.edu. 300 IN TXT "v=DMARC1; p=none;"`,
+		`_dmarc.example.edu. 300 IN TXT "v=DMARC1; p=reject;"`,
+	)}
+
+	scanner, err := New(logger, timeout, WithResolver(resolver), WithDMARCTreeWalk(true))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	testCases := []struct {
+		domain       string
+		dmarc        string
+		policyDomain string
+		orgDomain    string
+		policyTag    string
+		dmarcQueries int
+	}{
+		// the organizational domain doesn't publish a record, but the public suffix does (psd=y), so the
+		// organizational domain is the one below it
+		{domain: "mail.example.co.uk", dmarc: "v=DMARC1; p=reject; sp=quarantine; psd=y;", policyDomain: "co.uk", orgDomain: "example.co.uk", policyTag: "sp", dmarcQueries: 3},
+		// psd=n marks the organizational domain, which stops the walk
+		{domain: "mail.dept.example.net", dmarc: "v=DMARC1; p=quarantine; psd=n;", policyDomain: "dept.example.net", orgDomain: "dept.example.net", policyTag: "p", dmarcQueries: 2},
+		// without psd tags, the first record is the policy and the record with the fewest labels is the organizational domain
+		{domain: "mail.team.example.edu", dmarc: "v=DMARC1; p=none;", policyDomain: "team.example.edu", orgDomain: "example.edu", policyTag: "p", dmarcQueries: 4},
+		// long domains skip to their last 7 labels after the first query
+		{domain: "a.b.c.d.e.f.g.h.i.example.com", dmarc: "v=DMARC1; p=none;", policyDomain: "f.g.h.i.example.com", orgDomain: "f.g.h.i.example.com", policyTag: "p", dmarcQueries: dmarcTreeWalkLimit},
+		{domain: "mail.example.org", orgDomain: "mail.example.org", dmarcQueries: 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.domain, func(t *testing.T) {
+			resolver.reset()
+
+			results, err := scanner.Scan(testCase.domain)
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			require.Equal(t, testCase.dmarc, results[0].DMARC)
+			require.Equal(t, testCase.policyDomain, results[0].DMARCInheritedFrom)
+			require.Equal(t, testCase.orgDomain, results[0].DMARCOrgDomain)
+			require.Equal(t, testCase.policyTag, results[0].DMARCPolicyTag)
+			require.Equal(t, testCase.dmarcQueries, resolver.count("_dmarc."))
+		})
+	}
+
+	t.Run("QueryLimit", func(t *testing.T) {
+		resolver.reset()
+
+		record, policyDomain, orgDomain, err := scanner.walkDMARCTree(context.Background(), "a.b.c.d.e.f.g.h.i.j.k.example.info")
+		require.NoError(t, err)
+		require.Empty(t, record)
+		require.Empty(t, policyDomain)
+		require.Equal(t, "a.b.c.d.e.f.g.h.i.j.k.example.info", orgDomain)
+		require.Equal(t, dmarcTreeWalkLimit, resolver.count("_dmarc."))
+	})
+}
+
+func TestGetDMARCPolicyTag(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	scanner, err := New(logger, timeout, WithResolver(newMockResolver(t,
+		`mail.example.com. 300 IN MX 10 mx.example.com.`,
+	)))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	testCases := []struct {
+		name          string
+		domain        string
+		record        string
+		inheritedFrom string
+		policyTag     string
+	}{
+		{name: "Own", domain: "example.com", record: "v=DMARC1; p=reject; sp=none; np=none;", policyTag: "p"},
+		{name: "Subdomain", domain: "mail.example.com", record: "v=DMARC1; p=reject; sp=quarantine; np=none;", inheritedFrom: "example.com", policyTag: "sp"},
+		{name: "NonExistent", domain: "missing.example.com", record: "v=DMARC1; p=reject; sp=quarantine; np=none;", inheritedFrom: "example.com", policyTag: "np"},
+		// non-existent domains fall back to sp=, then p=
+		{name: "NonExistentWithoutNP", domain: "missing.example.com", record: "v=DMARC1; p=reject; sp=quarantine;", inheritedFrom: "example.com", policyTag: "sp"},
+		{name: "Inherited", domain: "mail.example.com", record: "v=DMARC1; p=reject; np=none;", inheritedFrom: "example.com", policyTag: "p"},
+		{name: "Missing", domain: "mail.example.com"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policyTag, err := scanner.getDMARCPolicyTag(context.Background(), testCase.domain, testCase.record, testCase.inheritedFrom)
+			require.NoError(t, err)
+			require.Equal(t, testCase.policyTag, policyTag)
+		})
+	}
+}
+
+func TestScanDMARCReportAuthorization(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := newMockResolver(t,
+		`example.com. 300 IN NS ns1.example.com.`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject; rua=mailto:dmarc@example.com,mailto:dmarc@reports.example.net!10m; ruf=mailto:dmarc@mail.example.com,mailto:dmarc@example.org"`,
+		`example.com._report._dmarc.reports.example.net. 300 IN TXT "v=DMARC1"`,
+		`mail.example.com. 300 IN NS ns1.example.com.`,
+	)
+
+	scanner, err := New(logger, timeout, WithResolver(resolver))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	t.Run("Domain", func(t *testing.T) {
+		results, err := scanner.Scan("example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Empty(t, results[0].Error)
+
+		require.Equal(t, []*DMARCReportAuthorization{
+			{Destination: "mailto:dmarc@reports.example.net!10m", Domain: "reports.example.net", Name: "example.com._report._dmarc.reports.example.net", Authorized: true, Record: "v=DMARC1"},
+			{Destination: "mailto:dmarc@example.org", Domain: "example.org", Name: "example.com._report._dmarc.example.org"},
+		}, results[0].DMARCReportAuth)
+	})
+
+	t.Run("InheritedRecord", func(t *testing.T) {
+		results, err := scanner.Scan("mail.example.com")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		// the destinations must authorize the organizational domain, which published the record
+		require.Len(t, results[0].DMARCReportAuth, 2)
+		require.True(t, results[0].DMARCReportAuth[0].Authorized)
+		require.Equal(t, "example.com._report._dmarc.reports.example.net", results[0].DMARCReportAuth[0].Name)
+	})
+}
+
+func TestScanNullMX(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := newMockResolver(t,
+		`example.com. 300 IN NS ns1.example.com.`,
+		`example.com. 300 IN MX 0 .`,
+		`example.com. 300 IN TXT "v=spf1 -all"`,
+		`*._domainkey.example.com. 300 IN TXT "v=DKIM1; p="`,
+	)
+
+	scanner, err := New(logger, timeout, WithResolver(resolver))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.Empty(t, result.Error)
+	require.True(t, result.NullMX)
+	require.Equal(t, []string{"."}, result.MX)
+	require.Empty(t, result.TLSA)
+	require.Equal(t, "v=DKIM1; p=", result.DKIMWildcard)
+}
+
+func TestScanErrors(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	resolver := &failingResolver{
+		Resolver: newMockResolver(t,
+			`example.com. 300 IN NS ns1.example.com.`,
+			`example.com. 300 IN TXT "v=spf1 -all"`,
+		),
+		rcodes: map[string]int{
+			"_dmarc.example.com.":            dns.RcodeServerFailure,
+			"google._domainkey.example.com.": dns.RcodeRefused,
+		},
+	}
+
+	scanner, err := New(logger, timeout, WithResolver(resolver), WithDKIMSelectors("google", "selector1"))
+	require.NoError(t, err)
+	defer scanner.Close()
+
+	results, err := scanner.Scan("example.com")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	require.Equal(t, "v=spf1 -all", result.SPF)
+	require.Equal(t, []*CheckError{
+		{
+			Check:      "dkim",
+			Name:       "google._domainkey.example.com.",
+			RecordType: "TXT",
+			Class:      QueryErrorRcode,
+			Rcode:      "REFUSED",
+			Nameserver: "mock",
+			Message:    "selector google: TXT query for google._domainkey.example.com. to mock failed with rcode REFUSED",
+		},
+		{
+			Check:      "dmarc",
+			Name:       "_dmarc.example.com.",
+			RecordType: "TXT",
+			Class:      QueryErrorRcode,
+			Rcode:      "SERVFAIL",
+			Nameserver: "mock",
+			Message:    "TXT query for _dmarc.example.com. to mock failed with rcode SERVFAIL",
+		},
+	}, result.Errors)
+	require.Equal(t, "dkim:selector google: TXT query for google._domainkey.example.com. to mock failed with rcode REFUSED; dmarc:TXT query for _dmarc.example.com. to mock failed with rcode SERVFAIL", result.Error)
+}
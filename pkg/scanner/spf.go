@@ -0,0 +1,450 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// spfLookupLimit is the maximum number of DNS-querying terms an SPF evaluation may use (RFC 7208, section 4.6.4).
+	spfLookupLimit = 10
+
+	// spfMXLimit is the maximum number of MX records a single mx mechanism may resolve (RFC 7208, section 4.6.4).
+	spfMXLimit = 10
+
+	// spfVoidLookupLimit is the maximum number of DNS queries that may return no answers (RFC 7208, section 4.6.4).
+	spfVoidLookupLimit = 2
+)
+
+// errMultipleSPFRecords is returned when a domain publishes more than one SPF record, which is a permerror.
+var errMultipleSPFRecords = errors.New("multiple SPF records found")
+
+type (
+	// SPFNode is a DNS-querying term within an SPF record, along with the
+	// terms of any record it pulls in.
+	SPFNode struct {
+		Term     string     `json:"term,omitempty" yaml:"term,omitempty" doc:"The SPF term which caused the lookup. This is empty for the domain's own record." example:"include:_spf.google.com"`
+		Domain   string     `json:"domain" yaml:"domain" doc:"The domain queried for this term." example:"_spf.google.com"`
+		Record   string     `json:"record,omitempty" yaml:"record,omitempty" doc:"The SPF record found for include and redirect terms." example:"v=spf1 include:_netblocks.google.com ~all"`
+		Error    string     `json:"error,omitempty" yaml:"error,omitempty" doc:"A description of any problem with this term." example:"no SPF record found"`
+		Children []*SPFNode `json:"children,omitempty" yaml:"children,omitempty" doc:"The DNS-querying terms of this term's record."`
+	}
+
+	// SPFTree is the fully expanded SPF record of a domain.
+	SPFTree struct {
+		Root        *SPFNode `json:"root" yaml:"root" doc:"The domain's own SPF record."`
+		Lookups     int      `json:"lookups" yaml:"lookups" doc:"The number of DNS-querying terms used by the record, which must not exceed 10." example:"4"`
+		VoidLookups int      `json:"voidLookups" yaml:"voidLookups" doc:"The number of DNS lookups that returned no answers, which must not exceed 2." example:"0"`
+		PermErrors  []string `json:"permErrors,omitempty" yaml:"permErrors,omitempty" doc:"Problems which cause receivers to treat the record as a permanent error (permerror)." example:"too many DNS lookups (limit 10)"`
+		TempErrors  []string `json:"tempErrors,omitempty" yaml:"tempErrors,omitempty" doc:"DNS lookups which failed, causing receivers to treat the record as a temporary error (temperror)." example:"include:_spf.example.com: TXT query for _spf.example.com. failed with rcode SERVFAIL"`
+	}
+
+	// spfTerm is a single mechanism or modifier within an SPF record.
+	spfTerm struct {
+		// raw is the term as it appears in the record.
+		raw string
+
+		// modifier is set for name=value terms, such as redirect=.
+		modifier bool
+
+		// name is the lower-cased mechanism or modifier name.
+		name string
+
+		// qualifier is the mechanism's result if it matches (+, -, ~ or ?).
+		qualifier byte
+
+		// value is everything after the name, without its leading ':' or '=' (such as "example.com/24").
+		value string
+	}
+)
+
+// isSPFRecord reports whether a TXT record is an SPF record.
+func isSPFRecord(record string) bool {
+	version, _, _ := strings.Cut(record, " ")
+	return strings.EqualFold(version, strings.TrimSpace(SPFPrefix))
+}
+
+// parseSPF splits an SPF record into its terms, returning an error for
+// anything that would cause a permerror during evaluation.
+func parseSPF(record string) ([]spfTerm, error) {
+	fields := strings.Fields(record)
+	if len(fields) == 0 || !isSPFRecord(record) {
+		return nil, fmt.Errorf("not an SPF record")
+	}
+
+	var terms []spfTerm
+	seen := make(map[string]bool)
+
+	for _, field := range fields[1:] {
+		term := spfTerm{raw: field, qualifier: '+'}
+
+		// modifiers have a name made up of letters, digits, '-', '_' and '.', followed by '='
+		if name, value, ok := strings.Cut(field, "="); ok && !strings.ContainsAny(name, ":/") {
+			term.modifier = true
+			term.name = strings.ToLower(name)
+			term.value = value
+
+			if term.name == "redirect" || term.name == "exp" {
+				if seen[term.name] {
+					return nil, fmt.Errorf("%s modifier specified more than once", term.name)
+				}
+
+				if value == "" {
+					return nil, fmt.Errorf("%s modifier has no domain", term.name)
+				}
+
+				seen[term.name] = true
+			}
+
+			terms = append(terms, term)
+			continue
+		}
+
+		if strings.ContainsRune("+-~?", rune(field[0])) {
+			term.qualifier = field[0]
+			field = field[1:]
+		}
+
+		name, value := field, ""
+		if index := strings.IndexAny(field, ":/"); index >= 0 {
+			name, value = field[:index], strings.TrimPrefix(field[index:], ":")
+		}
+
+		term.name = strings.ToLower(name)
+		term.value = value
+
+		switch term.name {
+		case "all":
+			if value != "" {
+				return nil, fmt.Errorf("invalid mechanism %s", term.raw)
+			}
+		case "include", "exists", "ip4", "ip6":
+			if value == "" {
+				return nil, fmt.Errorf("%s mechanism requires a value", term.name)
+			}
+		case "a", "mx", "ptr":
+		default:
+			return nil, fmt.Errorf("unknown mechanism %s", term.raw)
+		}
+
+		terms = append(terms, term)
+	}
+
+	return terms, nil
+}
+
+// domainSpec returns the domain a term refers to, stripping any CIDR length
+// and falling back to the domain of the record that contains the term.
+func (t spfTerm) domainSpec(domain string) string {
+	spec := t.value
+	if t.name == "a" || t.name == "mx" {
+		spec, _, _, _ = splitDualCIDR(spec)
+	}
+
+	if spec == "" {
+		return domain
+	}
+
+	return spec
+}
+
+// splitDualCIDR splits the value of an a or mx mechanism into its domain-spec
+// and prefix lengths, such as "example.com/24//64". Missing lengths default to
+// the full length of an address.
+func splitDualCIDR(value string) (string, int, int, error) {
+	cidr4, cidr6 := 32, 128
+
+	// a '/' within a macro is a delimiter, not the start of a prefix length
+	index, depth := -1, 0
+	for position, char := range value {
+		switch {
+		case char == '{':
+			depth++
+		case char == '}' && depth > 0:
+			depth--
+		case char == '/' && depth == 0:
+			index = position
+		}
+
+		if index >= 0 {
+			break
+		}
+	}
+
+	if index < 0 {
+		return value, cidr4, cidr6, nil
+	}
+
+	spec, lengths := value[:index], value[index+1:]
+
+	var length4, length6 string
+	if strings.HasPrefix(lengths, "/") {
+		length6 = lengths[1:]
+	} else {
+		length4, length6, _ = strings.Cut(lengths, "//")
+	}
+
+	var err error
+
+	if length4 != "" {
+		if cidr4, err = strconv.Atoi(length4); err != nil || cidr4 < 0 || cidr4 > 32 {
+			return "", 0, 0, fmt.Errorf("invalid IPv4 prefix length /%s", length4)
+		}
+	}
+
+	if length6 != "" {
+		if cidr6, err = strconv.Atoi(length6); err != nil || cidr6 < 0 || cidr6 > 128 {
+			return "", 0, 0, fmt.Errorf("invalid IPv6 prefix length //%s", length6)
+		}
+	}
+
+	return spec, cidr4, cidr6, nil
+}
+
+// getSPFRecord returns a domain's SPF record, along with the query's rcode.
+// An empty record is returned if the domain doesn't have one.
+func (s *Scanner) getSPFRecord(ctx context.Context, domain string) (string, int, error) {
+	in, err := s.getDNSResponse(ctx, domain, dns.TypeTXT)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var records []string
+
+	for _, answer := range in.Answer {
+		if txt, ok := answer.(*dns.TXT); ok {
+			// TXT records can be split across multiple strings, so we need to join them
+			if record := strings.Join(txt.Txt, ""); isSPFRecord(record) {
+				records = append(records, record)
+			}
+		}
+	}
+
+	switch len(records) {
+	case 0:
+		return "", in.Rcode, nil
+	case 1:
+		return records[0], in.Rcode, nil
+	default:
+		return "", in.Rcode, errMultipleSPFRecords
+	}
+}
+
+// getTypeSPF queries the DNS server for SPF records of a domain, expanding
+// every include and redirect. It returns the domain's effective SPF record
+// (following redirects), the expanded tree and an error if any occurred. The
+// tree is still returned if any of its lookups failed, along with their errors.
+func (s *Scanner) getTypeSPF(ctx context.Context, domain string) (string, *SPFTree, error) {
+	record, _, err := s.getSPFRecord(ctx, domain)
+	if errors.Is(err, errMultipleSPFRecords) {
+		tree := &SPFTree{Root: &SPFNode{Domain: domain, Error: err.Error()}}
+		tree.permError("%s: %v", domain, err)
+
+		return "", tree, nil
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if record == "" {
+		return "", nil, nil
+	}
+
+	tree := &SPFTree{Root: &SPFNode{Domain: domain, Record: record}}
+	err = s.expandSPF(ctx, tree, tree.Root, nil)
+
+	// report the record that receivers will evaluate
+	effective := tree.Root
+	for {
+		index := slices.IndexFunc(effective.Children, func(child *SPFNode) bool {
+			return strings.HasPrefix(strings.ToLower(child.Term), "redirect=") && child.Record != ""
+		})
+		if index < 0 {
+			break
+		}
+
+		effective = effective.Children[index]
+	}
+
+	return effective.Record, tree, err
+}
+
+// expandSPF expands the DNS-querying terms of a node's record, recursing into
+// any include and redirect targets. The path holds the domains currently being
+// expanded, so loops can be detected. Every term is expanded even if some of
+// their lookups fail, and the errors of those that did are returned together.
+func (s *Scanner) expandSPF(ctx context.Context, tree *SPFTree, node *SPFNode, path []string) error {
+	terms, err := parseSPF(node.Record)
+	if err != nil {
+		node.Error = err.Error()
+		tree.permError("%s: %v", node.Domain, err)
+		return nil
+	}
+
+	path = append(path, dns.CanonicalName(node.Domain))
+
+	var errs []error
+	var redirect *spfTerm
+	hasAll := false
+
+	for index, term := range terms {
+		switch term.name {
+		case "all":
+			hasAll = true
+		case "redirect":
+			if term.modifier {
+				redirect = &terms[index]
+			}
+		case "include", "a", "mx", "ptr", "exists":
+			if !term.modifier {
+				errs = append(errs, s.expandSPFTerm(ctx, tree, node, term, path))
+			}
+		}
+	}
+
+	// redirect is ignored if the record contains an all mechanism
+	if redirect != nil && !hasAll {
+		errs = append(errs, s.expandSPFTerm(ctx, tree, node, *redirect, path))
+	}
+
+	return errors.Join(errs...)
+}
+
+// expandSPFTerm performs the DNS lookup for a single term, adding the result
+// to the node's children. If the lookup fails, it's recorded as a temperror
+// and its error is returned.
+func (s *Scanner) expandSPFTerm(ctx context.Context, tree *SPFTree, node *SPFNode, term spfTerm, path []string) error {
+	child := &SPFNode{Term: term.raw, Domain: term.domainSpec(node.Domain)}
+	node.Children = append(node.Children, child)
+
+	tree.Lookups++
+	if tree.Lookups == spfLookupLimit+1 {
+		tree.permError("too many DNS lookups (limit %d)", spfLookupLimit)
+	}
+
+	// stop querying once the limit is exceeded, as receivers will too
+	if tree.Lookups > spfLookupLimit {
+		child.Error = "not evaluated, as the DNS lookup limit was exceeded"
+		return nil
+	}
+
+	// macros can only be expanded when evaluating a specific sender
+	if strings.Contains(child.Domain, "%") {
+		return nil
+	}
+
+	switch term.name {
+	case "include", "redirect":
+		if slices.Contains(path, dns.CanonicalName(child.Domain)) {
+			child.Error = "loop detected"
+			tree.permError("%s creates a loop", term.raw)
+			return nil
+		}
+
+		record, rcode, err := s.getSPFRecord(ctx, child.Domain)
+		if errors.Is(err, errMultipleSPFRecords) {
+			child.Error = err.Error()
+			tree.permError("%s: %v", term.raw, err)
+
+			return nil
+		}
+
+		if err != nil {
+			return tree.lookupFailed(child, term, err)
+		}
+
+		if record == "" {
+			if rcode == dns.RcodeNameError {
+				child.Error = "domain does not exist (NXDOMAIN)"
+				tree.voidLookup()
+			} else {
+				child.Error = "no SPF record found"
+			}
+
+			tree.permError("%s: %s", term.raw, child.Error)
+
+			return nil
+		}
+
+		child.Record = record
+
+		return s.expandSPF(ctx, tree, child, path)
+	case "a", "exists":
+		found := false
+
+		for _, recordType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			// exists only ever checks for A records
+			if term.name == "exists" && recordType == dns.TypeAAAA {
+				break
+			}
+
+			answers, err := s.getDNSAnswers(ctx, child.Domain, recordType)
+			if err != nil {
+				return tree.lookupFailed(child, term, err)
+			}
+
+			if len(answers) > 0 {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			child.Error = "no address records found"
+			tree.voidLookup()
+		}
+	case "mx":
+		answers, err := s.getDNSAnswers(ctx, child.Domain, dns.TypeMX)
+		if err != nil {
+			return tree.lookupFailed(child, term, err)
+		}
+
+		var mx int
+		for _, answer := range answers {
+			if _, ok := answer.(*dns.MX); ok {
+				mx++
+			}
+		}
+
+		switch {
+		case mx == 0:
+			child.Error = "no MX records found"
+			tree.voidLookup()
+		case mx > spfMXLimit:
+			child.Error = fmt.Sprintf("too many MX records (limit %d)", spfMXLimit)
+			tree.permError("%s: %s", term.raw, child.Error)
+		}
+	}
+
+	return nil
+}
+
+// permError records a condition which causes the record to fail with a permerror.
+func (t *SPFTree) permError(format string, args ...any) {
+	t.PermErrors = append(t.PermErrors, fmt.Sprintf(format, args...))
+}
+
+// lookupFailed records a term whose DNS lookup failed, which causes the record
+// to fail with a temperror (RFC 7208, section 5). It returns the error, with
+// the term added for context.
+func (t *SPFTree) lookupFailed(node *SPFNode, term spfTerm, err error) error {
+	node.Error = err.Error()
+	t.TempErrors = append(t.TempErrors, fmt.Sprintf("%s: %v", term.raw, err))
+
+	return fmt.Errorf("%s: %w", term.raw, err)
+}
+
+// voidLookup records a DNS lookup which returned no answers.
+func (t *SPFTree) voidLookup() {
+	t.VoidLookups++
+	if t.VoidLookups == spfVoidLookupLimit+1 {
+		t.permError("too many void DNS lookups (limit %d)", spfVoidLookupLimit)
+	}
+}
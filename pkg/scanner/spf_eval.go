@@ -0,0 +1,667 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	SPFNone      SPFResult = "none"
+	SPFNeutral   SPFResult = "neutral"
+	SPFPass      SPFResult = "pass"
+	SPFFail      SPFResult = "fail"
+	SPFSoftFail  SPFResult = "softfail"
+	SPFTempError SPFResult = "temperror"
+	SPFPermError SPFResult = "permerror"
+
+	// spfPTRLimit is the maximum number of PTR records used to validate a client's domain name (RFC 7208, section 4.6.4).
+	spfPTRLimit = 10
+)
+
+type (
+	// SPFResult is the result of an SPF evaluation, as defined in RFC 7208, section 2.6.
+	SPFResult string
+
+	// SPFEvaluation is the outcome of evaluating a domain's SPF record for a
+	// specific client IP and sender.
+	SPFEvaluation struct {
+		Result      SPFResult `json:"result" yaml:"result" doc:"The SPF result (pass, fail, softfail, neutral, none, permerror or temperror)." example:"pass"`
+		Domain      string    `json:"domain" yaml:"domain" doc:"The domain whose SPF record produced the result." example:"_spf.google.com"`
+		Mechanism   string    `json:"mechanism,omitempty" yaml:"mechanism,omitempty" doc:"The mechanism that matched, if any." example:"ip4:209.85.128.0/17"`
+		Chain       []string  `json:"chain,omitempty" yaml:"chain,omitempty" doc:"The include and redirect terms followed to reach the matching mechanism." example:"include:_spf.google.com"`
+		Explanation string    `json:"explanation,omitempty" yaml:"explanation,omitempty" doc:"The domain's explanation for a fail result."`
+		Error       string    `json:"error,omitempty" yaml:"error,omitempty" doc:"The reason for a permerror or temperror result." example:"too many DNS lookups (limit 10)"`
+	}
+
+	// spfError aborts an SPF evaluation with a permerror or temperror result.
+	spfError struct {
+		result  SPFResult
+		message string
+	}
+
+	// spfEvaluator holds the state of a single check_host() evaluation, which
+	// is shared across every include and redirect.
+	spfEvaluator struct {
+		scanner *Scanner
+
+		// ip is the SMTP client's IP address.
+		ip netip.Addr
+
+		// helo is the domain given in the SMTP client's HELO or EHLO command.
+		helo string
+
+		// sender is the envelope sender (MAIL FROM), split into its local part and domain.
+		sender, senderLocal, senderDomain string
+
+		// lookups and voidLookups count queries against the limits in RFC 7208, section 4.6.4.
+		lookups, voidLookups int
+	}
+)
+
+func (e *spfError) Error() string {
+	return e.message
+}
+
+func spfPermError(format string, args ...any) error {
+	return &spfError{result: SPFPermError, message: fmt.Sprintf(format, args...)}
+}
+
+func spfTempError(format string, args ...any) error {
+	return &spfError{result: SPFTempError, message: fmt.Sprintf(format, args...)}
+}
+
+// EvaluateSPF determines whether the client at ip may send mail for a sender,
+// as defined by the check_host() function in RFC 7208. The domain evaluated
+// is taken from the envelope sender (MAIL FROM), or from helo if the sender is
+// empty, as it is for bounce messages.
+func (s *Scanner) EvaluateSPF(ctx context.Context, ip netip.Addr, sender, helo string) (*SPFEvaluation, error) {
+	if !ip.IsValid() {
+		return nil, errors.New("invalid IP address")
+	}
+
+	if sender == "" {
+		if helo == "" {
+			return nil, errors.New("a sender or HELO domain is required")
+		}
+
+		sender = "postmaster@" + helo
+	}
+
+	// the local part may contain '@' if it's quoted, so the domain follows the last one (RFC 7208, section 4.3)
+	local, domain := "postmaster", sender
+	if index := strings.LastIndex(sender, "@"); index >= 0 {
+		local, domain = sender[:index], sender[index+1:]
+	}
+
+	if local == "" {
+		local = "postmaster"
+	}
+
+	domain = strings.TrimSuffix(domain, ".")
+
+	evaluator := &spfEvaluator{
+		scanner:      s,
+		ip:           ip.Unmap(),
+		helo:         helo,
+		sender:       local + "@" + domain,
+		senderLocal:  local,
+		senderDomain: domain,
+	}
+
+	// a malformed domain can't have an SPF record (RFC 7208, section 4.3)
+	if _, ok := dns.IsDomainName(domain); !ok || !strings.Contains(domain, ".") {
+		return &SPFEvaluation{Result: SPFNone, Domain: domain, Error: "invalid domain"}, nil
+	}
+
+	return evaluator.checkHost(ctx, domain), nil
+}
+
+// checkHost evaluates the SPF record of a domain.
+func (e *spfEvaluator) checkHost(ctx context.Context, domain string) *SPFEvaluation {
+	evaluation := &SPFEvaluation{Domain: domain}
+
+	record, _, err := e.scanner.getSPFRecord(ctx, domain)
+	if err != nil {
+		if errors.Is(err, errMultipleSPFRecords) {
+			return evaluation.fail(spfPermError("%v", err))
+		}
+
+		return evaluation.fail(spfTempError("SPF lookup for %s failed: %v", domain, err))
+	}
+
+	if record == "" {
+		evaluation.Result = SPFNone
+		return evaluation
+	}
+
+	terms, err := parseSPF(record)
+	if err != nil {
+		return evaluation.fail(spfPermError("%v", err))
+	}
+
+	for _, term := range terms {
+		if term.modifier {
+			continue
+		}
+
+		matched, nested, err := e.match(ctx, domain, term)
+		if err != nil {
+			return evaluation.fail(err)
+		}
+
+		if !matched {
+			continue
+		}
+
+		evaluation.Result = spfQualifierResult(term.qualifier)
+		evaluation.Mechanism = term.raw
+
+		// report the mechanism within the included record which matched
+		if nested != nil {
+			evaluation.Domain = nested.Domain
+			evaluation.Mechanism = nested.Mechanism
+			evaluation.Chain = append([]string{term.raw}, nested.Chain...)
+		}
+
+		if evaluation.Result == SPFFail {
+			evaluation.Explanation = e.explain(ctx, domain, terms)
+		}
+
+		return evaluation
+	}
+
+	for _, term := range terms {
+		if !term.modifier || term.name != "redirect" {
+			continue
+		}
+
+		if err = e.countLookup(); err != nil {
+			return evaluation.fail(err)
+		}
+
+		target, err := e.expandDomainSpec(ctx, term.value, domain)
+		if err != nil {
+			return evaluation.fail(err)
+		}
+
+		redirected := e.checkHost(ctx, target)
+		if redirected.Result == SPFNone {
+			return evaluation.fail(spfPermError("%s has no SPF record", term.raw))
+		}
+
+		redirected.Chain = append([]string{term.raw}, redirected.Chain...)
+
+		return redirected
+	}
+
+	evaluation.Result = SPFNeutral
+
+	return evaluation
+}
+
+// match reports whether a mechanism matches the client. For include
+// mechanisms, the evaluation of the included record is also returned.
+func (e *spfEvaluator) match(ctx context.Context, domain string, term spfTerm) (bool, *SPFEvaluation, error) {
+	switch term.name {
+	case "include", "a", "mx", "ptr", "exists":
+		if err := e.countLookup(); err != nil {
+			return false, nil, err
+		}
+	}
+
+	// only the a and mx mechanisms accept prefix lengths after their domain-spec
+	spec, cidr4, cidr6 := term.value, 32, 128
+	if term.name == "a" || term.name == "mx" {
+		var err error
+		if spec, cidr4, cidr6, err = splitDualCIDR(term.value); err != nil {
+			return false, nil, spfPermError("%s: %v", term.raw, err)
+		}
+	}
+
+	target := domain
+	if spec != "" && term.name != "ip4" && term.name != "ip6" {
+		var err error
+		if target, err = e.expandDomainSpec(ctx, spec, domain); err != nil {
+			return false, nil, err
+		}
+	}
+
+	switch term.name {
+	case "all":
+		return true, nil, nil
+	case "include":
+		included := e.checkHost(ctx, target)
+
+		switch included.Result {
+		case SPFPass:
+			return true, included, nil
+		case SPFFail, SPFSoftFail, SPFNeutral:
+			return false, nil, nil
+		case SPFNone:
+			return false, nil, spfPermError("%s has no SPF record", term.raw)
+		default:
+			return false, nil, &spfError{result: included.Result, message: included.Error}
+		}
+	case "a":
+		return e.matchHost(ctx, target, cidr4, cidr6)
+	case "mx":
+		answers, err := e.lookup(ctx, target, dns.TypeMX)
+		if err != nil {
+			return false, nil, err
+		}
+
+		if len(answers) > spfMXLimit {
+			return false, nil, spfPermError("%s: too many MX records (limit %d)", term.raw, spfMXLimit)
+		}
+
+		for _, answer := range answers {
+			// a null MX can't match
+			if host := answer.(*dns.MX).Mx; host != "." {
+				if matched, _, err := e.matchHost(ctx, host, cidr4, cidr6); matched || err != nil {
+					return matched, nil, err
+				}
+			}
+		}
+
+		return false, nil, nil
+	case "ptr":
+		for _, name := range e.validatedNames(ctx) {
+			if dns.IsSubDomain(dns.Fqdn(target), name) {
+				return true, nil, nil
+			}
+		}
+
+		return false, nil, nil
+	case "ip4", "ip6":
+		prefix, err := parseSPFPrefix(term.name, term.value)
+		if err != nil {
+			return false, nil, spfPermError("%s: %v", term.raw, err)
+		}
+
+		return prefix.Contains(e.ip), nil, nil
+	case "exists":
+		answers, err := e.lookup(ctx, target, dns.TypeA)
+		if err != nil {
+			return false, nil, err
+		}
+
+		return len(answers) > 0, nil, nil
+	}
+
+	return false, nil, spfPermError("unknown mechanism %s", term.raw)
+}
+
+// matchHost reports whether any of a host's addresses, within the given
+// prefix lengths, contains the client's IP.
+func (e *spfEvaluator) matchHost(ctx context.Context, host string, cidr4, cidr6 int) (bool, *SPFEvaluation, error) {
+	recordType, bits := dns.TypeA, cidr4
+	if e.ip.Is6() {
+		recordType, bits = dns.TypeAAAA, cidr6
+	}
+
+	answers, err := e.lookup(ctx, host, recordType)
+	if err != nil {
+		return false, nil, err
+	}
+
+	for _, answer := range answers {
+		var address netip.Addr
+
+		switch record := answer.(type) {
+		case *dns.A:
+			address, _ = netip.AddrFromSlice(record.A.To4())
+		case *dns.AAAA:
+			address, _ = netip.AddrFromSlice(record.AAAA)
+		}
+
+		if prefix, err := address.Prefix(bits); err == nil && prefix.Contains(e.ip) {
+			return true, nil, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
+// validatedNames returns the client's domain names which resolve back to its
+// IP, as used by the ptr mechanism and the %{p} macro. DNS errors cause names
+// to be skipped, rather than failing the evaluation.
+func (e *spfEvaluator) validatedNames(ctx context.Context) []string {
+	reverse, err := dns.ReverseAddr(e.ip.String())
+	if err != nil {
+		return nil
+	}
+
+	answers, err := e.lookup(ctx, reverse, dns.TypePTR)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+
+	for index, answer := range answers {
+		if index == spfPTRLimit {
+			break
+		}
+
+		name := answer.(*dns.PTR).Ptr
+		if matched, _, err := e.matchHost(ctx, name, 32, 128); err == nil && matched {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// lookup returns the answers of a specific type for a domain, counting any
+// lookup without answers against the void lookup limit.
+func (e *spfEvaluator) lookup(ctx context.Context, domain string, recordType uint16) ([]dns.RR, error) {
+	in, err := e.scanner.getDNSResponse(ctx, domain, recordType)
+	if err != nil {
+		return nil, spfTempError("%s lookup for %s failed: %v", dns.TypeToString[recordType], domain, err)
+	}
+
+	var answers []dns.RR
+	for _, answer := range in.Answer {
+		if answer.Header().Rrtype == recordType {
+			answers = append(answers, answer)
+		}
+	}
+
+	if len(answers) == 0 {
+		e.voidLookups++
+		if e.voidLookups > spfVoidLookupLimit {
+			return nil, spfPermError("too many void DNS lookups (limit %d)", spfVoidLookupLimit)
+		}
+	}
+
+	return answers, nil
+}
+
+// countLookup counts a DNS-querying term against the lookup limit.
+func (e *spfEvaluator) countLookup() error {
+	e.lookups++
+	if e.lookups > spfLookupLimit {
+		return spfPermError("too many DNS lookups (limit %d)", spfLookupLimit)
+	}
+
+	return nil
+}
+
+// explain returns the explanation for a fail result, from the exp= modifier.
+// Any problem retrieving it results in no explanation (RFC 7208, section 6.2).
+func (e *spfEvaluator) explain(ctx context.Context, domain string, terms []spfTerm) string {
+	index := slices.IndexFunc(terms, func(term spfTerm) bool { return term.modifier && term.name == "exp" })
+	if index < 0 {
+		return ""
+	}
+
+	target, err := e.expandDomainSpec(ctx, terms[index].value, domain)
+	if err != nil {
+		return ""
+	}
+
+	answers, err := e.scanner.getDNSAnswers(ctx, target, dns.TypeTXT)
+	if err != nil {
+		return ""
+	}
+
+	var records []string
+	for _, answer := range answers {
+		if txt, ok := answer.(*dns.TXT); ok {
+			records = append(records, strings.Join(txt.Txt, ""))
+		}
+	}
+
+	if len(records) != 1 {
+		return ""
+	}
+
+	explanation, err := e.expandMacros(ctx, records[0], domain, true)
+	if err != nil {
+		return ""
+	}
+
+	return explanation
+}
+
+// expandDomainSpec expands the macros in a domain-spec, truncating the result
+// from the left if it's too long to be a domain name (RFC 7208, section 7.3).
+func (e *spfEvaluator) expandDomainSpec(ctx context.Context, spec, domain string) (string, error) {
+	expanded, err := e.expandMacros(ctx, spec, domain, false)
+	if err != nil {
+		return "", err
+	}
+
+	expanded = strings.TrimSuffix(expanded, ".")
+	for len(expanded) > 253 {
+		_, expanded, _ = strings.Cut(expanded, ".")
+	}
+
+	if _, ok := dns.IsDomainName(expanded); !ok || expanded == "" {
+		return "", spfPermError("invalid domain %q", expanded)
+	}
+
+	return expanded, nil
+}
+
+// expandMacros expands a macro-string, as defined in RFC 7208, section 7. The
+// c, r and t macros are only allowed within explanations.
+func (e *spfEvaluator) expandMacros(ctx context.Context, macroString, domain string, explanation bool) (string, error) {
+	var expanded strings.Builder
+
+	for index := 0; index < len(macroString); index++ {
+		if macroString[index] != '%' {
+			expanded.WriteByte(macroString[index])
+			continue
+		}
+
+		if index+1 == len(macroString) {
+			return "", spfPermError("incomplete macro in %q", macroString)
+		}
+
+		index++
+
+		switch macroString[index] {
+		case '%':
+			expanded.WriteByte('%')
+		case '_':
+			expanded.WriteByte(' ')
+		case '-':
+			expanded.WriteString("%20")
+		case '{':
+			end := strings.IndexByte(macroString[index:], '}')
+			if end < 0 {
+				return "", spfPermError("unterminated macro in %q", macroString)
+			}
+
+			value, err := e.expandMacro(ctx, macroString[index+1:index+end], domain, explanation)
+			if err != nil {
+				return "", err
+			}
+
+			expanded.WriteString(value)
+			index += end
+		default:
+			return "", spfPermError("invalid macro in %q", macroString)
+		}
+	}
+
+	return expanded.String(), nil
+}
+
+// expandMacro expands the body of a single %{...} macro, such as "ir" or "d2".
+func (e *spfEvaluator) expandMacro(ctx context.Context, macro, domain string, explanation bool) (string, error) {
+	if macro == "" {
+		return "", spfPermError("empty macro")
+	}
+
+	letter := macro[0]
+	escape := letter >= 'A' && letter <= 'Z'
+
+	var value string
+
+	switch letter | 0x20 { // lower-case the letter
+	case 's':
+		value = e.sender
+	case 'l':
+		value = e.senderLocal
+	case 'o':
+		value = e.senderDomain
+	case 'd':
+		value = domain
+	case 'i':
+		value = spfDottedIP(e.ip)
+	case 'p':
+		value = "unknown"
+
+		// prefer a name within the domain being evaluated
+		names := e.validatedNames(ctx)
+		for _, name := range names {
+			if dns.IsSubDomain(dns.Fqdn(domain), name) {
+				value = strings.TrimSuffix(name, ".")
+				break
+			}
+		}
+
+		if value == "unknown" && len(names) > 0 {
+			value = strings.TrimSuffix(names[0], ".")
+		}
+	case 'v':
+		value = "in-addr"
+		if e.ip.Is6() {
+			value = "ip6"
+		}
+	case 'h':
+		value = e.helo
+	case 'c', 'r', 't':
+		if !explanation {
+			return "", spfPermError("the %c macro is only allowed in explanations", letter)
+		}
+
+		switch letter | 0x20 {
+		case 'c':
+			value = e.ip.String()
+		case 'r':
+			value = "unknown"
+		case 't':
+			value = strconv.FormatInt(time.Now().Unix(), 10)
+		}
+	default:
+		return "", spfPermError("unknown macro letter %c", letter)
+	}
+
+	// parse the optional transformers (a number of parts to keep, and r to reverse), followed by the delimiters
+	transformers := macro[1:]
+	digits := len(transformers) - len(strings.TrimLeft(transformers, "0123456789"))
+
+	keep := 0
+	if digits > 0 {
+		var err error
+		if keep, err = strconv.Atoi(transformers[:digits]); err != nil || keep == 0 {
+			return "", spfPermError("invalid macro transformer in %%{%s}", macro)
+		}
+	}
+
+	transformers = transformers[digits:]
+	reverse := strings.HasPrefix(transformers, "r") || strings.HasPrefix(transformers, "R")
+	if reverse {
+		transformers = transformers[1:]
+	}
+
+	delimiters := "."
+	if transformers != "" {
+		if strings.Trim(transformers, ".-+,/_=") != "" {
+			return "", spfPermError("invalid macro delimiter in %%{%s}", macro)
+		}
+
+		delimiters = transformers
+	}
+
+	parts := strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(delimiters, r) })
+	if reverse {
+		slices.Reverse(parts)
+	}
+
+	if keep > 0 && keep < len(parts) {
+		parts = parts[len(parts)-keep:]
+	}
+
+	value = strings.Join(parts, ".")
+
+	if escape {
+		value = url.QueryEscape(value)
+		value = strings.ReplaceAll(value, "+", "%20")
+	}
+
+	return value, nil
+}
+
+// fail sets the result of an evaluation that was aborted by an error.
+func (evaluation *SPFEvaluation) fail(err error) *SPFEvaluation {
+	var spfErr *spfError
+	if !errors.As(err, &spfErr) {
+		spfErr = &spfError{result: SPFTempError, message: err.Error()}
+	}
+
+	evaluation.Result = spfErr.result
+	evaluation.Error = spfErr.message
+
+	return evaluation
+}
+
+// parseSPFPrefix parses the network of an ip4 or ip6 mechanism.
+func parseSPFPrefix(mechanism, value string) (netip.Prefix, error) {
+	address, length, hasLength := strings.Cut(value, "/")
+
+	ip, err := netip.ParseAddr(address)
+	if err != nil || (mechanism == "ip4") != ip.Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid %s address %s", mechanism, address)
+	}
+
+	bits := ip.BitLen()
+	if hasLength {
+		if bits, err = strconv.Atoi(length); err != nil || bits < 0 || bits > ip.BitLen() || strings.HasPrefix(length, "0") && length != "0" {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix length /%s", length)
+		}
+	}
+
+	return ip.Prefix(bits)
+}
+
+// spfDottedIP formats an IP for the i macro. IPv6 addresses are written as
+// dot-separated nibbles (RFC 7208, section 7.3).
+func spfDottedIP(ip netip.Addr) string {
+	if ip.Is4() {
+		return ip.String()
+	}
+
+	nibbles := make([]string, 0, 32)
+	for _, b := range ip.As16() {
+		nibbles = append(nibbles, strconv.FormatUint(uint64(b>>4), 16), strconv.FormatUint(uint64(b&0xf), 16))
+	}
+
+	return strings.Join(nibbles, ".")
+}
+
+// spfQualifierResult maps a mechanism's qualifier to its result.
+func spfQualifierResult(qualifier byte) SPFResult {
+	switch qualifier {
+	case '-':
+		return SPFFail
+	case '~':
+		return SPFSoftFail
+	case '?':
+		return SPFNeutral
+	default:
+		return SPFPass
+	}
+}
@@ -0,0 +1,180 @@
+package scanner
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// spfTestZone is the example zone from RFC 7208, appendix A.
+var spfTestZone = []string{
+	`example.com. 300 IN MX 10 mx.example.com.`,
+	`example.com. 300 IN MX 20 mx2.example.com.`,
+	`example.com. 300 IN A 192.0.2.10`,
+	`example.com. 300 IN A 192.0.2.11`,
+	`mx.example.com. 300 IN A 192.0.2.129`,
+	`mx2.example.com. 300 IN A 192.0.2.130`,
+	`amy.example.com. 300 IN A 192.0.2.65`,
+	`bob.example.com. 300 IN A 192.0.2.66`,
+	`mail-c.example.org. 300 IN A 192.0.2.142`,
+	`example.org. 300 IN MX 10 mail-c.example.org.`,
+	`65.2.0.192.in-addr.arpa. 300 IN PTR amy.example.com.`,
+	`66.2.0.192.in-addr.arpa. 300 IN PTR bob.example.com.`,
+	`142.2.0.192.in-addr.arpa. 300 IN PTR mail-c.example.org.`,
+}
+
+func TestEvaluateSPF(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	testCases := []struct {
+		name      string
+		record    string
+		ip        string
+		result    SPFResult
+		mechanism string
+	}{
+		{"All", `v=spf1 +all`, "192.0.2.65", SPFPass, "+all"},
+		{"ANoMatch", `v=spf1 a -all`, "192.0.2.65", SPFFail, "-all"},
+		{"A", `v=spf1 a -all`, "192.0.2.10", SPFPass, "a"},
+		{"ADualCIDR", `v=spf1 a/24 -all`, "192.0.2.65", SPFPass, "a/24"},
+		{"AOtherDomain", `v=spf1 a:mail-c.example.org -all`, "192.0.2.142", SPFPass, "a:mail-c.example.org"},
+		{"MX", `v=spf1 mx -all`, "192.0.2.129", SPFPass, "mx"},
+		{"MXOtherDomain", `v=spf1 mx:example.org -all`, "192.0.2.142", SPFPass, "mx:example.org"},
+		{"PTR", `v=spf1 ptr -all`, "192.0.2.65", SPFPass, "ptr"},
+		{"PTROtherDomain", `v=spf1 ptr -all`, "192.0.2.142", SPFFail, "-all"},
+		{"IP4", `v=spf1 ip4:192.0.2.128/28 -all`, "192.0.2.129", SPFPass, "ip4:192.0.2.128/28"},
+		{"IP6", `v=spf1 ip6:2001:db8::/32 -all`, "2001:db8::cb01", SPFPass, "ip6:2001:db8::/32"},
+		{"SoftFail", `v=spf1 ip4:192.0.2.1 ~all`, "192.0.2.65", SPFSoftFail, "~all"},
+		{"Neutral", `v=spf1 ip4:192.0.2.1`, "192.0.2.65", SPFNeutral, ""},
+		{"Exists", `v=spf1 exists:%{l}.%{d} -all`, "192.0.2.10", SPFFail, "-all"},
+		{"ExistsMacro", `v=spf1 exists:%{ir}.%{l1r-}.example.com -all`, "192.0.2.65", SPFFail, "-all"},
+		{"Syntax", `v=spf1 ip4:192.0.2.1/33 -all`, "192.0.2.1", SPFPermError, ""},
+		{"MissingInclude", `v=spf1 include:missing.example.com -all`, "192.0.2.1", SPFPermError, ""},
+		{"LookupLimit", `v=spf1 a a a a a a a a a a a -all`, "192.0.2.1", SPFPermError, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			records := append([]string{`example.com. 300 IN TXT "` + testCase.record + `"`}, spfTestZone...)
+
+			scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, records...)))
+			require.NoError(t, err)
+			defer scanner.Close()
+
+			evaluation, err := scanner.EvaluateSPF(context.Background(), netip.MustParseAddr(testCase.ip), "strong-bad@example.com", "mx.example.com")
+			require.NoError(t, err)
+			require.Equal(t, testCase.result, evaluation.Result, evaluation.Error)
+			require.Equal(t, testCase.mechanism, evaluation.Mechanism)
+		})
+	}
+
+	t.Run("Include", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t,
+			`example.com. 300 IN TXT "v=spf1 include:_spf.example.org -all"`,
+			`_spf.example.org. 300 IN TXT "v=spf1 redirect=_netblocks.example.org"`,
+			`_netblocks.example.org. 300 IN TXT "v=spf1 ip4:198.51.100.0/24 ~all"`,
+		)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		evaluation, err := scanner.EvaluateSPF(context.Background(), netip.MustParseAddr("198.51.100.7"), "bounce@example.com", "")
+		require.NoError(t, err)
+		require.Equal(t, &SPFEvaluation{
+			Result:    SPFPass,
+			Domain:    "_netblocks.example.org",
+			Mechanism: "ip4:198.51.100.0/24",
+			Chain:     []string{"include:_spf.example.org", "redirect=_netblocks.example.org"},
+		}, evaluation)
+	})
+
+	t.Run("Explanation", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t,
+			`example.com. 300 IN TXT "v=spf1 -all exp=explain.example.com"`,
+			`explain.example.com. 300 IN TXT "%{i} is not one of %{d}'s designated mail servers."`,
+		)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		evaluation, err := scanner.EvaluateSPF(context.Background(), netip.MustParseAddr("192.0.2.3"), "", "example.com")
+		require.NoError(t, err)
+		require.Equal(t, SPFFail, evaluation.Result)
+		require.Equal(t, "192.0.2.3 is not one of example.com's designated mail servers.", evaluation.Explanation)
+	})
+
+	t.Run("QuotedLocalPart", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t,
+			`example.com. 300 IN TXT "v=spf1 ip4:192.0.2.3 -all"`,
+			`example.org. 300 IN TXT "v=spf1 -all"`,
+		)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		// the sender's domain follows the last '@', not the one within the quoted local part
+		evaluation, err := scanner.EvaluateSPF(context.Background(), netip.MustParseAddr("192.0.2.3"), `"bounce@example.org"@example.com`, "")
+		require.NoError(t, err)
+		require.Equal(t, SPFPass, evaluation.Result)
+		require.Equal(t, "example.com", evaluation.Domain)
+	})
+
+	t.Run("None", func(t *testing.T) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		evaluation, err := scanner.EvaluateSPF(context.Background(), netip.MustParseAddr("192.0.2.3"), "bounce@example.com", "")
+		require.NoError(t, err)
+		require.Equal(t, SPFNone, evaluation.Result)
+	})
+}
+
+func TestSPFMacros(t *testing.T) {
+	// examples from RFC 7208, section 7.4
+	evaluator := &spfEvaluator{
+		ip:           netip.MustParseAddr("192.0.2.3"),
+		sender:       "strong-bad@email.example.com",
+		senderLocal:  "strong-bad",
+		senderDomain: "email.example.com",
+	}
+
+	for macro, expected := range map[string]string{
+		"%{s}":                              "strong-bad@email.example.com",
+		"%{o}":                              "email.example.com",
+		"%{d}":                              "email.example.com",
+		"%{d4}":                             "email.example.com",
+		"%{d3}":                             "email.example.com",
+		"%{d2}":                             "example.com",
+		"%{d1}":                             "com",
+		"%{dr}":                             "com.example.email",
+		"%{d2r}":                            "example.email",
+		"%{l}":                              "strong-bad",
+		"%{l-}":                             "strong.bad",
+		"%{lr}":                             "strong-bad",
+		"%{lr-}":                            "bad.strong",
+		"%{l1r-}":                           "strong",
+		"%{ir}.%{v}._spf.%{d2}":             "3.2.0.192.in-addr._spf.example.com",
+		"%{lr-}.lp._spf.%{d2}":              "bad.strong.lp._spf.example.com",
+		"%{lr-}.lp.%{ir}.%{v}._spf.%{d2}":   "bad.strong.lp.3.2.0.192.in-addr._spf.example.com",
+		"%{ir}.%{v}.%{l1r-}.lp._spf.%{d2}":  "3.2.0.192.in-addr.strong.lp._spf.example.com",
+		"%{d2}.trusted-domains.example.net": "example.com.trusted-domains.example.net",
+		"%%%_%-":                            "% %20",
+		"%{S}":                              "strong-bad%40email.example.com",
+	} {
+		expanded, err := evaluator.expandMacros(context.Background(), macro, "email.example.com", false)
+		require.NoError(t, err, macro)
+		require.Equal(t, expected, expanded, macro)
+	}
+
+	evaluator.ip = netip.MustParseAddr("2001:db8::cb01")
+
+	expanded, err := evaluator.expandMacros(context.Background(), "%{ir}.%{v}._spf.%{d2}", "email.example.com", false)
+	require.NoError(t, err)
+	require.Equal(t, "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com", expanded)
+
+	_, err = evaluator.expandMacros(context.Background(), "%{t}", "email.example.com", false)
+	require.Error(t, err)
+}
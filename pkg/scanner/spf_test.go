@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSPF(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		terms, err := parseSPF("v=spf1 ip4:192.0.2.0/24 a/24 -mx:example.com include:_spf.example.com redirect=example.net ~all")
+		require.NoError(t, err)
+		require.Len(t, terms, 6)
+
+		require.Equal(t, "a", terms[1].name)
+		require.Equal(t, "example.org", terms[1].domainSpec("example.org"))
+		require.Equal(t, byte('-'), terms[2].qualifier)
+		require.Equal(t, "example.com", terms[2].domainSpec("example.org"))
+		require.True(t, terms[4].modifier)
+		require.Equal(t, "example.net", terms[4].domainSpec("example.org"))
+		require.Equal(t, byte('~'), terms[5].qualifier)
+	})
+
+	t.Run("MacroDelimiters", func(t *testing.T) {
+		terms, err := parseSPF("v=spf1 include:%{d2/}._spf.example.com a:%{l/}.example.com/24//64 -all")
+		require.NoError(t, err)
+
+		// a '/' within a macro is a delimiter, not the start of a prefix length
+		require.Equal(t, "%{d2/}._spf.example.com", terms[0].domainSpec("example.org"))
+		require.Equal(t, "%{l/}.example.com", terms[1].domainSpec("example.org"))
+	})
+
+	for name, record := range map[string]string{
+		"DuplicateRedirect": "v=spf1 redirect=example.com redirect=example.net",
+		"EmptyInclude":      "v=spf1 include: -all",
+		"UnknownMechanism":  "v=spf1 ip:192.0.2.1 -all",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSPF(record)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestGetTypeSPF(t *testing.T) {
+	logger := zerolog.Nop()
+	timeout := time.Second * 5
+
+	getTree := func(t *testing.T, records ...string) (string, *SPFTree) {
+		scanner, err := New(logger, timeout, WithResolver(newMockResolver(t, records...)))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		record, tree, err := scanner.getTypeSPF(context.Background(), "example.com")
+		require.NoError(t, err)
+
+		return record, tree
+	}
+
+	t.Run("Redirect", func(t *testing.T) {
+		record, tree := getTree(t,
+			`example.com. 300 IN TXT "v=spf1 redirect=_spf.example.com"`,
+			`_spf.example.com. 300 IN TXT "v=spf1 include:_spf.example.net " "mx -all"`,
+			`_spf.example.net. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 -all"`,
+			`_spf.example.com. 300 IN MX 10 mail.example.com.`,
+		)
+
+		require.Equal(t, "v=spf1 include:_spf.example.net mx -all", record)
+		require.Empty(t, tree.PermErrors)
+		require.Equal(t, 3, tree.Lookups)
+		require.Zero(t, tree.VoidLookups)
+
+		redirect := tree.Root.Children[0]
+		require.Equal(t, "redirect=_spf.example.com", redirect.Term)
+		require.Len(t, redirect.Children, 2)
+		require.Equal(t, "v=spf1 ip4:192.0.2.0/24 -all", redirect.Children[0].Record)
+	})
+
+	t.Run("LookupLimit", func(t *testing.T) {
+		_, tree := getTree(t,
+			`example.com. 300 IN TXT "v=spf1 a a a a a a a a a a a -all"`,
+			`example.com. 300 IN A 192.0.2.1`,
+		)
+
+		require.Equal(t, 11, tree.Lookups)
+		require.Equal(t, []string{"too many DNS lookups (limit 10)"}, tree.PermErrors)
+	})
+
+	t.Run("VoidLookupLimit", func(t *testing.T) {
+		_, tree := getTree(t,
+			`example.com. 300 IN TXT "v=spf1 a:a.example.com mx:b.example.com exists:c.example.com -all"`,
+		)
+
+		require.Equal(t, 3, tree.VoidLookups)
+		require.Equal(t, []string{"too many void DNS lookups (limit 2)"}, tree.PermErrors)
+	})
+
+	t.Run("Loop", func(t *testing.T) {
+		_, tree := getTree(t,
+			`example.com. 300 IN TXT "v=spf1 include:_spf.example.com -all"`,
+			`_spf.example.com. 300 IN TXT "v=spf1 include:example.com -all"`,
+		)
+
+		require.Equal(t, []string{"include:example.com creates a loop"}, tree.PermErrors)
+	})
+
+	t.Run("FailedLookup", func(t *testing.T) {
+		resolver := &failingResolver{
+			Resolver: newMockResolver(t,
+				`example.com. 300 IN TXT "v=spf1 include:_spf.example.com a:mail.example.com -all"`,
+				`mail.example.com. 300 IN A 192.0.2.1`,
+			),
+			rcodes: map[string]int{"_spf.example.com.": dns.RcodeServerFailure},
+		}
+
+		scanner, err := New(logger, timeout, WithResolver(resolver))
+		require.NoError(t, err)
+		defer scanner.Close()
+
+		// the rest of the tree is still expanded, but the record can only evaluate to a temperror
+		record, tree, err := scanner.getTypeSPF(context.Background(), "example.com")
+		require.Equal(t, "v=spf1 include:_spf.example.com a:mail.example.com -all", record)
+		require.Empty(t, tree.PermErrors)
+		require.Equal(t, []string{"include:_spf.example.com: TXT query for _spf.example.com. to mock failed with rcode SERVFAIL"}, tree.TempErrors)
+		require.Equal(t, 2, tree.Lookups)
+		require.Empty(t, tree.Root.Children[1].Error)
+
+		var queryErr *QueryError
+		require.ErrorAs(t, err, &queryErr)
+		require.Equal(t, "_spf.example.com.", queryErr.Name)
+		require.Equal(t, "SERVFAIL", queryErr.Rcode)
+	})
+
+	t.Run("MissingInclude", func(t *testing.T) {
+		_, tree := getTree(t,
+			`example.com. 300 IN TXT "v=spf1 include:_spf.example.com include:example.net -all"`,
+			`example.net. 300 IN TXT "google-site-verification=abc"`,
+		)
+
+		require.Equal(t, []string{
+			"include:_spf.example.com: domain does not exist (NXDOMAIN)",
+			"include:example.net: no SPF record found",
+		}, tree.PermErrors)
+	})
+}
@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type (
+	// TLSAResult holds the DANE TLSA records published for a mail server.
+	TLSAResult struct {
+		Host    string       `json:"host" yaml:"host" doc:"The mail server's hostname." example:"mail.example.com."`
+		Records []TLSARecord `json:"records" yaml:"records" doc:"The TLSA records published at _25._tcp.<host>."`
+		DNSSEC  DNSSECStatus `json:"dnssec" yaml:"dnssec" doc:"The DNSSEC status of the TLSA records, which must be secure for senders to use them." example:"secure"`
+	}
+
+	// TLSARecord is a single TLSA record, as defined in RFC 6698.
+	TLSARecord struct {
+		Usage        uint8  `json:"usage" yaml:"usage" doc:"The certificate usage (0 PKIX-TA, 1 PKIX-EE, 2 DANE-TA or 3 DANE-EE)." example:"3"`
+		Selector     uint8  `json:"selector" yaml:"selector" doc:"Whether the full certificate (0) or its public key (1) is matched." example:"1"`
+		MatchingType uint8  `json:"matchingType" yaml:"matchingType" doc:"Whether the data is matched exactly (0), or as a SHA-256 (1) or SHA-512 (2) hash." example:"1"`
+		Certificate  string `json:"certificate" yaml:"certificate" doc:"The hex-encoded certificate association data." example:"0b8d8d2ba0ef1ea2e2b94a6f0d1f6e0c0dbf6a3c5c8d2e6f1a9b7c3d4e5f6a7b"`
+	}
+)
+
+// getTypeTLSA queries the DNS server for the SMTP TLSA records of each mail
+// server. Only servers which publish TLSA records are returned, and a failed
+// lookup for one server doesn't prevent the others from being checked.
+func (s *Scanner) getTypeTLSA(ctx context.Context, mx []string) ([]*TLSAResult, error) {
+	var results []*TLSAResult
+	var errs []error
+
+	for _, host := range mx {
+		// a null MX doesn't accept mail
+		if host == "." {
+			continue
+		}
+
+		ctx, tracker := withQueryTracker(ctx)
+
+		answers, err := s.getDNSAnswers(ctx, "_25._tcp."+host, dns.TypeTLSA)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", host, err))
+			continue
+		}
+
+		result := &TLSAResult{Host: host}
+		for _, answer := range answers {
+			if tlsa, ok := answer.(*dns.TLSA); ok {
+				result.Records = append(result.Records, TLSARecord{
+					Usage:        tlsa.Usage,
+					Selector:     tlsa.Selector,
+					MatchingType: tlsa.MatchingType,
+					Certificate:  strings.ToLower(tlsa.Certificate),
+				})
+			}
+		}
+
+		if len(result.Records) > 0 {
+			result.DNSSEC = tracker.dnssecStatus()
+			results = append(results, result)
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
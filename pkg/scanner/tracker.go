@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+// trackerContextKey is the context key for a *queryTracker.
+type trackerContextKey struct{}
+
+// queryTracker collects details about every query issued on behalf of a
+// single check (such as the DMARC lookup), which would otherwise be lost
+// between getDNSAnswers and the code that assembles the Result.
+type queryTracker struct {
+	mutex sync.Mutex
+
+	// parent is the tracker carried by the context this tracker was created from, if there was one. Details which
+	// are collected for the whole scan (such as large responses) are recorded by the outermost tracker.
+	parent *queryTracker
+
+	// dnssec is the weakest DNSSEC status of any answer received.
+	dnssec DNSSECStatus
+
+	// evidence holds a record of every query made, if evidence was requested for the scan.
+	evidence []*DNSEvidence
+
+	// largeResponses holds the responses which were too large to be sent reliably over UDP, keyed by name and type.
+	largeResponses map[string]LargeResponse
+}
+
+// withQueryTracker returns a copy of ctx which carries a new *queryTracker.
+func withQueryTracker(ctx context.Context) (context.Context, *queryTracker) {
+	tracker := &queryTracker{parent: trackerFromContext(ctx)}
+	return context.WithValue(ctx, trackerContextKey{}, tracker), tracker
+}
+
+// trackerFromContext returns the *queryTracker carried by ctx, if there is one.
+func trackerFromContext(ctx context.Context) *queryTracker {
+	tracker, _ := ctx.Value(trackerContextKey{}).(*queryTracker)
+	return tracker
+}
+
+// observeDNSSEC records the DNSSEC status of an answer, keeping the weakest
+// status seen so far.
+func (t *queryTracker) observeDNSSEC(status DNSSECStatus) {
+	if t == nil || status == "" {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.dnssec == "" || status.weakerThan(t.dnssec) {
+		t.dnssec = status
+	}
+}
+
+// dnssecStatus returns the weakest DNSSEC status of any answer received.
+func (t *queryTracker) dnssecStatus() DNSSECStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.dnssec
+}
+
+// observeLargeResponse records a response which was too large to be sent
+// reliably over UDP, on the outermost tracker.
+func (t *queryTracker) observeLargeResponse(response LargeResponse) {
+	if t == nil {
+		return
+	}
+
+	for t.parent != nil {
+		t = t.parent
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.largeResponses == nil {
+		t.largeResponses = make(map[string]LargeResponse)
+	}
+
+	// the same record may be queried more than once, such as an SPF include shared by several records
+	key := response.Name + " " + response.Type
+	if existing, ok := t.largeResponses[key]; ok {
+		response.Size = max(response.Size, existing.Size)
+		response.TCP = response.TCP || existing.TCP
+	}
+
+	t.largeResponses[key] = response
+}
+
+// largeResponseList returns the responses which were too large to be sent
+// reliably over UDP, sorted by name and type.
+func (t *queryTracker) largeResponseList() []*LargeResponse {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var responses []*LargeResponse
+	for _, response := range t.largeResponses {
+		responses = append(responses, &response)
+	}
+
+	slices.SortFunc(responses, func(a, b *LargeResponse) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+
+	return responses
+}
+
+// observeEvidence records a query made during the scan, on the outermost
+// tracker.
+func (t *queryTracker) observeEvidence(evidence *DNSEvidence) {
+	if t == nil {
+		return
+	}
+
+	for t.parent != nil {
+		t = t.parent
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.evidence = append(t.evidence, evidence)
+}
+
+// evidenceList returns a record of every query made during the scan, sorted
+// by name and type. Repeated queries are kept in the order they were made.
+func (t *queryTracker) evidenceList() []*DNSEvidence {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	evidence := slices.Clone(t.evidence)
+	slices.SortStableFunc(evidence, func(a, b *DNSEvidence) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+
+	return evidence
+}